@@ -0,0 +1,216 @@
+package packagemanager
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/Masterminds/semver"
+)
+
+// osvEcosystem is the OSV ecosystem of packages published on the npm registry
+const osvEcosystem = "npm"
+
+// Advisory is a security advisory in the OSV format (https://ossf.github.io/osv-schema/).
+// Only the fields needed to match packages and report vulnerabilities are decoded.
+type Advisory struct {
+	ID        string   `json:"id"`
+	Aliases   []string `json:"aliases,omitempty"`
+	Summary   string   `json:"summary,omitempty"`
+	Details   string   `json:"details,omitempty"`
+	Withdrawn string   `json:"withdrawn,omitempty"`
+	Severity  []struct {
+		Type  string `json:"type"`
+		Score string `json:"score"`
+	} `json:"severity,omitempty"`
+	// GitHub advisories record a severity level (LOW, MODERATE, HIGH, CRITICAL) here.
+	DatabaseSpecific struct {
+		Severity string `json:"severity,omitempty"`
+	} `json:"database_specific,omitempty"`
+	Affected []AdvisoryAffected `json:"affected"`
+}
+
+// AdvisoryAffected is a package affected by an advisory.
+type AdvisoryAffected struct {
+	Package struct {
+		Ecosystem string `json:"ecosystem"`
+		Name      string `json:"name"`
+	} `json:"package"`
+	Ranges []struct {
+		// SEMVER, ECOSYSTEM or GIT. GIT ranges are ignored.
+		Type   string `json:"type"`
+		Events []struct {
+			Introduced   string `json:"introduced,omitempty"`
+			Fixed        string `json:"fixed,omitempty"`
+			LastAffected string `json:"last_affected,omitempty"`
+		} `json:"events"`
+	} `json:"ranges,omitempty"`
+	// The affected versions listed explicitly.
+	Versions []string `json:"versions,omitempty"`
+}
+
+// Vulnerability is a package of a lockfile affected by an advisory.
+type Vulnerability struct {
+	Advisory *Advisory
+	// The key of the affected package in Lockfile.Packages.
+	Package string
+	Name    string
+	Version string
+	// The dependency paths pulling the affected package in.
+	Paths []DependencyPath
+}
+
+// LoadAdvisories reads the OSV advisories stored as json files in directory and its subdirectories.
+func LoadAdvisories(directory string) ([]Advisory, error) {
+	return LoadAdvisoriesFS(os.DirFS(directory))
+}
+
+// LoadAdvisoriesFS is LoadAdvisories for the advisories stored in fsys.
+// Withdrawn advisories are skipped.
+func LoadAdvisoriesFS(fsys fs.FS) ([]Advisory, error) {
+	var advisories []Advisory
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(name) != ".json" {
+			return nil
+		}
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		var advisory Advisory
+		if err := json.Unmarshal(content, &advisory); err != nil {
+			return &ParseError{File: name, Line: jsonErrorLine(content, err), Err: err}
+		}
+		if advisory.Withdrawn == "" {
+			advisories = append(advisories, advisory)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return advisories, nil
+}
+
+// Affects tells if the advisory affects the given version of the npm package name.
+func (a *Advisory) Affects(name string, version string) bool {
+	for _, affected := range a.Affected {
+		if affected.Package.Ecosystem == osvEcosystem && affected.Package.Name == name && affected.affects(version) {
+			return true
+		}
+	}
+	return false
+}
+
+// affects evaluates the ranges of affected the way the OSV specification does: events are
+// applied in version order and the last one lower or equal to version tells if it is affected.
+func (affected AdvisoryAffected) affects(version string) bool {
+	if contains(affected.Versions, version) {
+		return true
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return false
+	}
+	type event struct {
+		version  *semver.Version
+		affected bool
+		// last_affected events are inclusive
+		inclusive bool
+	}
+	for _, r := range affected.Ranges {
+		if r.Type != "SEMVER" && r.Type != "ECOSYSTEM" {
+			continue
+		}
+		var events []event
+		for _, e := range r.Events {
+			var ev event
+			var raw string
+			switch {
+			case e.Introduced != "":
+				raw, ev.affected = e.Introduced, true
+			case e.Fixed != "":
+				raw = e.Fixed
+			case e.LastAffected != "":
+				raw, ev.inclusive = e.LastAffected, true
+			default:
+				continue
+			}
+			if raw == "0" {
+				raw = "0.0.0-0"
+			}
+			if ev.version, err = semver.NewVersion(raw); err != nil {
+				continue
+			}
+			events = append(events, ev)
+		}
+		sort.SliceStable(events, func(i, j int) bool { return events[i].version.LessThan(events[j].version) })
+		isAffected := false
+		for _, e := range events {
+			switch {
+			case e.affected && !v.LessThan(e.version):
+				isAffected = true
+			case !e.affected && !e.inclusive && !v.LessThan(e.version):
+				isAffected = false
+			case e.inclusive && v.GreaterThan(e.version):
+				isAffected = false
+			}
+		}
+		if isAffected {
+			return true
+		}
+	}
+	return false
+}
+
+// Audit matches the packages of the lockfile against advisories, like npm audit does but offline.
+// Vulnerabilities are sorted by package name, version and advisory id.
+func Audit(lockfile *Lockfile, advisories []Advisory) []Vulnerability {
+	byName := map[string][]*Advisory{}
+	for i := range advisories {
+		names := map[string]bool{}
+		for _, affected := range advisories[i].Affected {
+			if name := affected.Package.Name; affected.Package.Ecosystem == osvEcosystem && !names[name] {
+				names[name] = true
+				byName[name] = append(byName[name], &advisories[i])
+			}
+		}
+	}
+
+	var vulnerabilities []Vulnerability
+	paths := map[string][]DependencyPath{}
+	for _, key := range sortedKeys(lockfile.Packages) {
+		pkg := lockfile.Packages[key]
+		for _, advisory := range byName[pkg.Name] {
+			if !advisory.Affects(pkg.Name, pkg.Version) {
+				continue
+			}
+			if _, ok := paths[pkg.Name]; !ok {
+				paths[pkg.Name] = Why(lockfile, pkg.Name)
+			}
+			vulnerability := Vulnerability{Advisory: advisory, Package: key, Name: pkg.Name, Version: pkg.Version}
+			for _, path := range paths[pkg.Name] {
+				if path.Packages[len(path.Packages)-1] == pkg {
+					vulnerability.Paths = append(vulnerability.Paths, path)
+				}
+			}
+			vulnerabilities = append(vulnerabilities, vulnerability)
+		}
+	}
+	sort.SliceStable(vulnerabilities, func(i, j int) bool {
+		a, b := vulnerabilities[i], vulnerabilities[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if c := compareVersions(a.Version, b.Version); c != 0 {
+			return c < 0
+		}
+		return a.Advisory.ID < b.Advisory.ID
+	})
+	return vulnerabilities
+}
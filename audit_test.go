@@ -0,0 +1,71 @@
+package packagemanager
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/v3/assert"
+)
+
+func Test_Audit(t *testing.T) {
+	advisories, err := LoadAdvisoriesFS(fstest.MapFS{
+		"npm/GHSA-loose.json": {Data: []byte(`{
+			"id": "GHSA-loose",
+			"summary": "loose-envify is too loose",
+			"database_specific": {"severity": "HIGH"},
+			"affected": [{
+				"package": {"ecosystem": "npm", "name": "loose-envify"},
+				"ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "1.4.1"}]}]
+			}]
+		}`)},
+		"npm/GHSA-lodash.json": {Data: []byte(`{
+			"id": "GHSA-lodash",
+			"affected": [{
+				"package": {"ecosystem": "npm", "name": "lodash"},
+				"ranges": [{"type": "SEMVER", "events": [{"introduced": "4.0.0"}, {"last_affected": "4.17.20"}]}]
+			}]
+		}`)},
+		"npm/GHSA-react.json": {Data: []byte(`{
+			"id": "GHSA-react",
+			"affected": [
+				{"package": {"ecosystem": "PyPI", "name": "react"}, "versions": ["18.2.0"]},
+				{"package": {"ecosystem": "npm", "name": "react"}, "versions": ["18.2.0"]}
+			]
+		}`)},
+		"npm/GHSA-withdrawn.json": {Data: []byte(`{
+			"id": "GHSA-withdrawn",
+			"withdrawn": "2023-01-01T00:00:00Z",
+			"affected": [{"package": {"ecosystem": "npm", "name": "typescript"}, "versions": ["5.1.6"]}]
+		}`)},
+		"README.md": {Data: []byte("not an advisory")},
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, len(advisories), 3)
+
+	lockfile := readLockfileFixture(t, nodejsPnpm, "pnpm-v9.yaml")
+	vulnerabilities := Audit(lockfile, advisories)
+	assert.Equal(t, len(vulnerabilities), 2)
+	assert.Equal(t, vulnerabilities[0].Advisory.ID, "GHSA-loose")
+	assert.Equal(t, vulnerabilities[0].Advisory.DatabaseSpecific.Severity, "HIGH")
+	assert.Equal(t, vulnerabilities[0].Package, "loose-envify@1.4.0")
+	assert.DeepEqual(t, pathStrings(vulnerabilities[0].Paths), []string{"packages/ui > react > loose-envify@1.4.0"})
+	assert.Equal(t, vulnerabilities[1].Advisory.ID, "GHSA-react")
+	assert.DeepEqual(t, pathStrings(vulnerabilities[1].Paths), []string{"packages/ui > react@18.2.0"})
+
+	t.Run("ranges", func(t *testing.T) {
+		lodash := advisories[0]
+		assert.Equal(t, lodash.ID, "GHSA-lodash")
+		for version, want := range map[string]bool{"3.10.1": false, "4.0.0": true, "4.17.20": true, "4.17.21": false, "not-a-version": false} {
+			assert.Equal(t, lodash.Affects("lodash", version), want, version)
+		}
+		assert.Assert(t, !lodash.Affects("lodash-es", "4.17.20"))
+	})
+
+	t.Run("invalid advisory", func(t *testing.T) {
+		_, err := LoadAdvisoriesFS(fstest.MapFS{"bad.json": {Data: []byte(`{"id": 1}`)}})
+		var parseErr *ParseError
+		assert.Assert(t, errors.As(err, &parseErr))
+		assert.Equal(t, parseErr.File, "bad.json")
+	})
+}
@@ -1,172 +1,160 @@
 package packagemanager
 
 import (
-	"errors"
 	"fmt"
-	"os"
-	"os/exec"
-	"path/filepath"
-	"strings"
+	"io/fs"
 
 	"github.com/Masterminds/semver"
-	"github.com/software-t-rex/packageJson"
 	"gopkg.in/yaml.v3"
 )
 
 // isNMLinker Checks that Yarn is set to use the node-modules linker style
-func isNMLinker(cwd string) (bool, error) {
+func isNMLinker(fsys fs.FS) (bool, error) {
 	yarnRC := &YarnRC{}
 
-	bytes, err := os.ReadFile(filepath.Join(cwd, ".yarnrc.yml"))
+	bytes, err := fs.ReadFile(fsys, ".yarnrc.yml")
 	if err != nil {
 		return false, fmt.Errorf(".yarnrc.yml: %w", err)
 	}
 
-	if yaml.Unmarshal(bytes, yarnRC) != nil {
-		return false, fmt.Errorf(".yarnrc.yml: %w", err)
+	if err := yaml.Unmarshal(bytes, yarnRC); err != nil {
+		return false, newYamlParseError(".yarnrc.yml", err)
 	}
 
 	return yarnRC.NodeLinker == "node-modules", nil
 }
 
+// berryVersionFromLockfile returns the lowest yarn version writing the lockfile
+// format used by the project.
+func berryVersionFromLockfile(fsys fs.FS, lockfilePath string) (*semver.Version, error) {
+	bytes, err := fs.ReadFile(fsys, lockfilePath)
+	if err != nil {
+		return nil, err
+	}
+	var header struct {
+		Metadata struct {
+			Version int `yaml:"version"`
+		} `yaml:"__metadata"`
+	}
+	if err := yaml.Unmarshal(bytes, &header); err != nil {
+		return nil, newYamlParseError(lockfilePath, err)
+	}
+	// https://github.com/yarnpkg/berry/blob/master/packages/yarnpkg-core/sources/Project.ts (LOCKFILE_VERSION)
+	switch version := header.Metadata.Version; {
+	case version >= 8:
+		return semver.NewVersion("4.0.0")
+	case version >= 6:
+		return semver.NewVersion("3.2.0")
+	case version == 5:
+		return semver.NewVersion("3.0.0")
+	case version > 0:
+		return semver.NewVersion("2.0.0")
+	}
+	return nil, fmt.Errorf("unknown yarn lockfile version %d", header.Metadata.Version)
+}
+
+func getBerryWorkspaceGlobs(fsys fs.FS) ([]string, error) {
+	return readPackageJSONWorkspaces(fsys, "Yarn")
+}
+
+func getBerryWorkspaceIgnores(pm PackageManager, fsys fs.FS) ([]string, error) {
+	// Matches upstream values:
+	// Key code: https://github.com/yarnpkg/berry/blob/8e0c4b897b0881878a1f901230ea49b7c8113fbe/packages/yarnpkg-core/sources/Workspace.ts#L64-L70
+	return []string{
+		"**/node_modules",
+		"**/.git",
+		"**/.yarn",
+	}, nil
+}
+
 var nodejsBerry = PackageManager{
 	Name:       "nodejs-berry",
 	Slug:       "yarn",
 	Command:    "yarn",
 	Specfile:   "package.json",
-	Lockfile:   "yarn.lock",
+	Lockfile:   berryLockfile,
 	PackageDir: "node_modules",
 
-	getWorkspaceGlobs: func(rootpath string) ([]string, error) {
-		pkg, err := packageJson.Read(filepath.Join(rootpath, "package.json"))
-		if err != nil {
-			return nil, fmt.Errorf("package.json: %w", err)
-		}
-		if len(pkg.Workspaces) == 0 {
-			return nil, fmt.Errorf("package.json: no workspaces found. packagemanager requires Yarn workspaces to be defined in the root package.json")
-		}
-		return pkg.Workspaces, nil
-	},
+	Behavior: BehaviorFuncs{
+		WorkspaceGlobsFunc: getBerryWorkspaceGlobs,
 
-	getWorkspaceIgnores: func(pm PackageManager, rootpath string) ([]string, error) {
-		// Matches upstream values:
-		// Key code: https://github.com/yarnpkg/berry/blob/8e0c4b897b0881878a1f901230ea49b7c8113fbe/packages/yarnpkg-core/sources/Workspace.ts#L64-L70
-		return []string{
-			"**/node_modules",
-			"**/.git",
-			"**/.yarn",
-		}, nil
-	},
+		WorkspaceIgnoresFunc: getBerryWorkspaceIgnores,
 
-	canPrune: func(cwd string) (bool, error) {
-		if isNMLinker, err := isNMLinker(cwd); err != nil {
-			return false, errors.New("could not determine if yarn is using `nodeLinker: node-modules`: " + err.Error())
-		} else if !isNMLinker {
-			return false, errors.New("only yarn v2/v3 with `nodeLinker: node-modules` is supported at this time")
-		}
-		return true, nil
-	},
+		CanPruneFunc: func(fsys fs.FS) (bool, error) {
+			if isNMLinker, err := isNMLinker(fsys); err != nil {
+				return false, fmt.Errorf("could not determine if yarn is using `nodeLinker: node-modules`: %w", err)
+			} else if !isNMLinker {
+				// PackageManager.CanPruneFS fills in the name of the manager
+				return false, &UnsupportedConfigError{Reason: "only yarn v2/v3 with `nodeLinker: node-modules` is supported at this time"}
+			}
+			return true, nil
+		},
 
-	// Versions newer than 2.0 are berry, and before that we simply call them yarn.
-	Matches: func(manager string, version string) (bool, error) {
-		if manager != "yarn" {
-			return false, nil
-		}
-
-		v, err := semver.NewVersion(version)
-		if err != nil {
-			return false, fmt.Errorf("could not parse yarn version: %w", err)
-		}
-		// -0 allows pre-releases versions to be considered valid
-		c, err := semver.NewConstraint(">=2.0.0-0")
-		if err != nil {
-			return false, fmt.Errorf("could not create constraint: %w", err)
-		}
-
-		return c.Check(v), nil
-	},
+		// Versions newer than 2.0 are berry, and before that we simply call them yarn.
+		MatchesFunc: func(manager string, version string) (bool, error) {
+			if manager != "yarn" {
+				return false, nil
+			}
 
-	// Detect for berry needs to identify which version of yarn is running on the system.
-	// Further, berry can be configured in an incompatible way, so we check for compatibility here as well.
-	detect: func(projectDirectory string, packageManager *PackageManager) (bool, error) {
-		specfileExists := FileExists(filepath.Join(projectDirectory, packageManager.Specfile))
-		lockfileExists := FileExists(filepath.Join(projectDirectory, packageManager.Lockfile))
-
-		// Short-circuit, definitely not Yarn.
-		if !specfileExists || !lockfileExists {
-			return false, nil
-		}
-
-		cmd := exec.Command("yarn", "--version")
-		cmd.Dir = projectDirectory
-		out, err := cmd.Output()
-		if err != nil {
-			return false, fmt.Errorf("could not detect yarn version: %w", err)
-		}
-
-		// See if we're a match when we compare these two things.
-		matches, _ := packageManager.Matches(packageManager.Slug, string(out))
-
-		// Short-circuit, definitely not Berry because version number says we're Yarn.
-		if !matches {
-			return false, nil
-		}
-
-		// We're Berry!
-
-		// Check for supported configuration.
-		isNMLinker, err := isNMLinker(projectDirectory)
-
-		if err != nil {
-			// Failed to read the linker state, so we treat an unknown configuration as a failure.
-			return false, fmt.Errorf("could not check if yarn is using nm-linker: %w", err)
-		} else if !isNMLinker {
-			// Not using nm-linker, so unsupported configuration.
-			return false, fmt.Errorf("only yarn nm-linker is supported")
-		}
-
-		// Berry, supported configuration.
-		return true, nil
-	},
+			v, err := semver.NewVersion(version)
+			if err != nil {
+				return false, fmt.Errorf("could not parse yarn version: %w", err)
+			}
+			// -0 allows pre-releases versions to be considered valid
+			c, err := semver.NewConstraint(">=2.0.0-0")
+			if err != nil {
+				return false, fmt.Errorf("could not create constraint: %w", err)
+			}
+
+			return c.Check(v), nil
+		},
+
+		// Detect for berry needs to tell berry from yarn classic, which share the same lockfile name.
+		// Further, berry can be configured in an incompatible way, so we check for compatibility here as well.
+		DetectFunc: func(fsys fs.FS, packageManager *PackageManager) (bool, error) {
+			specfileExists := FileExistsFS(fsys, packageManager.Specfile)
+			lockfileExists := FileExistsFS(fsys, packageManager.Lockfile)
 
-	// UnmarshalLockfile: func(contents []byte) (lockfile.Lockfile, error) {
-	// 	return lockfile.DecodeBerryLockfile(contents)
-	// },
-
-	prunePatches: func(pkgJSON *packageJson.PackageJSON, patches []string) error {
-		pkgJSON.Mu.Lock()
-		defer pkgJSON.Mu.Unlock()
-
-		keysToDelete := []string{}
-		resolutions, ok := pkgJSON.Resolutions.(map[string]interface{})
-		if !ok {
-			return fmt.Errorf("invalid structure for resolutions field in package.json")
-		}
-
-		for dependency, untypedPatch := range resolutions {
-			inPatches := false
-			patch, ok := untypedPatch.(string)
-			if !ok {
-				return fmt.Errorf("expected value of %s in package.json to be a string, got %v", dependency, untypedPatch)
+			// Short-circuit, definitely not Yarn.
+			if !specfileExists || !lockfileExists {
+				return false, nil
 			}
 
-			for _, wantedPatch := range patches {
-				if strings.HasSuffix(patch, wantedPatch) {
-					inPatches = true
-					break
-				}
+			isBerry, err := isBerryLockfile(fsys, packageManager.Lockfile)
+			if err != nil {
+				return false, fmt.Errorf("could not detect yarn lockfile format: %w", err)
 			}
 
-			// We only want to delete unused patches as they are the only ones that throw if unused
-			if !inPatches && strings.HasSuffix(patch, ".patch") {
-				keysToDelete = append(keysToDelete, dependency)
+			// Short-circuit, definitely not Berry because the lockfile says we're Yarn.
+			if !isBerry {
+				return false, nil
 			}
-		}
 
-		for _, key := range keysToDelete {
-			delete(resolutions, key)
-		}
+			// We're Berry!
+
+			// Check for supported configuration.
+			isNMLinker, err := isNMLinker(fsys)
+
+			if err != nil {
+				// Failed to read the linker state, so we treat an unknown configuration as a failure.
+				return false, fmt.Errorf("could not check if yarn is using nm-linker: %w", err)
+			} else if !isNMLinker {
+				// Not using nm-linker, so unsupported configuration.
+				return false, &UnsupportedConfigError{Manager: packageManager.Name, Reason: "only yarn nm-linker is supported"}
+			}
+
+			// Berry, supported configuration.
+			// an unreadable lockfile version is not a detection failure
+			packageManager.Version, _ = berryVersionFromLockfile(fsys, packageManager.Lockfile)
+			return true, nil
+		},
+
+		UnmarshalLockfileFunc: unmarshalBerryLockfile,
+
+		PrunePatchesFunc: berryPrunePatches,
+
+		PruneLockfilePatchesFunc: berryPruneLockfilePatches,
 
-		return nil
+		ListPatchesFunc: berryListPatches,
 	},
 }
@@ -0,0 +1,95 @@
+package packagemanager
+
+import (
+	"bytes"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// unmarshalBerryLockfile reads a yarn berry lockfile
+func unmarshalBerryLockfile(contents []byte) (*Lockfile, error) {
+	blocks, err := splitBerryLockfile(contents)
+	if err != nil {
+		return nil, newYamlParseError(berryLockfile, err)
+	}
+
+	lockfile := newLockfile("")
+	workspaces := map[string]string{}
+	var packages []berryLockfileBlock
+	for _, block := range blocks {
+		if block.descriptors == nil {
+			if block.keyLine >= 0 && bytes.HasPrefix(bytes.Split(block.text, []byte("\n"))[block.keyLine], []byte("__metadata:")) {
+				var header struct {
+					Metadata struct {
+						Version string `yaml:"version"`
+					} `yaml:"__metadata"`
+				}
+				if err := yaml.Unmarshal(block.text, &header); err != nil {
+					return nil, newYamlParseError(berryLockfile, err)
+				}
+				lockfile.Version = header.Metadata.Version
+			}
+			continue
+		}
+		name, reference := splitDescriptor(block.entry.Resolution)
+		if dir, ok := strings.CutPrefix(reference, "workspace:"); ok {
+			lockfile.importer(dir)
+			for _, descriptor := range block.descriptors {
+				workspaces[descriptor] = dir
+			}
+			packages = append(packages, block)
+			continue
+		}
+
+		key := block.entry.Resolution
+		pkg := &LockfilePackage{Name: name, Version: block.entry.Version, Resolved: reference, Checksum: block.entry.Checksum, PeerDependencies: block.entry.PeerDependencies}
+		if reference == "npm:"+block.entry.Version {
+			key = packageKey(name, block.entry.Version)
+			pkg.Resolved = registryTarballURL(name, block.entry.Version)
+		}
+		lockfile.Packages[key] = pkg
+		for _, descriptor := range block.descriptors {
+			lockfile.Descriptors[descriptor] = key
+			// users write npm ranges without their protocol
+			if descriptorName, descriptorRange := splitDescriptor(descriptor); stripNpmProtocol(descriptorRange) != descriptorRange {
+				lockfile.Descriptors[descriptorName+"@"+stripNpmProtocol(descriptorRange)] = key
+			}
+		}
+		packages = append(packages, block)
+	}
+
+	for _, block := range packages {
+		_, reference := splitDescriptor(block.entry.Resolution)
+		dir, isWorkspace := strings.CutPrefix(reference, "workspace:")
+		var pkg *LockfilePackage
+		if !isWorkspace {
+			pkg = lockfile.Packages[lockfile.Descriptors[block.descriptors[0]]]
+		}
+		for name, versionRange := range block.entry.Dependencies {
+			descriptor := name + "@" + versionRange
+			optional := block.entry.DependenciesMeta[name].Optional
+			if isWorkspace {
+				dependency := LockfileDependency{Specifier: stripNpmProtocol(versionRange)}
+				if link, ok := workspaces[descriptor]; ok {
+					dependency.Link = link
+				} else if key, ok := lockfile.Descriptors[descriptor]; ok {
+					dependency.Package, dependency.Version = key, lockfile.Packages[key].Version
+				}
+				lockfile.importer(dir).Dependencies[name] = dependency
+				continue
+			}
+			key, ok := lockfile.Descriptors[descriptor]
+			if !ok {
+				continue
+			}
+			mergeDependencyKeys(&pkg.DependencyRanges, map[string]string{name: stripNpmProtocol(versionRange)})
+			if optional {
+				mergeDependencyKeys(&pkg.OptionalDependencies, map[string]string{name: key})
+			} else {
+				mergeDependencyKeys(&pkg.Dependencies, map[string]string{name: key})
+			}
+		}
+	}
+	return lockfile, nil
+}
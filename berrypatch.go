@@ -0,0 +1,400 @@
+package packagemanager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/software-t-rex/packageJson"
+	"gopkg.in/yaml.v3"
+)
+
+// BerryPatch is a parsed yarn berry patch: protocol descriptor (https://yarnpkg.com/protocol/patch) such as
+// lodash@patch:lodash@npm%3A4.17.21#./.yarn/patches/lodash-npm-4.17.21-6382451519.patch::version=4.17.21&hash=2c6e9e&locator=root%40workspace%3A.
+type BerryPatch struct {
+	// The name of the patched package, empty when parsing a bare "patch:" range.
+	Ident string
+
+	// The url decoded descriptor of the package being patched (lodash@npm:4.17.21).
+	Source string
+
+	// The patch files as written in the descriptor. They are relative to the
+	// workspace declaring them, or to the project root when starting with "~/".
+	// Builtin patches shipped with yarn (~builtin<compat/typescript>) are included.
+	Paths []string
+
+	// The descriptor parameters (version, hash, locator).
+	Params url.Values
+}
+
+// ParseBerryPatch parses a patch: descriptor (name@patch:...) or range (patch:...).
+func ParseBerryPatch(descriptor string) (*BerryPatch, error) {
+	patch := &BerryPatch{}
+	patchRange := descriptor
+	if !strings.HasPrefix(descriptor, "patch:") {
+		name, versionRange := splitDescriptor(descriptor)
+		patch.Ident, patchRange = name, versionRange
+	}
+	if !strings.HasPrefix(patchRange, "patch:") {
+		return nil, fmt.Errorf("%q is not a patch: descriptor", descriptor)
+	}
+	patchRange = strings.TrimPrefix(patchRange, "patch:")
+
+	selector, params, hasParams := strings.Cut(patchRange, "::")
+	source, paths, found := strings.Cut(selector, "#")
+	if !found || paths == "" {
+		return nil, fmt.Errorf("%q has no patch file", descriptor)
+	}
+	decodedSource, err := url.PathUnescape(source)
+	if err != nil {
+		return nil, fmt.Errorf("%q has an invalid source: %w", descriptor, err)
+	}
+	patch.Source = decodedSource
+	patch.Paths = strings.Split(paths, "&")
+	if hasParams {
+		if patch.Params, err = url.ParseQuery(params); err != nil {
+			return nil, fmt.Errorf("%q has invalid parameters: %w", descriptor, err)
+		}
+	}
+	if patch.Ident == "" {
+		patch.Ident, _ = splitDescriptor(patch.Source)
+	}
+	return patch, nil
+}
+
+// isBerryBuiltinPatch tells if path refers to one of the patches shipped with yarn
+func isBerryBuiltinPatch(path string) bool {
+	return strings.Contains(path, "builtin<")
+}
+
+// Files returns the patch files of the descriptor without the builtin patches,
+// stripped of their leading "./" or "~/".
+func (p BerryPatch) Files() []string {
+	var files []string
+	for _, patchPath := range p.Paths {
+		if !isBerryBuiltinPatch(patchPath) {
+			files = append(files, normalizeBerryPatchPath(patchPath))
+		}
+	}
+	return files
+}
+
+// SourceRange returns the range of the patched package, the one to use when
+// dropping the patch (npm:4.17.21).
+func (p BerryPatch) SourceRange() string {
+	_, sourceRange := splitDescriptor(p.Source)
+	return sourceRange
+}
+
+func normalizeBerryPatchPath(patchPath string) string {
+	return path.Clean(strings.TrimPrefix(strings.TrimPrefix(patchPath, "~/"), "./"))
+}
+
+// wants tells if all the patch files of the descriptor are in patches
+func (p BerryPatch) wants(patches []string) bool {
+	for _, file := range p.Files() {
+		if !berryPatchFileWanted(file, patches) {
+			return false
+		}
+	}
+	return true
+}
+
+func berryPatchFileWanted(file string, patches []string) bool {
+	for _, wantedPatch := range patches {
+		if strings.HasSuffix(file, normalizeBerryPatchPath(wantedPatch)) {
+			return true
+		}
+	}
+	return false
+}
+
+// BerryPatchReference is a patch: descriptor found in a project.
+type BerryPatchReference struct {
+	BerryPatch
+
+	// The file referencing the patch, relative to the project root (package.json, apps/web/package.json, yarn.lock).
+	File string
+
+	// The package.json field referencing the patch (resolutions, dependencies...), empty for yarn.lock.
+	Field string
+
+	// The key referencing the patch: the dependency or resolution name, or the lockfile descriptor.
+	Key string
+}
+
+// berryWorkspaces finds the workspaces of a berry project. nodejsBerry can't be used
+// as its behavior lists patches with ListBerryPatches.
+var berryWorkspaces = PackageManager{
+	Behavior: BehaviorFuncs{
+		WorkspaceGlobsFunc:   getBerryWorkspaceGlobs,
+		WorkspaceIgnoresFunc: getBerryWorkspaceIgnores,
+	},
+}
+
+// berryLockfile is the lockfile of yarn berry
+const berryLockfile = "yarn.lock"
+
+// ListBerryPatches returns every patch: descriptor referenced by the project
+// stored at the root of fsys, in its package.json files and its yarn.lock.
+func ListBerryPatches(fsys fs.FS) ([]BerryPatchReference, error) {
+	manifests := []string{"package.json"}
+	workspaces, err := berryWorkspaces.GetWorkspacesFS(fsys)
+	if err != nil && !errors.Is(err, ErrNoWorkspaces) {
+		return nil, err
+	}
+	manifests = append(manifests, workspaces...)
+
+	var references []BerryPatchReference
+	addReference := func(file, field, key, descriptor string) error {
+		patch, err := ParseBerryPatch(descriptor)
+		if err != nil {
+			return &ParseError{File: file, Err: err}
+		}
+		if field != "" && field != "resolutions" {
+			patch.Ident = key
+		}
+		references = append(references, BerryPatchReference{BerryPatch: *patch, File: file, Field: field, Key: key})
+		return nil
+	}
+
+	for _, manifest := range manifests {
+		pkg, err := readPackageJSON(fsys, manifest)
+		if err != nil {
+			return nil, err
+		}
+		if resolutions, ok := pkg.Resolutions.(map[string]interface{}); ok {
+			for _, key := range sortedKeys(resolutions) {
+				if value, ok := resolutions[key].(string); ok && strings.HasPrefix(value, "patch:") {
+					if err := addReference(manifest, "resolutions", key, value); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+		for _, field := range dependencyFields(pkg) {
+			for _, name := range sortedKeys(field.Dependencies) {
+				if value := field.Dependencies[name]; strings.HasPrefix(value, "patch:") {
+					if err := addReference(manifest, field.Name, name, value); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+
+	if !FileExistsFS(fsys, berryLockfile) {
+		return references, nil
+	}
+	content, err := fs.ReadFile(fsys, berryLockfile)
+	if err != nil {
+		return nil, err
+	}
+	blocks, err := splitBerryLockfile(content)
+	if err != nil {
+		return nil, &ParseError{File: berryLockfile, Err: err}
+	}
+	for _, block := range blocks {
+		for _, descriptor := range block.descriptors {
+			if _, versionRange := splitDescriptor(descriptor); strings.HasPrefix(versionRange, "patch:") {
+				if err := addReference(berryLockfile, "", descriptor, descriptor); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return references, nil
+}
+
+// berryPrunePatches removes from pkgJSON the patch: descriptors using a patch file
+// that is not in patches. Patched resolutions are removed and patched dependencies
+// are restored to the range of the patched package. Missing sections are ignored.
+func berryPrunePatches(pkgJSON *packageJson.PackageJSON, patches []string) (*PruneSummary, error) {
+	pkgJSON.Mu.Lock()
+	defer pkgJSON.Mu.Unlock()
+
+	summary := &PruneSummary{}
+	if pkgJSON.Resolutions != nil {
+		resolutions, ok := pkgJSON.Resolutions.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid structure for resolutions field in package.json")
+		}
+
+		for _, dependency := range sortedKeys(resolutions) {
+			patch, ok := resolutions[dependency].(string)
+			if !ok {
+				return nil, fmt.Errorf("expected value of %s in package.json to be a string, got %v", dependency, resolutions[dependency])
+			}
+
+			unwanted := false
+			if berryPatch, err := ParseBerryPatch(patch); err == nil {
+				unwanted = !berryPatch.wants(patches)
+			} else {
+				// We only want to delete unused patches as they are the only ones that throw if unused
+				unwanted = strings.HasSuffix(patch, ".patch") && !berryPatchFileWanted(patch, patches)
+			}
+			if unwanted {
+				delete(resolutions, dependency)
+				summary.Removed = append(summary.Removed, PrunedPatch{File: "package.json", Field: "resolutions", Key: dependency, Patch: patch})
+			}
+		}
+	}
+
+	for _, field := range dependencyFields(pkgJSON) {
+		for _, name := range sortedKeys(field.Dependencies) {
+			versionRange := field.Dependencies[name]
+			if !strings.HasPrefix(versionRange, "patch:") {
+				continue
+			}
+			berryPatch, err := ParseBerryPatch(versionRange)
+			if err != nil {
+				return nil, fmt.Errorf("%s of %s in package.json: %w", name, field.Name, err)
+			}
+			if !berryPatch.wants(patches) {
+				// npm: is the default protocol, and the way users write their ranges
+				replacement := strings.TrimPrefix(berryPatch.SourceRange(), "npm:")
+				field.Dependencies[name] = replacement
+				summary.Removed = append(summary.Removed, PrunedPatch{File: "package.json", Field: field.Name, Key: name, Patch: versionRange, Replacement: replacement})
+			}
+		}
+	}
+
+	return summary, nil
+}
+
+// berryPruneLockfilePatches removes from a berry lockfile the entries resolved
+// with a patch file that is not in patches. Dependencies on those entries are
+// restored to the range of the patched package.
+func berryPruneLockfilePatches(contents []byte, patches []string) ([]byte, error) {
+	blocks, err := splitBerryLockfile(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	unwanted := func(descriptor string) (*BerryPatch, bool) {
+		patch, err := ParseBerryPatch(descriptor)
+		if err != nil {
+			return nil, false
+		}
+		return patch, !patch.wants(patches)
+	}
+
+	var kept [][]byte
+	for _, block := range blocks {
+		if block.descriptors == nil {
+			kept = append(kept, block.text)
+			continue
+		}
+		if _, drop := unwanted(block.entry.Resolution); drop {
+			continue
+		}
+		descriptors := []string{}
+		for _, descriptor := range block.descriptors {
+			if _, drop := unwanted(descriptor); !drop {
+				descriptors = append(descriptors, descriptor)
+			}
+		}
+		if len(descriptors) == 0 {
+			continue
+		}
+
+		lines := bytes.Split(block.text, []byte("\n"))
+		for i, line := range lines {
+			if i == block.keyLine {
+				if len(descriptors) != len(block.descriptors) {
+					key, err := marshalJSONValue(strings.Join(descriptors, ", "))
+					if err != nil {
+						return nil, err
+					}
+					lines[i] = append(key, ':')
+				}
+				continue
+			}
+			match := berryLockfileValueRegex.FindSubmatch(line)
+			if match == nil {
+				continue
+			}
+			value := string(match[2])
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			}
+			if patch, drop := unwanted(value); drop {
+				sourceRange, err := marshalJSONValue(patch.SourceRange())
+				if err != nil {
+					return nil, err
+				}
+				lines[i] = concatBytes(match[1], sourceRange)
+			}
+		}
+		kept = append(kept, bytes.Join(lines, []byte("\n")))
+	}
+
+	return bytes.Join(kept, []byte("\n\n")), nil
+}
+
+// berryLockfileValueRegex matches the "key: value" lines of a lockfile entry holding a patch: range
+var berryLockfileValueRegex = regexp.MustCompile(`^(\s+\S+: )("?patch:.*)$`)
+
+// berryLockfileEntry is an entry of a berry lockfile
+type berryLockfileEntry struct {
+	Version          string            `yaml:"version"`
+	Resolution       string            `yaml:"resolution"`
+	Dependencies     map[string]string `yaml:"dependencies"`
+	PeerDependencies map[string]string `yaml:"peerDependencies"`
+	Bin              map[string]string `yaml:"bin"`
+	DependenciesMeta map[string]struct {
+		Optional bool `yaml:"optional"`
+	} `yaml:"dependenciesMeta"`
+	Checksum     string `yaml:"checksum"`
+	LanguageName string `yaml:"languageName"`
+	LinkType     string `yaml:"linkType"`
+}
+
+// berryLockfileBlock is a blank line separated part of a berry lockfile
+type berryLockfileBlock struct {
+	// The original text of the block
+	text []byte
+	// The index of the line holding the entry key
+	keyLine int
+	// The descriptors of the entry key, nil for comments and metadata
+	descriptors []string
+	// The entry content
+	entry berryLockfileEntry
+}
+
+// splitBerryLockfile splits a berry lockfile in blocks, keeping their formatting.
+// Berry writes each entry as a block separated by blank lines.
+func splitBerryLockfile(contents []byte) ([]berryLockfileBlock, error) {
+	contents = bytes.ReplaceAll(contents, []byte("\r\n"), []byte("\n"))
+	var blocks []berryLockfileBlock
+	for _, text := range bytes.Split(contents, []byte("\n\n")) {
+		block := berryLockfileBlock{text: text, keyLine: -1}
+		lines := bytes.Split(text, []byte("\n"))
+		for i, line := range lines {
+			if len(line) > 0 && line[0] != '#' && line[0] != ' ' {
+				block.keyLine = i
+				break
+			}
+		}
+		if block.keyLine < 0 || bytes.HasPrefix(lines[block.keyLine], []byte("__metadata:")) {
+			blocks = append(blocks, block)
+			continue
+		}
+		var entries map[string]berryLockfileEntry
+		if err := yaml.Unmarshal(text, &entries); err != nil {
+			return nil, err
+		}
+		for key, entry := range entries {
+			block.descriptors = strings.Split(key, ", ")
+			block.entry = entry
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
@@ -0,0 +1,227 @@
+package packagemanager
+
+import (
+	"net/url"
+	"testing"
+	"testing/fstest"
+
+	"github.com/software-t-rex/packageJson"
+	"gotest.tools/v3/assert"
+)
+
+func Test_ParseBerryPatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		descriptor string
+		want       BerryPatch
+		wantFiles  []string
+		wantErr    bool
+	}{
+		{
+			name:       "lockfile descriptor",
+			descriptor: "lodash@patch:lodash@npm%3A4.17.21#./.yarn/patches/lodash-npm-4.17.21-6382451519.patch::version=4.17.21&hash=2c6e9e&locator=root%40workspace%3A.",
+			want: BerryPatch{
+				Ident:  "lodash",
+				Source: "lodash@npm:4.17.21",
+				Paths:  []string{"./.yarn/patches/lodash-npm-4.17.21-6382451519.patch"},
+				Params: url.Values{"version": {"4.17.21"}, "hash": {"2c6e9e"}, "locator": {"root@workspace:."}},
+			},
+			wantFiles: []string{".yarn/patches/lodash-npm-4.17.21-6382451519.patch"},
+		},
+		{
+			name:       "scoped range",
+			descriptor: "patch:@types/node@npm%3A^18.0.0#~/.yarn/patches/node.patch",
+			want: BerryPatch{
+				Ident:  "@types/node",
+				Source: "@types/node@npm:^18.0.0",
+				Paths:  []string{"~/.yarn/patches/node.patch"},
+			},
+			wantFiles: []string{".yarn/patches/node.patch"},
+		},
+		{
+			name:       "builtin",
+			descriptor: "typescript@patch:typescript@npm%3A5.0.4#optional!builtin<compat/typescript>",
+			want: BerryPatch{
+				Ident:  "typescript",
+				Source: "typescript@npm:5.0.4",
+				Paths:  []string{"optional!builtin<compat/typescript>"},
+			},
+		},
+		{name: "not a patch", descriptor: "lodash@npm:4.17.21", wantErr: true},
+		{name: "no patch file", descriptor: "lodash@patch:lodash@npm%3A4.17.21", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseBerryPatch(tt.descriptor)
+			if tt.wantErr {
+				assert.Assert(t, err != nil, "ParseBerryPatch() expected an error")
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, *got, tt.want)
+			assert.DeepEqual(t, got.Files(), tt.wantFiles)
+		})
+	}
+}
+
+func Test_berryPrunePatches(t *testing.T) {
+	pkgJSON := &packageJson.PackageJSON{
+		Resolutions: map[string]interface{}{
+			"lodash":   "patch:lodash@npm%3A4.17.21#./.yarn/patches/lodash.patch",
+			"debug":    "patch:debug@npm%3A4.3.4#./.yarn/patches/debug.patch",
+			"ms":       "2.1.3",
+			"chalk":    "./patches/chalk.patch",
+			"minimist": "./patches/minimist.patch",
+		},
+		Dependencies: map[string]string{
+			"left-pad": "patch:left-pad@npm%3A^1.3.0#./.yarn/patches/left-pad.patch",
+			"react":    "patch:react@18.2.0#./.yarn/patches/react.patch",
+		},
+		DevDependencies: map[string]string{
+			"typescript": "patch:typescript@npm%3A5.0.4#optional!builtin<compat/typescript>",
+		},
+	}
+	summary, err := berryPrunePatches(pkgJSON, []string{".yarn/patches/lodash.patch", "patches/chalk.patch", ".yarn/patches/react.patch"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, summary.Removed, []PrunedPatch{
+		{File: "package.json", Field: "resolutions", Key: "debug", Patch: "patch:debug@npm%3A4.3.4#./.yarn/patches/debug.patch"},
+		{File: "package.json", Field: "resolutions", Key: "minimist", Patch: "./patches/minimist.patch"},
+		{File: "package.json", Field: "dependencies", Key: "left-pad", Patch: "patch:left-pad@npm%3A^1.3.0#./.yarn/patches/left-pad.patch", Replacement: "^1.3.0"},
+	})
+	assert.DeepEqual(t, pkgJSON.Resolutions, map[string]interface{}{
+		"lodash": "patch:lodash@npm%3A4.17.21#./.yarn/patches/lodash.patch",
+		"ms":     "2.1.3",
+		"chalk":  "./patches/chalk.patch",
+	})
+	assert.DeepEqual(t, pkgJSON.Dependencies, map[string]string{
+		"left-pad": "^1.3.0",
+		"react":    "patch:react@18.2.0#./.yarn/patches/react.patch",
+	})
+	assert.Equal(t, pkgJSON.DevDependencies["typescript"], "patch:typescript@npm%3A5.0.4#optional!builtin<compat/typescript>")
+
+	summary, err = berryPrunePatches(&packageJson.PackageJSON{}, nil)
+	assert.NilError(t, err, "missing resolutions should not fail")
+	assert.Equal(t, len(summary.Removed), 0)
+	_, err = berryPrunePatches(&packageJson.PackageJSON{Resolutions: []interface{}{}}, nil)
+	assert.ErrorContains(t, err, "invalid structure")
+}
+
+const berryPatchedLockfile = `# This file is generated by running "yarn install" inside your project.
+# Manual changes might be lost - proceed with caution!
+
+__metadata:
+  version: 6
+  cacheKey: 8
+
+"app@workspace:.":
+  version: 0.0.0-use.local
+  resolution: "app@workspace:."
+  dependencies:
+    debug: "patch:debug@npm%3A4.3.4#./.yarn/patches/debug.patch::locator=app%40workspace%3A."
+    lodash: "patch:lodash@npm%3A4.17.21#./.yarn/patches/lodash.patch::locator=app%40workspace%3A."
+  languageName: unknown
+  linkType: soft
+
+"debug@npm:4.3.4":
+  version: 4.3.4
+  resolution: "debug@npm:4.3.4"
+  checksum: aaa
+  languageName: node
+  linkType: hard
+
+"debug@patch:debug@npm%3A4.3.4#./.yarn/patches/debug.patch::locator=app%40workspace%3A.":
+  version: 4.3.4
+  resolution: "debug@patch:debug@npm%3A4.3.4#./.yarn/patches/debug.patch::version=4.3.4&hash=111111&locator=app%40workspace%3A."
+  checksum: bbb
+  languageName: node
+  linkType: hard
+
+"lodash@npm:4.17.21":
+  version: 4.17.21
+  resolution: "lodash@npm:4.17.21"
+  checksum: ccc
+  languageName: node
+  linkType: hard
+
+"lodash@patch:lodash@npm%3A4.17.21#./.yarn/patches/lodash.patch::locator=app%40workspace%3A.":
+  version: 4.17.21
+  resolution: "lodash@patch:lodash@npm%3A4.17.21#./.yarn/patches/lodash.patch::version=4.17.21&hash=222222&locator=app%40workspace%3A."
+  checksum: ddd
+  languageName: node
+  linkType: hard
+`
+
+func Test_berryPruneLockfilePatches(t *testing.T) {
+	pruned, err := nodejsBerry.PruneLockfilePatches([]byte(berryPatchedLockfile), []string{".yarn/patches/lodash.patch"})
+	assert.NilError(t, err)
+	assert.Equal(t, string(pruned), `# This file is generated by running "yarn install" inside your project.
+# Manual changes might be lost - proceed with caution!
+
+__metadata:
+  version: 6
+  cacheKey: 8
+
+"app@workspace:.":
+  version: 0.0.0-use.local
+  resolution: "app@workspace:."
+  dependencies:
+    debug: "npm:4.3.4"
+    lodash: "patch:lodash@npm%3A4.17.21#./.yarn/patches/lodash.patch::locator=app%40workspace%3A."
+  languageName: unknown
+  linkType: soft
+
+"debug@npm:4.3.4":
+  version: 4.3.4
+  resolution: "debug@npm:4.3.4"
+  checksum: aaa
+  languageName: node
+  linkType: hard
+
+"lodash@npm:4.17.21":
+  version: 4.17.21
+  resolution: "lodash@npm:4.17.21"
+  checksum: ccc
+  languageName: node
+  linkType: hard
+
+"lodash@patch:lodash@npm%3A4.17.21#./.yarn/patches/lodash.patch::locator=app%40workspace%3A.":
+  version: 4.17.21
+  resolution: "lodash@patch:lodash@npm%3A4.17.21#./.yarn/patches/lodash.patch::version=4.17.21&hash=222222&locator=app%40workspace%3A."
+  checksum: ddd
+  languageName: node
+  linkType: hard
+`)
+
+	unchanged, err := nodejsNpm.PruneLockfilePatches([]byte("{}"), nil)
+	assert.NilError(t, err)
+	assert.Equal(t, string(unchanged), "{}")
+}
+
+func Test_ListBerryPatches(t *testing.T) {
+	fsys := fstest.MapFS{
+		"package.json": {Data: []byte(`{
+			"name": "app",
+			"workspaces": ["packages/*"],
+			"resolutions": {"lodash": "patch:lodash@npm%3A4.17.21#./.yarn/patches/lodash.patch", "ms": "2.1.3"}
+		}`)},
+		"packages/ui/package.json": {Data: []byte(`{
+			"name": "ui",
+			"dependencies": {"left-pad": "patch:left-pad@npm%3A^1.3.0#~/.yarn/patches/left-pad.patch"}
+		}`)},
+		"yarn.lock": {Data: []byte(berryPatchedLockfile)},
+	}
+	references, err := ListBerryPatches(fsys)
+	assert.NilError(t, err)
+
+	type reference struct{ File, Field, Key, Ident string }
+	var got []reference
+	for _, ref := range references {
+		got = append(got, reference{ref.File, ref.Field, ref.Key, ref.Ident})
+	}
+	assert.DeepEqual(t, got, []reference{
+		{"package.json", "resolutions", "lodash", "lodash"},
+		{"packages/ui/package.json", "dependencies", "left-pad", "left-pad"},
+		{"yarn.lock", "", "debug@patch:debug@npm%3A4.3.4#./.yarn/patches/debug.patch::locator=app%40workspace%3A.", "debug"},
+		{"yarn.lock", "", "lodash@patch:lodash@npm%3A4.17.21#./.yarn/patches/lodash.patch::locator=app%40workspace%3A.", "lodash"},
+	})
+}
@@ -0,0 +1,210 @@
+package packagemanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/software-t-rex/packageJson"
+)
+
+// catalogProtocol prefixes dependency ranges resolved from a pnpm catalog (https://pnpm.io/catalogs)
+const catalogProtocol = "catalog:"
+
+// catalogName returns the name of the catalog referenced by a catalog: range
+func catalogName(versionRange string) string {
+	name := strings.TrimSpace(strings.TrimPrefix(versionRange, catalogProtocol))
+	if name == "" {
+		return "default"
+	}
+	return name
+}
+
+// ResolveCatalogRange returns the range of dependency in the catalog referenced by
+// versionRange (catalog: or catalog:<name>). Ranges not using the catalog: protocol
+// are returned as is.
+func (settings PnpmWorkspaces) ResolveCatalogRange(dependency string, versionRange string) (string, error) {
+	if !strings.HasPrefix(versionRange, catalogProtocol) {
+		return versionRange, nil
+	}
+	name := catalogName(versionRange)
+	catalog, ok := settings.Catalogs[name]
+	if !ok && name == "default" {
+		catalog, ok = settings.Catalog, settings.Catalog != nil
+	}
+	if !ok {
+		return "", fmt.Errorf("%s: catalog %q is not defined in %s", dependency, name, pnpmWorkspaceFile)
+	}
+	resolved, ok := catalog[dependency]
+	if !ok {
+		return "", fmt.Errorf("%s: no entry in catalog %q of %s", dependency, name, pnpmWorkspaceFile)
+	}
+	return resolved, nil
+}
+
+// ResolveCatalogs rewrites the catalog: ranges of pkg into the ranges of the catalogs.
+// pkg is left untouched when a range can't be resolved. Use ResolveCatalogsManifest or
+// ResolveCatalogsFile to rewrite package.json contents without losing the fields pkg doesn't hold.
+func (settings PnpmWorkspaces) ResolveCatalogs(pkg *packageJson.PackageJSON) error {
+	pkg.Mu.Lock()
+	defer pkg.Mu.Unlock()
+
+	fields := dependencyFields(pkg)
+	resolvedFields := make([]map[string]string, len(fields))
+	for i, field := range fields {
+		resolvedFields[i] = map[string]string{}
+		for _, name := range sortedKeys(field.Dependencies) {
+			resolved, err := settings.ResolveCatalogRange(name, field.Dependencies[name])
+			if err != nil {
+				return fmt.Errorf("%s of %s: %w", field.Name, pkg.Name, err)
+			}
+			resolvedFields[i][name] = resolved
+		}
+	}
+	for i, field := range fields {
+		for name, resolved := range resolvedFields[i] {
+			field.Dependencies[name] = resolved
+		}
+	}
+	return nil
+}
+
+// ResolveCatalogsManifest returns the package.json contents manifest with its catalog: ranges
+// rewritten into the ranges of the catalogs. The other fields and the formatting of manifest
+// are left untouched.
+func (settings PnpmWorkspaces) ResolveCatalogsManifest(manifest []byte) ([]byte, error) {
+	pkg := &packageJson.PackageJSON{}
+	if err := json.Unmarshal(manifest, pkg); err != nil {
+		return nil, &ParseError{File: "package.json", Line: jsonErrorLine(manifest, err), Err: err}
+	}
+
+	resolved := manifest
+	for _, field := range dependencyFields(pkg) {
+		for _, name := range sortedKeys(field.Dependencies) {
+			versionRange := field.Dependencies[name]
+			if !strings.HasPrefix(versionRange, catalogProtocol) {
+				continue
+			}
+			catalogRange, err := settings.ResolveCatalogRange(name, versionRange)
+			if err != nil {
+				return nil, fmt.Errorf("%s of %s: %w", field.Name, pkg.Name, err)
+			}
+			if resolved, err = setJSONField(resolved, []string{field.Name, name}, catalogRange); err != nil {
+				return nil, &ParseError{File: "package.json", Err: err}
+			}
+		}
+	}
+	return resolved, nil
+}
+
+// ResolveCatalogsFile rewrites the catalog: ranges of the package.json file at pkgJSONPath
+// into the ranges of the catalogs, leaving the rest of the file untouched.
+// The file is left untouched when a range can't be resolved.
+func (settings PnpmWorkspaces) ResolveCatalogsFile(pkgJSONPath string) error {
+	info, err := os.Stat(pkgJSONPath)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(pkgJSONPath)
+	if err != nil {
+		return err
+	}
+	content, err = settings.ResolveCatalogsManifest(content)
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		parseErr.File = pkgJSONPath
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(pkgJSONPath, content, info.Mode().Perm())
+}
+
+// CatalogEntry is a dependency range of a catalog.
+type CatalogEntry struct {
+	Catalog string
+	Name    string
+	Range   string
+}
+
+// CatalogBypass is a dependency declared with its own range while catalogs have an entry for it.
+type CatalogBypass struct {
+	// The package.json declaring the dependency, relative to the project root.
+	Workspace string
+	Field     string
+	Name      string
+	Range     string
+	// The catalogs having an entry for the dependency.
+	Catalogs []string
+}
+
+// CatalogReport reports the inconsistencies between the catalogs and the workspaces using them.
+type CatalogReport struct {
+	// Catalog entries no workspace references.
+	Unused []CatalogEntry
+
+	// Dependencies pinned outside of the catalogs.
+	Bypassed []CatalogBypass
+}
+
+// CheckCatalogs reports the catalog entries of the project in projectDirectory that
+// no workspace uses, and the workspaces pinning versions outside of the catalogs.
+func CheckCatalogs(projectDirectory string) (*CatalogReport, error) {
+	return CheckCatalogsFS(os.DirFS(projectDirectory))
+}
+
+// CheckCatalogsFS is CheckCatalogs for the project stored at the root of fsys.
+func CheckCatalogsFS(fsys fs.FS) (*CatalogReport, error) {
+	settings, err := readPnpmSettingsFS(fsys)
+	if err != nil {
+		return nil, err
+	}
+	manifests := []string{"package.json"}
+	workspaces, err := nodejsPnpm.GetWorkspacesFS(fsys)
+	if err != nil && !errors.Is(err, ErrNoWorkspaces) {
+		return nil, err
+	}
+	manifests = append(manifests, workspaces...)
+
+	report := &CatalogReport{}
+	used := map[CatalogEntry]bool{}
+	for _, manifest := range manifests {
+		pkg, err := readPackageJSON(fsys, manifest)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range dependencyFields(pkg) {
+			for _, name := range sortedKeys(field.Dependencies) {
+				versionRange := field.Dependencies[name]
+				if strings.HasPrefix(versionRange, catalogProtocol) {
+					used[CatalogEntry{Catalog: catalogName(versionRange), Name: name}] = true
+					continue
+				}
+				if strings.HasPrefix(versionRange, "workspace:") {
+					continue
+				}
+				var catalogs []string
+				for _, catalog := range sortedKeys(settings.Catalogs) {
+					if _, ok := settings.Catalogs[catalog][name]; ok {
+						catalogs = append(catalogs, catalog)
+					}
+				}
+				if len(catalogs) > 0 {
+					report.Bypassed = append(report.Bypassed, CatalogBypass{Workspace: manifest, Field: field.Name, Name: name, Range: versionRange, Catalogs: catalogs})
+				}
+			}
+		}
+	}
+
+	for _, catalog := range sortedKeys(settings.Catalogs) {
+		for _, name := range sortedKeys(settings.Catalogs[catalog]) {
+			if !used[CatalogEntry{Catalog: catalog, Name: name}] {
+				report.Unused = append(report.Unused, CatalogEntry{Catalog: catalog, Name: name, Range: settings.Catalogs[catalog][name]})
+			}
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,108 @@
+package packagemanager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/software-t-rex/packageJson"
+	"gotest.tools/v3/assert"
+)
+
+var catalogProject = fstest.MapFS{
+	"package.json": {Data: []byte(`{"name": "root", "devDependencies": {"typescript": "catalog:"}}`)},
+	"pnpm-workspace.yaml": {Data: []byte(`packages:
+  - apps/*
+catalog:
+  typescript: ^5.2.0
+  react: ^18.2.0
+  lodash: ^4.17.21
+catalogs:
+  react17:
+    react: ^17.0.2
+`)},
+	"apps/web/package.json":    {Data: []byte(`{"name": "web", "dependencies": {"react": "catalog:", "ui": "workspace:*"}}`)},
+	"apps/legacy/package.json": {Data: []byte(`{"name": "legacy", "dependencies": {"react": "catalog:react17", "lodash": "4.17.20"}}`)},
+}
+
+func Test_ResolveCatalogs(t *testing.T) {
+	settings, err := nodejsPnpm.ReadPnpmSettingsFS(catalogProject)
+	assert.NilError(t, err)
+
+	pkg := &packageJson.PackageJSON{
+		Name:            "legacy",
+		Dependencies:    map[string]string{"react": "catalog:react17", "lodash": "4.17.20"},
+		DevDependencies: map[string]string{"typescript": "catalog:default"},
+	}
+	assert.NilError(t, settings.ResolveCatalogs(pkg))
+	assert.DeepEqual(t, pkg.Dependencies, map[string]string{"react": "^17.0.2", "lodash": "4.17.20"})
+	assert.DeepEqual(t, pkg.DevDependencies, map[string]string{"typescript": "^5.2.0"})
+
+	pkg.Dependencies = map[string]string{"react": "catalog:react17", "vue": "catalog:", "zod": "catalog:"}
+	assert.ErrorContains(t, settings.ResolveCatalogs(pkg), `dependencies of legacy: vue: no entry in catalog "default"`)
+	assert.DeepEqual(t, pkg.Dependencies, map[string]string{"react": "catalog:react17", "vue": "catalog:", "zod": "catalog:"})
+
+	_, err = settings.ResolveCatalogRange("react", "catalog:react16")
+	assert.ErrorContains(t, err, `catalog "react16" is not defined`)
+	_, err = settings.ResolveCatalogRange("vue", "catalog:")
+	assert.ErrorContains(t, err, `no entry in catalog "default"`)
+}
+
+func Test_ResolveCatalogsFile(t *testing.T) {
+	settings, err := nodejsPnpm.ReadPnpmSettingsFS(catalogProject)
+	assert.NilError(t, err)
+
+	pkgJSONPath := filepath.Join(t.TempDir(), "package.json")
+	manifest := `{
+    "name": "legacy",
+    "exports": {"./*": "./dist/*.js"},
+    "dependencies": {
+        "react": "catalog:react17",
+        "lodash": "4.17.20"
+    },
+    "devDependencies": {"typescript": "catalog:"}
+}
+`
+	assert.NilError(t, os.WriteFile(pkgJSONPath, []byte(manifest), 0o600))
+	assert.NilError(t, settings.ResolveCatalogsFile(pkgJSONPath))
+	content, err := os.ReadFile(pkgJSONPath)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), `{
+    "name": "legacy",
+    "exports": {"./*": "./dist/*.js"},
+    "dependencies": {
+        "react": "^17.0.2",
+        "lodash": "4.17.20"
+    },
+    "devDependencies": {"typescript": "^5.2.0"}
+}
+`)
+	info, err := os.Stat(pkgJSONPath)
+	assert.NilError(t, err)
+	assert.Equal(t, info.Mode().Perm(), os.FileMode(0o600))
+
+	unresolved := `{"name": "legacy", "dependencies": {"react": "catalog:react17", "vue": "catalog:"}}`
+	assert.NilError(t, os.WriteFile(pkgJSONPath, []byte(unresolved), 0o600))
+	assert.ErrorContains(t, settings.ResolveCatalogsFile(pkgJSONPath), `dependencies of legacy: vue: no entry in catalog "default"`)
+	content, err = os.ReadFile(pkgJSONPath)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), unresolved)
+
+	assert.NilError(t, os.WriteFile(pkgJSONPath, []byte(`{"name": "legacy",`), 0o600))
+	var parseErr *ParseError
+	assert.Assert(t, errors.As(settings.ResolveCatalogsFile(pkgJSONPath), &parseErr))
+	assert.Equal(t, parseErr.File, pkgJSONPath)
+}
+
+func Test_CheckCatalogsFS(t *testing.T) {
+	report, err := CheckCatalogsFS(catalogProject)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, report.Unused, []CatalogEntry{
+		{Catalog: "default", Name: "lodash", Range: "^4.17.21"},
+	})
+	assert.DeepEqual(t, report.Bypassed, []CatalogBypass{
+		{Workspace: "apps/legacy/package.json", Field: "dependencies", Name: "lodash", Range: "4.17.20", Catalogs: []string{"default"}},
+	})
+}
@@ -0,0 +1,239 @@
+package packagemanager
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+// DependencyDeclaration is a dependency declared by a workspace.
+type DependencyDeclaration struct {
+	// The package.json declaring the dependency, relative to the project root.
+	Workspace string
+	Field     string
+	Name      string
+	Range     string
+}
+
+// VersionMismatch is an external dependency declared with different ranges across workspaces.
+type VersionMismatch struct {
+	Name         string
+	Declarations []DependencyDeclaration
+}
+
+// WorkspaceMismatch is a sibling workspace referenced with a range its current version doesn't satisfy.
+type WorkspaceMismatch struct {
+	DependencyDeclaration
+	// The current version of the referenced workspace.
+	Version string
+}
+
+// ConsistencyReport reports the dependency ranges that are inconsistent across workspaces.
+type ConsistencyReport struct {
+	Mismatches            []VersionMismatch
+	UnsatisfiedWorkspaces []WorkspaceMismatch
+}
+
+// VersionPolicy tells which range to keep when fixing a VersionMismatch.
+type VersionPolicy string
+
+const (
+	// PolicyHighest keeps the range with the highest minimum version.
+	PolicyHighest VersionPolicy = "highest"
+	// PolicyLowest keeps the range with the lowest minimum version.
+	PolicyLowest VersionPolicy = "lowest"
+	// PolicyPinned uses the range given for the dependency, leaving other dependencies untouched.
+	PolicyPinned VersionPolicy = "pinned"
+)
+
+// VersionFix is the new range of a declaration.
+type VersionFix struct {
+	DependencyDeclaration
+	NewRange string
+}
+
+// CheckVersionConsistency reports, for the project in projectDirectory, the external
+// dependencies declared with different ranges in different workspaces and the sibling
+// workspaces referenced with ranges that their current version doesn't satisfy.
+// peerDependencies are intentionally loose and only checked against sibling workspaces.
+// Ranges that don't target the registry (catalog:, file:, link:, git urls...) are ignored.
+func (pm PackageManager) CheckVersionConsistency(projectDirectory string) (*ConsistencyReport, error) {
+	return pm.CheckVersionConsistencyFS(os.DirFS(projectDirectory))
+}
+
+// CheckVersionConsistencyFS is CheckVersionConsistency for the project stored at the root of fsys.
+func (pm PackageManager) CheckVersionConsistencyFS(fsys fs.FS) (*ConsistencyReport, error) {
+	manifests := []string{"package.json"}
+	workspaces, err := pm.GetWorkspacesFS(fsys)
+	if err != nil && !errors.Is(err, ErrNoWorkspaces) {
+		return nil, err
+	}
+	manifests = append(manifests, workspaces...)
+
+	versions := map[string]string{}
+	var declarations []DependencyDeclaration
+	for _, manifest := range manifests {
+		pkg, err := readPackageJSON(fsys, manifest)
+		if err != nil {
+			return nil, err
+		}
+		if pkg.Name != "" {
+			versions[pkg.Name] = pkg.Version
+		}
+		for _, field := range dependencyFields(pkg) {
+			for _, name := range sortedKeys(field.Dependencies) {
+				declarations = append(declarations, DependencyDeclaration{Workspace: manifest, Field: field.Name, Name: name, Range: field.Dependencies[name]})
+			}
+		}
+	}
+
+	report := &ConsistencyReport{}
+	var names []string
+	external := map[string][]DependencyDeclaration{}
+	for _, declaration := range declarations {
+		if version, ok := versions[declaration.Name]; ok {
+			if !workspaceRangeSatisfied(declaration.Range, version) {
+				report.UnsatisfiedWorkspaces = append(report.UnsatisfiedWorkspaces, WorkspaceMismatch{DependencyDeclaration: declaration, Version: version})
+			}
+			continue
+		}
+		if declaration.Field == "peerDependencies" || !isRegistryRange(declaration.Range) {
+			continue
+		}
+		if _, ok := external[declaration.Name]; !ok {
+			names = append(names, declaration.Name)
+		}
+		external[declaration.Name] = append(external[declaration.Name], declaration)
+	}
+	for _, name := range names {
+		for _, declaration := range external[name][1:] {
+			if declaration.Range != external[name][0].Range {
+				report.Mismatches = append(report.Mismatches, VersionMismatch{Name: name, Declarations: external[name]})
+				break
+			}
+		}
+	}
+	return report, nil
+}
+
+// isRegistryRange tells if versionRange is a semver range resolved from the registry
+func isRegistryRange(versionRange string) bool {
+	_, err := semver.NewConstraint(versionRange)
+	return err == nil
+}
+
+// workspaceRangeSatisfied tells if versionRange, a workspace: range or not, accepts version
+func workspaceRangeSatisfied(versionRange string, version string) bool {
+	spec := strings.TrimPrefix(versionRange, workspaceProtocol)
+	switch spec {
+	case "", "*", "^", "~":
+		return true
+	}
+	constraint, err := semver.NewConstraint(spec)
+	if err != nil {
+		// not a semver range (path, alias, url...), nothing to check
+		return true
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return false
+	}
+	return constraint.Check(v)
+}
+
+// rangeFloor returns the minimum version of simple ranges such as ^1.2.3, ~1.2 or >=1.0.0
+func rangeFloor(versionRange string) (*semver.Version, bool) {
+	floor := strings.TrimLeft(strings.TrimSpace(versionRange), "^~>=v ")
+	if floor == "" || strings.ContainsAny(floor, " |<*xX") {
+		return nil, false
+	}
+	v, err := semver.NewVersion(floor)
+	return v, err == nil
+}
+
+// Fixes returns the changes needed to make the report consistent with the given policy.
+// pins gives the range of each dependency for PolicyPinned, and overrides the policy for
+// the other policies. Mismatches whose ranges can't be ordered (complex ranges, tags) are
+// left untouched unless pinned. Unsatisfied workspace references are fixed to accept
+// the current version of the workspace (^version, keeping the workspace: protocol).
+func (r ConsistencyReport) Fixes(policy VersionPolicy, pins map[string]string) ([]VersionFix, error) {
+	switch policy {
+	case PolicyHighest, PolicyLowest, PolicyPinned:
+	default:
+		return nil, fmt.Errorf("unknown version policy %q", policy)
+	}
+
+	var fixes []VersionFix
+	addFixes := func(declarations []DependencyDeclaration, newRange string) {
+		for _, declaration := range declarations {
+			if declaration.Range != newRange {
+				fixes = append(fixes, VersionFix{DependencyDeclaration: declaration, NewRange: newRange})
+			}
+		}
+	}
+
+	for _, mismatch := range r.Mismatches {
+		if pinned, ok := pins[mismatch.Name]; ok {
+			addFixes(mismatch.Declarations, pinned)
+			continue
+		}
+		if policy == PolicyPinned {
+			continue
+		}
+		var chosen string
+		var chosenFloor *semver.Version
+		for _, declaration := range mismatch.Declarations {
+			floor, ok := rangeFloor(declaration.Range)
+			if !ok {
+				chosen = ""
+				break
+			}
+			if chosenFloor == nil || (policy == PolicyHighest && floor.GreaterThan(chosenFloor)) || (policy == PolicyLowest && floor.LessThan(chosenFloor)) {
+				chosen, chosenFloor = declaration.Range, floor
+			}
+		}
+		if chosen != "" {
+			addFixes(mismatch.Declarations, chosen)
+		}
+	}
+
+	for _, mismatch := range r.UnsatisfiedWorkspaces {
+		newRange := "^" + mismatch.Version
+		if pinned, ok := pins[mismatch.Name]; ok {
+			newRange = pinned
+		} else if strings.HasPrefix(mismatch.Range, workspaceProtocol) {
+			newRange = workspaceProtocol + newRange
+		}
+		addFixes([]DependencyDeclaration{mismatch.DependencyDeclaration}, newRange)
+	}
+	return fixes, nil
+}
+
+// ApplyVersionFixes writes the fixes to the package.json files of the project in
+// projectDirectory, leaving the rest of the files untouched.
+func ApplyVersionFixes(projectDirectory string, fixes []VersionFix) error {
+	for _, fix := range fixes {
+		pkgJSONPath := filepath.Join(projectDirectory, filepath.FromSlash(fix.Workspace))
+		info, err := os.Stat(pkgJSONPath)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(pkgJSONPath)
+		if err != nil {
+			return err
+		}
+		content, err = setJSONField(content, []string{fix.Field, fix.Name}, fix.NewRange)
+		if err != nil {
+			return &ParseError{File: pkgJSONPath, Err: err}
+		}
+		if err := os.WriteFile(pkgJSONPath, content, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package packagemanager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func Test_VersionConsistency(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"package.json": `{
+  "name": "root",
+  "workspaces": ["packages/*"],
+  "devDependencies": {
+    "typescript": "^5.1.0"
+  }
+}
+`,
+		"package-lock.json": `{"lockfileVersion": 3}`,
+		"packages/ui/package.json": `{
+  "name": "ui",
+  "version": "2.1.0",
+  "dependencies": {
+    "react": "^18.2.0",
+    "lodash": "^4.17.0"
+  },
+  "devDependencies": {
+    "typescript": "~5.2.2"
+  },
+  "peerDependencies": {
+    "react": ">=16"
+  }
+}
+`,
+		"packages/web/package.json": `{
+  "name": "web",
+  "dependencies": {
+    "lodash": "4.17.21",
+    "react": "^18.2.0",
+    "ui": "^1.0.0",
+    "local": "file:../local"
+  }
+}
+`,
+	})
+
+	report, err := nodejsNpm.CheckVersionConsistency(root)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, report.Mismatches, []VersionMismatch{
+		{Name: "typescript", Declarations: []DependencyDeclaration{
+			{Workspace: "package.json", Field: "devDependencies", Name: "typescript", Range: "^5.1.0"},
+			{Workspace: "packages/ui/package.json", Field: "devDependencies", Name: "typescript", Range: "~5.2.2"},
+		}},
+		{Name: "lodash", Declarations: []DependencyDeclaration{
+			{Workspace: "packages/ui/package.json", Field: "dependencies", Name: "lodash", Range: "^4.17.0"},
+			{Workspace: "packages/web/package.json", Field: "dependencies", Name: "lodash", Range: "4.17.21"},
+		}},
+	})
+	assert.DeepEqual(t, report.UnsatisfiedWorkspaces, []WorkspaceMismatch{
+		{DependencyDeclaration: DependencyDeclaration{Workspace: "packages/web/package.json", Field: "dependencies", Name: "ui", Range: "^1.0.0"}, Version: "2.1.0"},
+	})
+
+	lowest, err := report.Fixes(PolicyLowest, nil)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, lowest, []VersionFix{
+		{DependencyDeclaration: DependencyDeclaration{Workspace: "packages/ui/package.json", Field: "devDependencies", Name: "typescript", Range: "~5.2.2"}, NewRange: "^5.1.0"},
+		{DependencyDeclaration: DependencyDeclaration{Workspace: "packages/web/package.json", Field: "dependencies", Name: "lodash", Range: "4.17.21"}, NewRange: "^4.17.0"},
+		{DependencyDeclaration: DependencyDeclaration{Workspace: "packages/web/package.json", Field: "dependencies", Name: "ui", Range: "^1.0.0"}, NewRange: "^2.1.0"},
+	})
+
+	pinned, err := report.Fixes(PolicyPinned, map[string]string{"lodash": "^4.17.21"})
+	assert.NilError(t, err)
+	assert.Equal(t, len(pinned), 3)
+
+	_, err = report.Fixes("newest", nil)
+	assert.ErrorContains(t, err, "unknown version policy")
+
+	highest, err := report.Fixes(PolicyHighest, nil)
+	assert.NilError(t, err)
+	assert.NilError(t, ApplyVersionFixes(root, highest))
+	content, err := os.ReadFile(filepath.Join(root, "packages/web/package.json"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), `{
+  "name": "web",
+  "dependencies": {
+    "lodash": "4.17.21",
+    "react": "^18.2.0",
+    "ui": "^2.1.0",
+    "local": "file:../local"
+  }
+}
+`)
+
+	report, err = nodejsNpm.CheckVersionConsistency(root)
+	assert.NilError(t, err)
+	assert.Equal(t, len(report.Mismatches), 0)
+	assert.Equal(t, len(report.UnsatisfiedWorkspaces), 0)
+}
@@ -0,0 +1,170 @@
+package packagemanager
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// PackageManagerSpec is the parsed representation of the packageManager field
+// of a package.json as understood by corepack.
+// (https://github.com/nodejs/corepack#when-authoring-packages)
+//
+// It can either be a version: "pnpm@8.6.0+sha256.abc..."
+// or a tarball url: "yarn@https://registry.npmjs.org/@yarnpkg/cli-dist/-/cli-dist-3.2.3.tgz#sha224.abc..."
+type PackageManagerSpec struct {
+	// The package manager name (npm, pnpm, yarn or the Slug of a registered package manager).
+	Name string
+
+	// The package manager version. When the spec is an url, the version is
+	// inferred from the tarball name and may be empty.
+	Version string
+
+	// The url of the package manager tarball, empty when the spec is a version.
+	URL string
+
+	// The algorithm of the integrity hash (sha1, sha224, sha256, sha384 or sha512), empty if none.
+	HashAlgorithm string
+
+	// The hexadecimal digest of the integrity hash, empty if none.
+	HashDigest string
+}
+
+var (
+	packageManagerSpecRegex    = regexp.MustCompile(`^([a-z0-9][a-z0-9._-]*)@(.+)$`)
+	packageManagerVersionRegex = regexp.MustCompile(`^\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+	packageManagerHashRegex    = regexp.MustCompile(`^(sha1|sha224|sha256|sha384|sha512)\.([0-9a-fA-F]+)$`)
+	// cli-dist-3.2.3.tgz, pnpm-8.6.0.tgz, npm-9.8.1.tgz
+	tarballVersionRegex = regexp.MustCompile(`-(\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?)\.tgz$`)
+)
+
+// ParsePackageManagerSpec parses a packageManager field as written by corepack,
+// integrity hash included.
+func ParsePackageManagerSpec(packageManager string) (*PackageManagerSpec, error) {
+	invalid := func(reason string) error {
+		return &ParseError{
+			File: "package.json",
+			Err:  fmt.Errorf("we could not parse packageManager field %q: %s", packageManager, reason),
+		}
+	}
+
+	slugs := registeredSlugs()
+	match := packageManagerSpecRegex.FindStringSubmatch(strings.TrimSpace(packageManager))
+	if match == nil || !contains(slugs, match[1]) {
+		return nil, invalid(fmt.Sprintf("expected <%s>@<version|url>", strings.Join(slugs, "|")))
+	}
+	spec := &PackageManagerSpec{Name: match[1]}
+	reference := match[2]
+
+	if strings.HasPrefix(reference, "https://") || strings.HasPrefix(reference, "http://") {
+		url, hash, _ := strings.Cut(reference, "#")
+		if hash != "" {
+			hashMatch := packageManagerHashRegex.FindStringSubmatch(hash)
+			if hashMatch == nil {
+				return nil, invalid("unsupported integrity hash " + hash)
+			}
+			spec.HashAlgorithm, spec.HashDigest = hashMatch[1], strings.ToLower(hashMatch[2])
+		}
+		spec.URL = url
+		if versionMatch := tarballVersionRegex.FindStringSubmatch(url); versionMatch != nil {
+			spec.Version = versionMatch[1]
+		}
+		return spec, nil
+	}
+
+	version := reference
+	if i := strings.LastIndex(reference, "+"); i >= 0 {
+		// "+" is also used for semver build metadata, only strip it when it looks like a hash
+		if hashMatch := packageManagerHashRegex.FindStringSubmatch(reference[i+1:]); hashMatch != nil {
+			version = reference[:i]
+			spec.HashAlgorithm, spec.HashDigest = hashMatch[1], strings.ToLower(hashMatch[2])
+		}
+	}
+	if !packageManagerVersionRegex.MatchString(version) {
+		return nil, invalid("expected a fully qualified semver version or a tarball url, received " + version)
+	}
+	spec.Version = version
+	return spec, nil
+}
+
+// String returns the spec in the format expected by the packageManager field.
+func (spec PackageManagerSpec) String() string {
+	if spec.URL != "" {
+		if spec.HashAlgorithm != "" {
+			return fmt.Sprintf("%s@%s#%s.%s", spec.Name, spec.URL, spec.HashAlgorithm, spec.HashDigest)
+		}
+		return spec.Name + "@" + spec.URL
+	}
+	if spec.HashAlgorithm != "" {
+		return fmt.Sprintf("%s@%s+%s.%s", spec.Name, spec.Version, spec.HashAlgorithm, spec.HashDigest)
+	}
+	return spec.Name + "@" + spec.Version
+}
+
+func newHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "sha1":
+		return sha1.New(), nil
+	case "sha224":
+		return sha256.New224(), nil
+	case "sha256":
+		return sha256.New(), nil
+	case "sha384":
+		return sha512.New384(), nil
+	case "sha512":
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported hash algorithm %q", algorithm)
+}
+
+// VerifyTarball checks that the tarball at path matches the integrity hash of the spec.
+// It returns ErrIntegrityMismatch when it doesn't.
+func (spec PackageManagerSpec) VerifyTarball(path string) error {
+	if spec.HashAlgorithm == "" {
+		return fmt.Errorf("%s has no integrity hash to verify against", spec.String())
+	}
+	h, err := newHash(spec.HashAlgorithm)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := io.Copy(h, file); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if digest := hex.EncodeToString(h.Sum(nil)); digest != spec.HashDigest {
+		return fmt.Errorf("%s: %w: expected %s.%s, got %s.%s", path, ErrIntegrityMismatch, spec.HashAlgorithm, spec.HashDigest, spec.HashAlgorithm, digest)
+	}
+	return nil
+}
+
+// SetPackageManagerField writes the given spec to the packageManager field of
+// the package.json at pkgJSONPath, leaving the rest of the file untouched.
+func SetPackageManagerField(pkgJSONPath string, spec PackageManagerSpec) error {
+	if _, err := ParsePackageManagerSpec(spec.String()); err != nil {
+		return err
+	}
+	info, err := os.Stat(pkgJSONPath)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(pkgJSONPath)
+	if err != nil {
+		return err
+	}
+	content, err = setTopLevelJSONField(content, "packageManager", spec.String())
+	if err != nil {
+		return &ParseError{File: pkgJSONPath, Err: err}
+	}
+	return os.WriteFile(pkgJSONPath, content, info.Mode().Perm())
+}
@@ -0,0 +1,125 @@
+package packagemanager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func Test_ParsePackageManagerSpec(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    PackageManagerSpec
+		wantErr bool
+	}{
+		{
+			name: "version only",
+			spec: "npm@9.8.1",
+			want: PackageManagerSpec{Name: "npm", Version: "9.8.1"},
+		},
+		{
+			name: "version with hash",
+			spec: "pnpm@8.6.0+sha512.ABCDEF0123",
+			want: PackageManagerSpec{Name: "pnpm", Version: "8.6.0", HashAlgorithm: "sha512", HashDigest: "abcdef0123"},
+		},
+		{
+			name: "version with build metadata",
+			spec: "yarn@4.0.0-rc.1+git.123",
+			want: PackageManagerSpec{Name: "yarn", Version: "4.0.0-rc.1+git.123"},
+		},
+		{
+			name: "url with hash",
+			spec: "yarn@https://registry.npmjs.org/@yarnpkg/cli-dist/-/cli-dist-3.2.3.tgz#sha224.16a0797d",
+			want: PackageManagerSpec{Name: "yarn", Version: "3.2.3", URL: "https://registry.npmjs.org/@yarnpkg/cli-dist/-/cli-dist-3.2.3.tgz", HashAlgorithm: "sha224", HashDigest: "16a0797d"},
+		},
+		{
+			name: "url without version",
+			spec: "pnpm@https://example.com/pnpm.tgz",
+			want: PackageManagerSpec{Name: "pnpm", URL: "https://example.com/pnpm.tgz"},
+		},
+		{name: "tag", spec: "npm@latest", wantErr: true},
+		{name: "empty build metadata", spec: "npm@1.2.3+", wantErr: true},
+		{name: "unknown url hash", spec: "npm@https://example.com/npm-1.2.3.tgz#md4.abc", wantErr: true},
+		{name: "unknown manager", spec: "bun@1.0.0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePackageManagerSpec(tt.spec)
+			if tt.wantErr {
+				var parseErr *ParseError
+				assert.Assert(t, errors.As(err, &parseErr), "ParsePackageManagerSpec() error = %v", err)
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, *got, tt.want)
+			if tt.want.HashDigest == "" || tt.want.HashDigest == got.HashDigest {
+				reparsed, err := ParsePackageManagerSpec(got.String())
+				assert.NilError(t, err)
+				assert.DeepEqual(t, reparsed, got)
+			}
+		})
+	}
+}
+
+func Test_VerifyTarball(t *testing.T) {
+	tarball := filepath.Join(t.TempDir(), "pnpm-8.6.0.tgz")
+	content := []byte("not really a tarball")
+	assert.NilError(t, os.WriteFile(tarball, content, 0o644))
+	digest := sha256.Sum256(content)
+
+	spec := PackageManagerSpec{Name: "pnpm", Version: "8.6.0", HashAlgorithm: "sha256", HashDigest: hex.EncodeToString(digest[:])}
+	assert.NilError(t, spec.VerifyTarball(tarball))
+
+	spec.HashDigest = "0123"
+	err := spec.VerifyTarball(tarball)
+	assert.Assert(t, errors.Is(err, ErrIntegrityMismatch), "VerifyTarball() error = %v", err)
+
+	spec.HashAlgorithm = ""
+	assert.ErrorContains(t, spec.VerifyTarball(tarball), "no integrity hash")
+}
+
+func Test_SetPackageManagerField(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "replaces existing field",
+			content: "{\n\t\"name\": \"a\",\n\t\"packageManager\": \"pnpm@7.0.0\",\n\t\"private\": true\n}\n",
+			want:    "{\n\t\"name\": \"a\",\n\t\"packageManager\": \"pnpm@8.6.0+sha256.abc\",\n\t\"private\": true\n}\n",
+		},
+		{
+			name:    "appends missing field",
+			content: "{\n    \"name\": \"a\",\n    \"scripts\": {\"build\": \"tsc && echo '<done>'\"}\n}\n",
+			want:    "{\n    \"name\": \"a\",\n    \"scripts\": {\"build\": \"tsc && echo '<done>'\"},\n    \"packageManager\": \"pnpm@8.6.0+sha256.abc\"\n}\n",
+		},
+		{
+			name:    "ignores nested fields",
+			content: "{\"engines\": {\"packageManager\": \"x\"}}",
+			want:    "{\"engines\": {\"packageManager\": \"x\"},\n  \"packageManager\": \"pnpm@8.6.0+sha256.abc\"}",
+		},
+		{
+			name:    "empty object",
+			content: "{}",
+			want:    "{\n  \"packageManager\": \"pnpm@8.6.0+sha256.abc\"\n}",
+		},
+	}
+	spec := PackageManagerSpec{Name: "pnpm", Version: "8.6.0", HashAlgorithm: "sha256", HashDigest: "abc"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkgJSONPath := filepath.Join(t.TempDir(), "package.json")
+			assert.NilError(t, os.WriteFile(pkgJSONPath, []byte(tt.content), 0o644))
+			assert.NilError(t, SetPackageManagerField(pkgJSONPath, spec))
+			got, err := os.ReadFile(pkgJSONPath)
+			assert.NilError(t, err)
+			assert.Equal(t, string(got), tt.want)
+		})
+	}
+}
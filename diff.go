@@ -0,0 +1,207 @@
+package packagemanager
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FileDiff is the part of a unified diff changing a single file.
+type FileDiff struct {
+	// The path of the file before the change, empty for created files.
+	OldPath string
+	// The path of the file after the change, empty for deleted files.
+	NewPath string
+	Hunks   []Hunk
+}
+
+// Hunk is a change to a contiguous range of lines of a file.
+type Hunk struct {
+	// The first line of the hunk in the original file (1-based)
+	OldStart int
+	OldLines int
+	// The first line of the hunk in the changed file (1-based)
+	NewStart int
+	NewLines int
+	// The hunk lines, prefixed with ' ', '-' or '+'
+	Lines []string
+}
+
+var hunkHeaderRegex = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// ParseUnifiedDiff parses a unified diff as written by diff -u or git diff.
+// Paths are stripped of their a/ and b/ prefixes.
+func ParseUnifiedDiff(content []byte) ([]FileDiff, error) {
+	var diffs []FileDiff
+	var current *FileDiff
+	// tells if the file header of current is complete, the next --- starting another file
+	headerDone := false
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, 1024*1024)
+	lineNumber := 0
+	next := func() (string, bool) {
+		if !scanner.Scan() {
+			return "", false
+		}
+		lineNumber++
+		return strings.TrimSuffix(scanner.Text(), "\r"), true
+	}
+
+	for line, ok := next(); ok; line, ok = next() {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			diffs = append(diffs, FileDiff{})
+			current, headerDone = &diffs[len(diffs)-1], false
+			if oldPath, newPath, found := strings.Cut(strings.TrimPrefix(line, "diff --git "), " b/"); found {
+				current.OldPath, current.NewPath = diffPath(oldPath), newPath
+			}
+		case strings.HasPrefix(line, "--- "):
+			if current == nil || headerDone {
+				diffs = append(diffs, FileDiff{})
+				current = &diffs[len(diffs)-1]
+			}
+			current.OldPath = diffPath(strings.TrimPrefix(line, "--- "))
+		case strings.HasPrefix(line, "+++ "):
+			if current == nil {
+				return nil, fmt.Errorf("line %d: +++ without ---", lineNumber)
+			}
+			current.NewPath = diffPath(strings.TrimPrefix(line, "+++ "))
+			headerDone = true
+		case strings.HasPrefix(line, "@@ "):
+			if current == nil {
+				return nil, fmt.Errorf("line %d: hunk without file header", lineNumber)
+			}
+			match := hunkHeaderRegex.FindStringSubmatch(line)
+			if match == nil {
+				return nil, fmt.Errorf("line %d: invalid hunk header %q", lineNumber, line)
+			}
+			hunk := Hunk{
+				OldStart: atoiDefault(match[1], 0),
+				OldLines: atoiDefault(match[2], 1),
+				NewStart: atoiDefault(match[3], 0),
+				NewLines: atoiDefault(match[4], 1),
+			}
+			oldLeft, newLeft := hunk.OldLines, hunk.NewLines
+			for oldLeft > 0 || newLeft > 0 {
+				line, ok := next()
+				if !ok {
+					return nil, fmt.Errorf("line %d: unexpected end of hunk", lineNumber)
+				}
+				if line == "" {
+					// editors tend to strip the trailing space of empty context lines
+					line = " "
+				}
+				switch line[0] {
+				case ' ':
+					oldLeft--
+					newLeft--
+				case '-':
+					oldLeft--
+				case '+':
+					newLeft--
+				case '\\':
+					// \ No newline at end of file
+					continue
+				default:
+					return nil, fmt.Errorf("line %d: unexpected line in hunk %q", lineNumber, line)
+				}
+				hunk.Lines = append(hunk.Lines, line)
+			}
+			current.Hunks = append(current.Hunks, hunk)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return diffs, nil
+}
+
+// diffPath strips a diff header path of its timestamp and a/ or b/ prefix,
+// /dev/null being returned as an empty path
+func diffPath(header string) string {
+	header, _, _ = strings.Cut(header, "\t")
+	if header == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(header, "a/") || strings.HasPrefix(header, "b/") {
+		return header[2:]
+	}
+	return header
+}
+
+func atoiDefault(s string, defaultValue int) int {
+	if s == "" {
+		return defaultValue
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return defaultValue
+	}
+	return i
+}
+
+// oldLines returns the lines the hunk expects in the original file
+func (h Hunk) oldLines() []string {
+	return h.linesWith('-')
+}
+
+// newLines returns the lines the hunk leaves in the changed file
+func (h Hunk) newLines() []string {
+	return h.linesWith('+')
+}
+
+func (h Hunk) linesWith(prefix byte) []string {
+	var lines []string
+	for _, line := range h.Lines {
+		if line[0] == ' ' || line[0] == prefix {
+			lines = append(lines, line[1:])
+		}
+	}
+	return lines
+}
+
+// rewriteDiffPaths returns content with the paths of its file headers replaced by rewrite,
+// which receives and returns paths stripped of their a/ or b/ prefix. Hunks are left untouched.
+func rewriteDiffPaths(content []byte, rewrite func(string) string) []byte {
+	var out bytes.Buffer
+	rewriteHeaderPath := func(header string) string {
+		if header == "/dev/null" || !(strings.HasPrefix(header, "a/") || strings.HasPrefix(header, "b/")) {
+			return header
+		}
+		headerPath, timestamp, found := strings.Cut(header, "\t")
+		if found {
+			timestamp = "\t" + timestamp
+		}
+		return headerPath[:2] + rewrite(headerPath[2:]) + timestamp
+	}
+	// the lines left in the current hunk, a removed "-- " line looking like a file header
+	oldLines, newLines := 0, 0
+	for _, line := range strings.SplitAfter(string(content), "\n") {
+		text := strings.TrimRight(line, "\r\n")
+		eol := line[len(text):]
+		switch {
+		case oldLines > 0 || newLines > 0:
+			if strings.HasPrefix(text, "-") || strings.HasPrefix(text, " ") || text == "" {
+				oldLines--
+			}
+			if strings.HasPrefix(text, "+") || strings.HasPrefix(text, " ") || text == "" {
+				newLines--
+			}
+		case strings.HasPrefix(text, "@@"):
+			if match := hunkHeaderRegex.FindStringSubmatch(text); match != nil {
+				oldLines, newLines = atoiDefault(match[2], 1), atoiDefault(match[4], 1)
+			}
+		case strings.HasPrefix(text, "diff --git "):
+			if oldPath, newPath, found := strings.Cut(strings.TrimPrefix(text, "diff --git "), " b/"); found {
+				text = "diff --git " + rewriteHeaderPath(oldPath) + " " + rewriteHeaderPath("b/"+newPath)
+			}
+		case strings.HasPrefix(text, "--- ") || strings.HasPrefix(text, "+++ "):
+			text = text[:4] + rewriteHeaderPath(text[4:])
+		}
+		out.WriteString(text + eol)
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,142 @@
+package packagemanager
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/Masterminds/semver"
+)
+
+// DriftKind tells how a dependency drifted from the lockfile.
+type DriftKind string
+
+const (
+	// DriftAdded is a dependency declared in package.json that the lockfile doesn't record.
+	DriftAdded DriftKind = "added"
+	// DriftRemoved is a dependency recorded in the lockfile that package.json doesn't declare anymore.
+	DriftRemoved DriftKind = "removed"
+	// DriftChanged is a dependency declared with another range than the one recorded in the lockfile.
+	DriftChanged DriftKind = "changed"
+	// DriftUnsatisfied is a dependency whose locked version doesn't satisfy the declared range.
+	DriftUnsatisfied DriftKind = "unsatisfied"
+)
+
+// Drift is a dependency whose declaration doesn't match the lockfile.
+type Drift struct {
+	// The workspace directory relative to the project root ("." for the root).
+	Workspace string
+	Name      string
+	Kind      DriftKind
+	// The range declared in package.json, empty for removed dependencies.
+	Declared string
+	// The specifier or version recorded in the lockfile, empty for added dependencies.
+	Locked string
+}
+
+// CheckLockfileDrift compares the dependencies declared by each workspace of the project in
+// projectDirectory with the lockfile, without running the package manager. It reports the
+// dependencies added, removed or changed since the lockfile was written. peerDependencies
+// are not installed by all managers and are ignored.
+// Yarn classic doesn't record the workspaces, which are inferred from package.json: a range without
+// a lockfile descriptor is reported as changed from another descriptor of the package, or as
+// unsatisfied when the version of that descriptor doesn't satisfy it.
+func (pm PackageManager) CheckLockfileDrift(projectDirectory string) ([]Drift, error) {
+	return pm.CheckLockfileDriftFS(os.DirFS(projectDirectory))
+}
+
+// CheckLockfileDriftFS is CheckLockfileDrift for the project stored at the root of fsys.
+func (pm PackageManager) CheckLockfileDriftFS(fsys fs.FS) ([]Drift, error) {
+	lockfile, err := pm.ReadLockfileFS(fsys)
+	if err != nil {
+		return nil, err
+	}
+	if lockfile == nil {
+		return nil, &UnsupportedConfigError{Manager: pm.Name, Reason: "reading the lockfile is not supported"}
+	}
+	manifests := []string{"package.json"}
+	workspaces, err := pm.GetWorkspacesFS(fsys)
+	if err != nil && !errors.Is(err, ErrNoWorkspaces) {
+		return nil, err
+	}
+	manifests = append(manifests, workspaces...)
+
+	declared := map[string]map[string]string{}
+	for _, manifest := range manifests {
+		pkg, err := readPackageJSON(fsys, manifest)
+		if err != nil {
+			return nil, err
+		}
+		dependencies := map[string]string{}
+		for _, field := range dependencyFields(pkg) {
+			if field.Name == "peerDependencies" {
+				continue
+			}
+			for name, versionRange := range field.Dependencies {
+				if _, ok := dependencies[name]; !ok {
+					dependencies[name] = versionRange
+				}
+			}
+		}
+		declared[path.Dir(manifest)] = dependencies
+	}
+
+	var drifts []Drift
+	for _, dir := range sortedKeys(declared) {
+		dependencies := declared[dir]
+		importer, ok := lockfile.Importers[dir]
+		if !ok {
+			importer = &LockfileImporter{}
+		}
+		for _, name := range sortedKeys(dependencies) {
+			declaredRange := dependencies[name]
+			locked, ok := importer.Dependencies[name]
+			switch {
+			case !ok:
+				drifts = append(drifts, Drift{Workspace: dir, Name: name, Kind: DriftAdded, Declared: declaredRange})
+			case locked.Specifier != "":
+				if locked.Specifier == declaredRange {
+					break
+				}
+				// inferred specifiers come from another descriptor of the package, which may not
+				// be the one the lockfile resolves the declared range with
+				if importer.Inferred && locked.Version != "" && !versionSatisfies(declaredRange, locked.Version) {
+					drifts = append(drifts, Drift{Workspace: dir, Name: name, Kind: DriftUnsatisfied, Declared: declaredRange, Locked: locked.Version})
+				} else {
+					drifts = append(drifts, Drift{Workspace: dir, Name: name, Kind: DriftChanged, Declared: declaredRange, Locked: locked.Specifier})
+				}
+			case locked.Version != "" && !versionSatisfies(declaredRange, locked.Version):
+				drifts = append(drifts, Drift{Workspace: dir, Name: name, Kind: DriftUnsatisfied, Declared: declaredRange, Locked: locked.Version})
+			}
+		}
+		for _, name := range sortedKeys(importer.Dependencies) {
+			locked := importer.Dependencies[name]
+			if _, ok := dependencies[name]; !ok && locked.Specifier != "" {
+				drifts = append(drifts, Drift{Workspace: dir, Name: name, Kind: DriftRemoved, Locked: locked.Specifier})
+			}
+		}
+	}
+	sort.SliceStable(drifts, func(i, j int) bool {
+		if drifts[i].Workspace != drifts[j].Workspace {
+			return drifts[i].Workspace < drifts[j].Workspace
+		}
+		return drifts[i].Name < drifts[j].Name
+	})
+	return drifts, nil
+}
+
+// versionSatisfies tells if version satisfies versionRange. Ranges that are not
+// semver ranges (tags, urls, aliases...) can't be checked and are considered satisfied.
+func versionSatisfies(versionRange string, version string) bool {
+	constraint, err := semver.NewConstraint(versionRange)
+	if err != nil {
+		return true
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return true
+	}
+	return constraint.Check(v)
+}
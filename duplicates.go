@@ -0,0 +1,119 @@
+package packagemanager
+
+import (
+	"sort"
+)
+
+// DuplicatePackage is a package installed at several versions.
+type DuplicatePackage struct {
+	Name string
+	// The installed versions, in ascending order.
+	Versions []DuplicateVersion
+	// The total number of installed copies, across versions.
+	Copies int
+	// The highest installed version satisfying the range of every dependent, empty when none does
+	// or when the lockfile doesn't record every range (pnpm only records the workspaces ranges).
+	Suggested string
+}
+
+// DuplicateVersion is one of the versions of a DuplicatePackage.
+type DuplicateVersion struct {
+	Version string
+	// The key of the package in Lockfile.Packages.
+	Package string
+	// The number of installed copies of this version: its install locations when
+	// the lockfile records them (npm), 1 otherwise.
+	Copies int
+	// The workspaces and packages depending on this version.
+	Dependents []VersionDependent
+}
+
+// VersionDependent is a workspace or a package depending on a version of a package.
+type VersionDependent struct {
+	// The directory of the dependent workspace, empty for packages.
+	Workspace string
+	// The key of the dependent package in Lockfile.Packages, empty for workspaces.
+	Package string
+	// The range requested by the dependent, empty when the lockfile doesn't record it.
+	Range string
+}
+
+// FindDuplicates lists the packages the lockfile installs at several versions, sorted by name,
+// with the dependents forcing each version. Duplicates usually mean bigger bundles and, for
+// packages like react, runtime errors.
+func FindDuplicates(lockfile *Lockfile) []DuplicatePackage {
+	keysByName := map[string][]string{}
+	for _, key := range sortedKeys(lockfile.Packages) {
+		name := lockfile.Packages[key].Name
+		keysByName[name] = append(keysByName[name], key)
+	}
+
+	dependents := map[string][]VersionDependent{}
+	for _, dir := range sortedKeys(lockfile.Importers) {
+		importer := lockfile.Importers[dir]
+		for _, name := range sortedKeys(importer.Dependencies) {
+			if dependency := importer.Dependencies[name]; dependency.Package != "" {
+				dependents[dependency.Package] = append(dependents[dependency.Package], VersionDependent{Workspace: dir, Range: dependency.Specifier})
+			}
+		}
+	}
+	for _, key := range sortedKeys(lockfile.Packages) {
+		pkg := lockfile.Packages[key]
+		for _, dependencies := range []map[string]string{pkg.Dependencies, pkg.OptionalDependencies} {
+			for _, name := range sortedKeys(dependencies) {
+				dependency := dependencies[name]
+				dependents[dependency] = append(dependents[dependency], VersionDependent{Package: key, Range: pkg.DependencyRanges[name]})
+			}
+		}
+	}
+
+	var duplicates []DuplicatePackage
+	for _, name := range sortedKeys(keysByName) {
+		keys := keysByName[name]
+		if len(keys) < 2 {
+			continue
+		}
+		duplicate := DuplicatePackage{Name: name}
+		for _, key := range keys {
+			pkg := lockfile.Packages[key]
+			copies := len(pkg.Paths)
+			if copies == 0 {
+				copies = 1
+			}
+			duplicate.Versions = append(duplicate.Versions, DuplicateVersion{Version: pkg.Version, Package: key, Copies: copies, Dependents: dependents[key]})
+			duplicate.Copies += copies
+		}
+		sort.SliceStable(duplicate.Versions, func(i, j int) bool {
+			return compareVersions(duplicate.Versions[i].Version, duplicate.Versions[j].Version) < 0
+		})
+		duplicate.Suggested = suggestVersion(duplicate.Versions)
+		duplicates = append(duplicates, duplicate)
+	}
+	return duplicates
+}
+
+// suggestVersion returns the highest version satisfying the range of every dependent
+func suggestVersion(versions []DuplicateVersion) string {
+	var ranges []string
+	for _, version := range versions {
+		for _, dependent := range version.Dependents {
+			if dependent.Range == "" {
+				return ""
+			}
+			ranges = append(ranges, dependent.Range)
+		}
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		satisfied := true
+		for _, versionRange := range ranges {
+			if !versionSatisfies(versionRange, versions[i].Version) {
+				satisfied = false
+				break
+			}
+		}
+		if satisfied {
+			return versions[i].Version
+		}
+	}
+	return ""
+}
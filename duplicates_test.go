@@ -0,0 +1,60 @@
+package packagemanager
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+const duplicatesNpmLockfile = `{
+	"lockfileVersion": 3,
+	"packages": {
+		"": {"dependencies": {"react": "^18.3.0", "b": "^1.0.0", "c": "^1.0.0", "d": "^1.0.0", "lodash": "^4.17.0"}},
+		"node_modules/b": {"version": "1.0.0", "dependencies": {"react": "^18.2.0"}},
+		"node_modules/b/node_modules/react": {"version": "18.2.0"},
+		"node_modules/c": {"version": "1.0.0", "dependencies": {"react": "^18.0.0"}},
+		"node_modules/c/node_modules/react": {"version": "18.2.0"},
+		"node_modules/d": {"version": "1.0.0", "dependencies": {"lodash": "^3.10.0"}},
+		"node_modules/d/node_modules/lodash": {"version": "3.10.1"},
+		"node_modules/lodash": {"version": "4.17.21"},
+		"node_modules/react": {"version": "18.3.1"}
+	}
+}`
+
+func Test_FindDuplicates(t *testing.T) {
+	lockfile, err := nodejsNpm.UnmarshalLockfile([]byte(duplicatesNpmLockfile))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, FindDuplicates(lockfile), []DuplicatePackage{
+		{
+			Name: "lodash",
+			Versions: []DuplicateVersion{
+				{Version: "3.10.1", Package: "lodash@3.10.1", Copies: 1, Dependents: []VersionDependent{{Package: "d@1.0.0", Range: "^3.10.0"}}},
+				{Version: "4.17.21", Package: "lodash@4.17.21", Copies: 1, Dependents: []VersionDependent{{Workspace: ".", Range: "^4.17.0"}}},
+			},
+			Copies: 2,
+		},
+		{
+			Name: "react",
+			Versions: []DuplicateVersion{
+				{Version: "18.2.0", Package: "react@18.2.0", Copies: 2, Dependents: []VersionDependent{{Package: "b@1.0.0", Range: "^18.2.0"}, {Package: "c@1.0.0", Range: "^18.0.0"}}},
+				{Version: "18.3.1", Package: "react@18.3.1", Copies: 1, Dependents: []VersionDependent{{Workspace: ".", Range: "^18.3.0"}}},
+			},
+			Copies:    3,
+			Suggested: "18.3.1",
+		},
+	})
+
+	t.Run("no duplicates", func(t *testing.T) {
+		assert.Equal(t, len(FindDuplicates(readLockfileFixture(t, nodejsBerry, "berry.lock"))), 0)
+	})
+
+	t.Run("unknown ranges", func(t *testing.T) {
+		lockfile := readLockfileFixture(t, nodejsPnpm, "pnpm-v9.yaml")
+		lockfile.Packages["js-tokens@3.0.2"] = &LockfilePackage{Name: "js-tokens", Version: "3.0.2"}
+		lockfile.Importers["."].Dependencies["js-tokens"] = LockfileDependency{Specifier: "^3.0.0", Version: "3.0.2", Package: "js-tokens@3.0.2"}
+		duplicates := FindDuplicates(lockfile)
+		assert.Equal(t, len(duplicates), 1)
+		assert.Equal(t, duplicates[0].Versions[1].Dependents[0], VersionDependent{Package: "loose-envify@1.4.0"})
+		assert.Equal(t, duplicates[0].Suggested, "")
+	})
+}
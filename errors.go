@@ -0,0 +1,71 @@
+package packagemanager
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+var (
+	// ErrNoPackageManager is returned when no package manager could be detected for a project.
+	ErrNoPackageManager = errors.New("we did not detect an in-use package manager for your project")
+
+	// ErrNoWorkspaces is returned when a project doesn't define any workspace.
+	ErrNoWorkspaces = errors.New("no workspaces found")
+
+	// ErrIntegrityMismatch is returned when a file doesn't match its expected integrity hash.
+	ErrIntegrityMismatch = errors.New("integrity mismatch")
+
+	// ErrUnknownWorkspace is returned when a workspace: range references a package that is not a workspace of the project.
+	ErrUnknownWorkspace = errors.New("unknown workspace")
+
+	// ErrPrivateWorkspace is returned when a published package depends on a private workspace.
+	ErrPrivateWorkspace = errors.New("private workspace")
+)
+
+// UnsupportedConfigError is returned when a project uses a package manager
+// configuration that we don't know how to handle.
+type UnsupportedConfigError struct {
+	// The name of the package manager that was configured.
+	Manager string
+	// Why the configuration is not supported.
+	Reason string
+}
+
+func (e *UnsupportedConfigError) Error() string {
+	return fmt.Sprintf("unsupported %s configuration: %s", e.Manager, e.Reason)
+}
+
+// ParseError is returned when a file or value can't be parsed.
+type ParseError struct {
+	// The file being parsed.
+	File string
+	// The line at which the error occurred, 0 when unknown.
+	Line int
+	// The underlying error.
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.File, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+var yamlErrorLineRegex = regexp.MustCompile(`line (\d+):`)
+
+// newYamlParseError wraps an error returned by the yaml decoder, retrieving the
+// line number from the error message when available.
+func newYamlParseError(file string, err error) *ParseError {
+	line := 0
+	if match := yamlErrorLineRegex.FindStringSubmatch(err.Error()); match != nil {
+		line, _ = strconv.Atoi(match[1])
+	}
+	return &ParseError{File: file, Line: line, Err: err}
+}
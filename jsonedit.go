@@ -0,0 +1,186 @@
+package packagemanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// marshalJSONValue encodes value as json without escaping html characters
+// which are common in dependency ranges ("<2.0.0", ">=1 <2").
+func marshalJSONValue(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// setTopLevelJSONField sets key to value in the top level object of content.
+// Unlike a decode/encode round trip this keeps the formatting and the order of
+// the existing keys untouched, which is what users expect when we edit their
+// package.json. A missing key is appended at the end of the object.
+func setTopLevelJSONField(content []byte, key string, value interface{}) ([]byte, error) {
+	return setJSONField(content, []string{key}, value)
+}
+
+// setJSONField is setTopLevelJSONField for the nested field at keys
+// ("dependencies", "react"). Missing objects along the way are created.
+func setJSONField(content []byte, keys []string, value interface{}) ([]byte, error) {
+	key := keys[0]
+	// the value of key when it is missing
+	memberValue := value
+	for i := len(keys) - 1; i > 0; i-- {
+		memberValue = map[string]interface{}{keys[i]: memberValue}
+	}
+	encodedValue, err := marshalJSONValue(memberValue)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateJSON(content); err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(content))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("expected a json object")
+	}
+	objectStart := dec.InputOffset()
+	lastValueEnd := int64(-1)
+	indent := "  "
+
+	for dec.More() {
+		keyStart := dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if lastValueEnd < 0 {
+			indent = lastLineIndent(content[objectStart:keyStart])
+		}
+		keyEnd := dec.InputOffset()
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		lastValueEnd = dec.InputOffset()
+		if tok != key {
+			continue
+		}
+		valueStart := keyEnd
+		for valueStart < lastValueEnd && bytes.IndexByte([]byte(" \t\r\n:"), content[valueStart]) >= 0 {
+			valueStart++
+		}
+		if len(keys) > 1 {
+			nested, err := setJSONField(content[valueStart:lastValueEnd], keys[1:], value)
+			if err != nil {
+				return nil, err
+			}
+			encodedValue = nested
+		}
+		return concatBytes(content[:valueStart], encodedValue, content[lastValueEnd:]), nil
+	}
+
+	encodedKey, err := marshalJSONValue(key)
+	if err != nil {
+		return nil, err
+	}
+	member := concatBytes([]byte("\n"+indent), encodedKey, []byte(": "), encodedValue)
+	if lastValueEnd < 0 {
+		return concatBytes(content[:objectStart], member, []byte("\n"), content[objectStart:]), nil
+	}
+	return concatBytes(content[:lastValueEnd], []byte(","), member, content[lastValueEnd:]), nil
+}
+
+// validateJSON returns the syntax error of content. The json field editors read
+// content token by token and would otherwise accept truncated documents.
+func validateJSON(content []byte) error {
+	var raw json.RawMessage
+	return json.Unmarshal(content, &raw)
+}
+
+// lastLineIndent returns the leading whitespace of the last line in whitespace
+func lastLineIndent(whitespace []byte) string {
+	if i := bytes.LastIndexByte(whitespace, '\n'); i >= 0 {
+		return string(bytes.Trim(whitespace[i+1:], "\r\n"))
+	}
+	return "  "
+}
+
+func concatBytes(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// deleteJSONField removes the nested field at keys ("pnpm", "patchedDependencies") from content,
+// keeping the formatting of the other fields. A missing field leaves content unchanged.
+func deleteJSONField(content []byte, keys []string) ([]byte, error) {
+	if err := validateJSON(content); err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(content))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("expected a json object")
+	}
+	objectStart := dec.InputOffset()
+	previousValueEnd := int64(-1)
+
+	for dec.More() {
+		keyStart := dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		keyEnd := dec.InputOffset()
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		valueEnd := dec.InputOffset()
+		if tok != keys[0] {
+			previousValueEnd = valueEnd
+			continue
+		}
+		if len(keys) > 1 {
+			valueStart := skipJSONSpace(content, keyEnd, " \t\r\n:")
+			nested, err := deleteJSONField(content[valueStart:valueEnd], keys[1:])
+			if err != nil {
+				return nil, err
+			}
+			return concatBytes(content[:valueStart], nested, content[valueEnd:]), nil
+		}
+		if previousValueEnd >= 0 {
+			// the comma after the previous member goes away with the member
+			return concatBytes(content[:previousValueEnd], content[valueEnd:]), nil
+		}
+		next := skipJSONSpace(content, valueEnd, " \t\r\n")
+		if next >= int64(len(content)) {
+			return nil, fmt.Errorf("unexpected end of json object")
+		}
+		if content[next] == '}' {
+			return concatBytes(content[:objectStart], content[next:]), nil
+		}
+		// the first member goes away with its comma, up to the next member
+		keyStart = skipJSONSpace(content, keyStart, " \t\r\n")
+		next = skipJSONSpace(content, next+1, " \t\r\n")
+		return concatBytes(content[:keyStart], content[next:]), nil
+	}
+	return content, nil
+}
+
+// skipJSONSpace returns the offset of the first byte of content from offset not in chars
+func skipJSONSpace(content []byte, offset int64, chars string) int64 {
+	for offset < int64(len(content)) && bytes.IndexByte([]byte(chars), content[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
@@ -0,0 +1,50 @@
+package packagemanager
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func Test_setJSONField(t *testing.T) {
+	content := []byte("{\n  \"name\": \"a\",\n  \"dependencies\": {\n    \"react\": \"^17.0.0\"\n  }\n}\n")
+	updated, err := setJSONField(content, []string{"dependencies", "react"}, "^18.2.0")
+	assert.NilError(t, err)
+	assert.Equal(t, string(updated), "{\n  \"name\": \"a\",\n  \"dependencies\": {\n    \"react\": \"^18.2.0\"\n  }\n}\n")
+
+	updated, err = setJSONField(updated, []string{"dependencies", "vue"}, "^3.0.0")
+	assert.NilError(t, err)
+	assert.Equal(t, string(updated), "{\n  \"name\": \"a\",\n  \"dependencies\": {\n    \"react\": \"^18.2.0\",\n    \"vue\": \"^3.0.0\"\n  }\n}\n")
+
+	updated, err = setJSONField(updated, []string{"devDependencies", "vite"}, "^5.0.0")
+	assert.NilError(t, err)
+	assert.Equal(t, string(updated), "{\n  \"name\": \"a\",\n  \"dependencies\": {\n    \"react\": \"^18.2.0\",\n    \"vue\": \"^3.0.0\"\n  },\n  \"devDependencies\": {\"vite\":\"^5.0.0\"}\n}\n")
+}
+
+func Test_deleteJSONField(t *testing.T) {
+	content := []byte("{\n  \"name\": \"a\",\n  \"workspaces\": [\"packages/*\"],\n  \"pnpm\": {\n    \"patchedDependencies\": {}\n  }\n}\n")
+	updated, err := deleteJSONField(content, []string{"workspaces"})
+	assert.NilError(t, err)
+	assert.Equal(t, string(updated), "{\n  \"name\": \"a\",\n  \"pnpm\": {\n    \"patchedDependencies\": {}\n  }\n}\n")
+
+	updated, err = deleteJSONField(updated, []string{"pnpm", "patchedDependencies"})
+	assert.NilError(t, err)
+	assert.Equal(t, string(updated), "{\n  \"name\": \"a\",\n  \"pnpm\": {}\n}\n")
+
+	updated, err = deleteJSONField(updated, []string{"name"})
+	assert.NilError(t, err)
+	assert.Equal(t, string(updated), "{\n  \"pnpm\": {}\n}\n")
+
+	unchanged, err := deleteJSONField(updated, []string{"version"})
+	assert.NilError(t, err)
+	assert.Equal(t, string(unchanged), string(updated))
+
+	for _, content := range []string{`{"a":1`, `{"a":1,`, `{"a":{"b":1}`, `{"a":1} trailing`, `[1]`, ``} {
+		t.Run(content, func(t *testing.T) {
+			_, err := deleteJSONField([]byte(content), []string{"a"})
+			assert.Assert(t, err != nil)
+			_, err = setJSONField([]byte(content), []string{"a"}, 2)
+			assert.Assert(t, err != nil)
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package packagemanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// PackageLicense is the license of an installed package.
+type PackageLicense struct {
+	Name    string
+	Version string
+	// The key of the package in Lockfile.Packages.
+	Package string
+	// The directory of the installed package relative to the project root, empty when it is not installed.
+	Dir string
+	// The SPDX expression of the license, empty when unknown.
+	License string
+	// Where the license was found: "package.json", the path of a license file or "lockfile".
+	Source string
+}
+
+// LicensePolicy lists the licenses accepted and refused for a project, as SPDX identifiers.
+type LicensePolicy struct {
+	// When not empty, packages whose license is not allowed are reported.
+	Allow []string
+	Deny  []string
+}
+
+// LicenseReport is the license inventory of a workspace.
+type LicenseReport struct {
+	// The packages the workspace depends on, directly or not, sorted by name and version.
+	Packages []PackageLicense
+	// The packages that can't be used without accepting a denied license.
+	// Like Packages, the lists of issues are sorted by name and version.
+	Denied []PackageLicense
+	// The packages that can't be used with the allowed licenses only.
+	NotAllowed []PackageLicense
+	// The packages whose license could not be found.
+	Unknown []PackageLicense
+}
+
+// licenseFilePrefixes are the lower case prefixes of license file names
+var licenseFilePrefixes = []string{"license", "licence", "copying"}
+
+// Licenses returns the license inventory of the workspace at dir ("." for the root) of the project
+// in projectDirectory, checked against policy. The packages are the workspace dependencies recorded
+// in the lockfile, their license is read from their installed package.json (license or legacy
+// licenses fields) or license files, in PackageDir and in the pnpm virtual store.
+// Licenses are normalized to SPDX expressions, an expression is accepted when one of its
+// OR alternatives only uses accepted licenses.
+func (pm PackageManager) Licenses(projectDirectory string, dir string, policy LicensePolicy) (*LicenseReport, error) {
+	return pm.LicensesFS(os.DirFS(projectDirectory), dir, policy)
+}
+
+// LicensesFS is Licenses for the project stored at the root of fsys.
+func (pm PackageManager) LicensesFS(fsys fs.FS, dir string, policy LicensePolicy) (*LicenseReport, error) {
+	lockfile, err := pm.ReadLockfileFS(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return pm.lockfileLicenses(fsys, lockfile, dir, policy)
+}
+
+// lockfileLicenses is LicensesFS for a lockfile already read from fsys
+func (pm PackageManager) lockfileLicenses(fsys fs.FS, lockfile *Lockfile, dir string, policy LicensePolicy) (*LicenseReport, error) {
+	if lockfile == nil {
+		return nil, &UnsupportedConfigError{Manager: pm.Name, Reason: "reading the lockfile is not supported"}
+	}
+	dir = path.Clean(dir)
+	if _, ok := lockfile.Importers[dir]; !ok {
+		return nil, fmt.Errorf("%s: %w", dir, ErrUnknownWorkspace)
+	}
+	allowed := normalizeLicenseIDs(policy.Allow)
+	denied := normalizeLicenseIDs(policy.Deny)
+
+	report := &LicenseReport{}
+	for _, key := range lockfile.closure(dir) {
+		pkg, ok := lockfile.Packages[key]
+		if !ok {
+			continue
+		}
+		license := PackageLicense{Name: pkg.Name, Version: pkg.Version, Package: key}
+		var err error
+		if license.Dir, err = pm.installedPackageDir(fsys, pkg.Name, pkg.Version, pkg.Paths...); err != nil {
+			return nil, err
+		}
+		if license.Dir != "" {
+			if license.License, license.Source, err = readInstalledLicense(fsys, license.Dir); err != nil {
+				return nil, err
+			}
+		}
+		if license.License == "" && pkg.License != "" {
+			license.License, license.Source = NormalizeLicense(pkg.License), "lockfile"
+		}
+		report.Packages = append(report.Packages, license)
+
+		if license.License == "" {
+			report.Unknown = append(report.Unknown, license)
+			continue
+		}
+		expression, err := parseSPDXExpression(license.License)
+		if err != nil {
+			expression = &spdxExpression{id: license.License}
+		}
+		if !expression.satisfies(func(id string) bool { return !denied[id] }) {
+			report.Denied = append(report.Denied, license)
+		} else if len(allowed) > 0 && !expression.satisfies(func(id string) bool { return allowed[id] }) {
+			report.NotAllowed = append(report.NotAllowed, license)
+		}
+	}
+	for _, licenses := range [][]PackageLicense{report.Packages, report.Denied, report.NotAllowed, report.Unknown} {
+		sortPackageLicenses(licenses)
+	}
+	return report, nil
+}
+
+// sortPackageLicenses sorts licenses by package name and version
+func sortPackageLicenses(licenses []PackageLicense) {
+	sort.SliceStable(licenses, func(i, j int) bool {
+		a, b := licenses[i], licenses[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return compareVersions(a.Version, b.Version) < 0
+	})
+}
+
+// readInstalledLicense returns the SPDX expression of the package installed at dir and where it was found
+func readInstalledLicense(fsys fs.FS, dir string) (license string, source string, err error) {
+	manifest := path.Join(dir, "package.json")
+	content, err := fs.ReadFile(fsys, manifest)
+	if err != nil {
+		return "", "", err
+	}
+	var fields struct {
+		License  interface{} `json:"license"`
+		Licenses interface{} `json:"licenses"`
+	}
+	if err := json.Unmarshal(content, &fields); err != nil {
+		return "", "", &ParseError{File: manifest, Line: jsonErrorLine(content, err), Err: err}
+	}
+
+	names := licenseNames(fields.License)
+	if len(names) == 0 {
+		names = licenseNames(fields.Licenses)
+	}
+	var files []string
+	if len(names) == 1 {
+		if file, ok := strings.CutPrefix(names[0], "SEE LICENSE IN "); ok {
+			names, files = nil, []string{path.Join(dir, strings.TrimSpace(file))}
+		}
+	}
+	if len(names) > 0 {
+		for i, name := range names {
+			names[i] = NormalizeLicense(name)
+			if len(names) > 1 && strings.Contains(names[i], " ") {
+				names[i] = "(" + names[i] + ")"
+			}
+		}
+		return strings.Join(names, " OR "), "package.json", nil
+	}
+
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return "", "", err
+	}
+	for _, entry := range entries {
+		lower := strings.ToLower(entry.Name())
+		for _, prefix := range licenseFilePrefixes {
+			if !entry.IsDir() && strings.HasPrefix(lower, prefix) {
+				files = append(files, path.Join(dir, entry.Name()))
+				break
+			}
+		}
+	}
+	for _, file := range files {
+		text, err := fs.ReadFile(fsys, file)
+		// SEE LICENSE IN may point outside of the file system
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid) {
+			continue
+		} else if err != nil {
+			return "", "", err
+		}
+		if id := detectLicenseText(string(text)); id != "" {
+			return id, file, nil
+		}
+	}
+	return "", "", nil
+}
+
+// licenseNames returns the licenses of a license or licenses package.json field, which may be a string,
+// a {"type": ...} object or a list of those
+func licenseNames(field interface{}) []string {
+	switch value := field.(type) {
+	case string:
+		if strings.TrimSpace(value) != "" {
+			return []string{strings.TrimSpace(value)}
+		}
+	case map[string]interface{}:
+		return licenseNames(value["type"])
+	case []interface{}:
+		var names []string
+		for _, item := range value {
+			names = append(names, licenseNames(item)...)
+		}
+		return names
+	}
+	return nil
+}
+
+// normalizeLicenseIDs returns the set of the SPDX identifiers of licenses
+func normalizeLicenseIDs(licenses []string) map[string]bool {
+	ids := map[string]bool{}
+	for _, license := range licenses {
+		ids[NormalizeLicense(license)] = true
+	}
+	return ids
+}
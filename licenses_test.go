@@ -0,0 +1,125 @@
+package packagemanager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/v3/assert"
+)
+
+func Test_NormalizeLicense(t *testing.T) {
+	for license, want := range map[string]string{
+		"mit":                                  "MIT",
+		"MIT License":                          "MIT",
+		"Apache 2.0":                           "Apache-2.0",
+		"(mit OR apache-2.0)":                  "MIT OR Apache-2.0",
+		"(MIT AND GPL-3.0)":                    "MIT AND GPL-3.0-only",
+		"(MIT OR ISC) AND (BSD-3-Clause)":      "(MIT OR ISC) AND (BSD-3-Clause)",
+		"GPL-2.0 WITH Classpath-exception-2.0": "GPL-2.0-only WITH Classpath-exception-2.0",
+		"UNLICENSED":                           "UNLICENSED",
+		"":                                     "",
+	} {
+		assert.Equal(t, NormalizeLicense(license), want, license)
+	}
+}
+
+func Test_isSPDXExpression(t *testing.T) {
+	for license, want := range map[string]bool{
+		"MIT":                         true,
+		"(MIT OR Apache-2.0) AND ISC": true,
+		"LicenseRef-Acme":             true,
+		"GPL-2.0-only WITH Classpath-exception-2.0": true,
+		"mit":                false,
+		"MIT AND Commercial": false,
+		"UNLICENSED":         false,
+		"(MIT":               false,
+		"":                   false,
+	} {
+		assert.Equal(t, isSPDXExpression(license), want, license)
+	}
+}
+
+func Test_Licenses(t *testing.T) {
+	lockfile, err := os.ReadFile("testdata/lockfiles/pnpm-v9.yaml")
+	assert.NilError(t, err)
+	store := "node_modules/.pnpm/"
+	fsys := fstest.MapFS{
+		"pnpm-lock.yaml":                   {Data: lockfile},
+		"package.json":                     {Data: []byte(`{}`)},
+		"node_modules/lodash/package.json": {Data: []byte(`{"name": "lodash", "version": "4.17.21", "license": "MIT License"}`)},
+		// a hoisted copy of another version
+		"node_modules/typescript/package.json":                              {Data: []byte(`{"name": "typescript", "version": "5.0.0", "license": "Apache-2.0"}`)},
+		store + "react@18.2.0/node_modules/react/package.json":              {Data: []byte(`{"name": "react", "version": "18.2.0", "license": "(MIT AND GPL-3.0)"}`)},
+		store + "loose-envify@1.4.0/node_modules/loose-envify/package.json": {Data: []byte(`{"name": "loose-envify", "version": "1.4.0", "licenses": [{"type": "MIT"}, {"type": "Apache 2.0"}]}`)},
+		store + "js-tokens@4.0.0/node_modules/js-tokens/package.json":       {Data: []byte(`{"name": "js-tokens", "version": "4.0.0"}`)},
+		store + "js-tokens@4.0.0/node_modules/js-tokens/LICENSE.md":         {Data: []byte("Redistribution and use in source and binary forms, with or without modification...\n3. Neither the name of the copyright holder...")},
+	}
+	policy := LicensePolicy{Allow: []string{"mit", "ISC", "Apache-2.0"}, Deny: []string{"BSD-3-Clause"}}
+
+	report, err := nodejsPnpm.LicensesFS(fsys, ".", policy)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, report.Packages, []PackageLicense{
+		{Name: "lodash", Version: "4.17.21", Package: "lodash@4.17.21", Dir: "node_modules/lodash", License: "MIT", Source: "package.json"},
+		{Name: "typescript", Version: "5.1.6", Package: "typescript@5.1.6"},
+	})
+	assert.DeepEqual(t, report.Unknown, []PackageLicense{report.Packages[1]})
+	assert.Equal(t, len(report.Denied)+len(report.NotAllowed), 0)
+
+	report, err = nodejsPnpm.LicensesFS(fsys, "packages/ui", policy)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, report.Packages, []PackageLicense{
+		{Name: "js-tokens", Version: "4.0.0", Package: "js-tokens@4.0.0", Dir: store + "js-tokens@4.0.0/node_modules/js-tokens", License: "BSD-3-Clause", Source: store + "js-tokens@4.0.0/node_modules/js-tokens/LICENSE.md"},
+		{Name: "loose-envify", Version: "1.4.0", Package: "loose-envify@1.4.0", Dir: store + "loose-envify@1.4.0/node_modules/loose-envify", License: "MIT OR Apache-2.0", Source: "package.json"},
+		{Name: "react", Version: "18.2.0", Package: "react@18.2.0", Dir: store + "react@18.2.0/node_modules/react", License: "MIT AND GPL-3.0-only", Source: "package.json"},
+	})
+	assert.DeepEqual(t, report.Denied, []PackageLicense{report.Packages[0]})
+	assert.DeepEqual(t, report.NotAllowed, []PackageLicense{report.Packages[2]})
+	assert.Equal(t, len(report.Unknown), 0)
+
+	_, err = nodejsPnpm.LicensesFS(fsys, "packages/missing", policy)
+	assert.Assert(t, errors.Is(err, ErrUnknownWorkspace))
+
+	t.Run("sorted issues", func(t *testing.T) {
+		// the key of a-b sorts before the one of a
+		lockfile := "lockfileVersion: '9.0'\nimporters:\n  .:\n    dependencies:\n" +
+			"      a:\n        specifier: 1.0.0\n        version: 1.0.0\n" +
+			"      a-b:\n        specifier: 1.0.0\n        version: 1.0.0\n" +
+			"packages:\n  a@1.0.0:\n    resolution: {integrity: sha512-a}\n  a-b@1.0.0:\n    resolution: {integrity: sha512-b}\n" +
+			"snapshots:\n  a@1.0.0: {}\n  a-b@1.0.0: {}\n"
+		report, err := nodejsPnpm.LicensesFS(fstest.MapFS{
+			"pnpm-lock.yaml":                {Data: []byte(lockfile)},
+			"package.json":                  {Data: []byte(`{}`)},
+			"node_modules/a/package.json":   {Data: []byte(`{"name": "a", "version": "1.0.0", "license": "BSD-3-Clause"}`)},
+			"node_modules/a-b/package.json": {Data: []byte(`{"name": "a-b", "version": "1.0.0", "license": "BSD-3-Clause"}`)},
+		}, ".", policy)
+		assert.NilError(t, err)
+		assert.Equal(t, len(report.Denied), 2)
+		assert.DeepEqual(t, report.Denied, report.Packages)
+	})
+
+	t.Run("license file outside the project", func(t *testing.T) {
+		// os.DirFS, unlike fstest.MapFS, rejects paths escaping its root with fs.ErrInvalid
+		root := t.TempDir()
+		assert.NilError(t, os.MkdirAll(filepath.Join(root, "node_modules", "pkg"), 0o755))
+		assert.NilError(t, os.WriteFile(filepath.Join(root, "node_modules", "pkg", "package.json"), []byte(`{"license": "SEE LICENSE IN ../../../LICENSE"}`), 0o644))
+		assert.NilError(t, os.WriteFile(filepath.Join(root, "node_modules", "pkg", "LICENSE"), []byte("Permission is hereby granted, free of charge, to any person obtaining a copy"), 0o644))
+		license, source, err := readInstalledLicense(os.DirFS(root), "node_modules/pkg")
+		assert.NilError(t, err)
+		assert.Equal(t, license+" "+source, "MIT node_modules/pkg/LICENSE")
+	})
+
+	t.Run("npm lockfile licenses", func(t *testing.T) {
+		lockfile, err := os.ReadFile("testdata/lockfiles/npm-v3.json")
+		assert.NilError(t, err)
+		report, err := nodejsNpm.LicensesFS(fstest.MapFS{
+			"package-lock.json":        {Data: lockfile},
+			"package.json":             {Data: []byte(`{"workspaces": ["packages/*"]}`)},
+			"packages/ui/package.json": {Data: []byte(`{"name": "ui"}`)},
+		}, ".", LicensePolicy{Allow: []string{"MIT"}})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, report.NotAllowed, []PackageLicense{{Name: "typescript", Version: "5.1.6", Package: "typescript@5.1.6", License: "Apache-2.0", Source: "lockfile"}})
+	})
+}
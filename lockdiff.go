@@ -0,0 +1,236 @@
+package packagemanager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+// PackageChangeKind tells how a package changed between two lockfiles.
+type PackageChangeKind string
+
+const (
+	PackageAdded      PackageChangeKind = "added"
+	PackageRemoved    PackageChangeKind = "removed"
+	PackageUpgraded   PackageChangeKind = "upgraded"
+	PackageDowngraded PackageChangeKind = "downgraded"
+	// PackageIntegrityChanged is a package whose tarball changed while its version didn't,
+	// which is unexpected from a registry and should be reviewed as a supply-chain risk.
+	PackageIntegrityChanged PackageChangeKind = "integrity changed"
+)
+
+// PackageChange is a package that changed between two lockfiles.
+type PackageChange struct {
+	Name string
+	Kind PackageChangeKind
+	// The version in the old lockfile, empty for added packages.
+	From string
+	// The version in the new lockfile, empty for removed packages.
+	To string
+	// The integrity (or berry checksum) of the package in both lockfiles, only set for integrity changes.
+	FromIntegrity string
+	ToIntegrity   string
+	// The directories of the workspaces depending on the package, directly or not, in either lockfile.
+	// Always empty for lockfiles that don't record workspaces (yarn classic).
+	Workspaces []string
+}
+
+// LockfileDiff is the semantic difference between two lockfiles.
+type LockfileDiff struct {
+	// The changes sorted by package name.
+	Changes []PackageChange
+}
+
+// DiffLockfiles compares the packages resolved by two lockfiles written by the same package manager.
+// A package resolved to several versions is compared version by version, pairing the highest
+// versions that are only in one lockfile with each other.
+func DiffLockfiles(from *Lockfile, to *Lockfile) (*LockfileDiff, error) {
+	if from.Manager != "" && to.Manager != "" && from.Manager != to.Manager {
+		return nil, fmt.Errorf("can't compare a %s lockfile with a %s lockfile", from.Manager, to.Manager)
+	}
+	fromVersions := lockfileVersionsByName(from)
+	toVersions := lockfileVersionsByName(to)
+	fromWorkspaces := lockfilePackageWorkspaces(from)
+	toWorkspaces := lockfilePackageWorkspaces(to)
+
+	names := map[string]bool{}
+	for name := range fromVersions {
+		names[name] = true
+	}
+	for name := range toVersions {
+		names[name] = true
+	}
+
+	diff := &LockfileDiff{}
+	for _, name := range sortedKeys(names) {
+		var removed, added []string
+		for _, version := range fromVersions[name] {
+			if !contains(toVersions[name], version) {
+				removed = append(removed, version)
+			}
+		}
+		for _, version := range toVersions[name] {
+			if !contains(fromVersions[name], version) {
+				added = append(added, version)
+				continue
+			}
+			key := packageKey(name, version)
+			fromIntegrity, toIntegrity := from.Packages[key].integrity(), to.Packages[key].integrity()
+			if fromIntegrity != "" && toIntegrity != "" && fromIntegrity != toIntegrity {
+				diff.Changes = append(diff.Changes, PackageChange{
+					Name: name, Kind: PackageIntegrityChanged, From: version, To: version,
+					FromIntegrity: fromIntegrity, ToIntegrity: toIntegrity,
+					Workspaces: mergeWorkspaces(fromWorkspaces[key], toWorkspaces[key]),
+				})
+			}
+		}
+
+		var changes []PackageChange
+		for len(removed) > 0 && len(added) > 0 {
+			fromVersion, toVersion := removed[len(removed)-1], added[len(added)-1]
+			removed, added = removed[:len(removed)-1], added[:len(added)-1]
+			kind := PackageUpgraded
+			if compareVersions(fromVersion, toVersion) > 0 {
+				kind = PackageDowngraded
+			}
+			changes = append(changes, PackageChange{
+				Name: name, Kind: kind, From: fromVersion, To: toVersion,
+				Workspaces: mergeWorkspaces(fromWorkspaces[packageKey(name, fromVersion)], toWorkspaces[packageKey(name, toVersion)]),
+			})
+		}
+		for _, version := range removed {
+			changes = append(changes, PackageChange{Name: name, Kind: PackageRemoved, From: version, Workspaces: fromWorkspaces[packageKey(name, version)]})
+		}
+		for _, version := range added {
+			changes = append(changes, PackageChange{Name: name, Kind: PackageAdded, To: version, Workspaces: toWorkspaces[packageKey(name, version)]})
+		}
+		sort.SliceStable(changes, func(i, j int) bool {
+			return compareVersions(changes[i].version(), changes[j].version()) < 0
+		})
+		diff.Changes = append(diff.Changes, changes...)
+	}
+	return diff, nil
+}
+
+// version returns the version the change is about: the new version, or the old one for removed packages
+func (c PackageChange) version() string {
+	if c.To != "" {
+		return c.To
+	}
+	return c.From
+}
+
+// Markdown renders the diff as Markdown, suitable for a pull request comment.
+// Integrity changes come first as they deserve the reviewer attention.
+func (d *LockfileDiff) Markdown() string {
+	var b strings.Builder
+	b.WriteString("### Lockfile changes\n\n")
+	if len(d.Changes) == 0 {
+		b.WriteString("No package changes.\n")
+		return b.String()
+	}
+
+	var integrity, others []PackageChange
+	for _, change := range d.Changes {
+		if change.Kind == PackageIntegrityChanged {
+			integrity = append(integrity, change)
+		} else {
+			others = append(others, change)
+		}
+	}
+	if len(integrity) > 0 {
+		b.WriteString("> [!WARNING]\n> The integrity of these packages changed while their version didn't, make sure this is expected.\n\n")
+		b.WriteString("| Package | Version | Old integrity | New integrity | Workspaces |\n|---|---|---|---|---|\n")
+		for _, change := range integrity {
+			fmt.Fprintf(&b, "| %s | %s | `%s` | `%s` | %s |\n", change.Name, change.To, change.FromIntegrity, change.ToIntegrity, markdownWorkspaces(change.Workspaces))
+		}
+		b.WriteString("\n")
+	}
+	if len(others) > 0 {
+		b.WriteString("| Package | Change | From | To | Workspaces |\n|---|---|---|---|---|\n")
+		for _, change := range others {
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n", change.Name, change.Kind, markdownVersion(change.From), markdownVersion(change.To), markdownWorkspaces(change.Workspaces))
+		}
+	}
+	return b.String()
+}
+
+func markdownVersion(version string) string {
+	if version == "" {
+		return "-"
+	}
+	return version
+}
+
+func markdownWorkspaces(workspaces []string) string {
+	if len(workspaces) == 0 {
+		return "-"
+	}
+	quoted := make([]string, len(workspaces))
+	for i, workspace := range workspaces {
+		quoted[i] = "`" + workspace + "`"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// integrity returns the integrity of the package, or its checksum when the lockfile has no integrity (berry)
+func (p *LockfilePackage) integrity() string {
+	if p == nil {
+		return ""
+	}
+	if p.Integrity != "" {
+		return p.Integrity
+	}
+	return p.Checksum
+}
+
+// lockfileVersionsByName returns the versions each package is resolved to, sorted in ascending order
+func lockfileVersionsByName(lockfile *Lockfile) map[string][]string {
+	versions := map[string][]string{}
+	for _, key := range sortedKeys(lockfile.Packages) {
+		pkg := lockfile.Packages[key]
+		versions[pkg.Name] = append(versions[pkg.Name], pkg.Version)
+	}
+	for _, list := range versions {
+		sort.SliceStable(list, func(i, j int) bool { return compareVersions(list[i], list[j]) < 0 })
+	}
+	return versions
+}
+
+// lockfilePackageWorkspaces returns the sorted workspace directories depending on each package key
+func lockfilePackageWorkspaces(lockfile *Lockfile) map[string][]string {
+	workspaces := map[string][]string{}
+	for _, dir := range sortedKeys(lockfile.Importers) {
+		for _, key := range lockfile.closure(dir) {
+			workspaces[key] = append(workspaces[key], dir)
+		}
+	}
+	return workspaces
+}
+
+// mergeWorkspaces returns the sorted union of two sorted workspace lists
+func mergeWorkspaces(a []string, b []string) []string {
+	merged := append([]string{}, a...)
+	for _, workspace := range b {
+		if !contains(merged, workspace) {
+			merged = append(merged, workspace)
+		}
+	}
+	sort.Strings(merged)
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
+}
+
+// compareVersions compares two versions with semver, falling back to string comparison for non semver versions
+func compareVersions(a string, b string) int {
+	va, errA := semver.NewVersion(a)
+	vb, errB := semver.NewVersion(b)
+	if errA == nil && errB == nil {
+		return va.Compare(vb)
+	}
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,74 @@
+package packagemanager
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func Test_DiffLockfiles(t *testing.T) {
+	contents, err := os.ReadFile("testdata/lockfiles/pnpm-v9.yaml")
+	assert.NilError(t, err)
+	from, err := nodejsPnpm.UnmarshalLockfile(contents)
+	assert.NilError(t, err)
+	changed := strings.NewReplacer(
+		"lodash", "lodash-es",
+		"js-tokens@4.0.0", "js-tokens@3.0.2",
+		"js-tokens: 4.0.0", "js-tokens: 3.0.2",
+		"sha512-typescript-5.1.6", "sha512-tampered",
+	).Replace(string(contents))
+	to, err := nodejsPnpm.UnmarshalLockfile([]byte(changed))
+	assert.NilError(t, err)
+
+	diff, err := DiffLockfiles(from, to)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, diff.Changes, []PackageChange{
+		{Name: "js-tokens", Kind: PackageDowngraded, From: "4.0.0", To: "3.0.2", Workspaces: []string{"packages/ui"}},
+		{Name: "lodash", Kind: PackageRemoved, From: "4.17.21", Workspaces: []string{"."}},
+		{Name: "lodash-es", Kind: PackageAdded, To: "4.17.21", Workspaces: []string{"."}},
+		{Name: "typescript", Kind: PackageIntegrityChanged, From: "5.1.6", To: "5.1.6", FromIntegrity: "sha512-typescript-5.1.6", ToIntegrity: "sha512-tampered", Workspaces: []string{"."}},
+	})
+	assert.Equal(t, diff.Markdown(), `### Lockfile changes
+
+> [!WARNING]
+> The integrity of these packages changed while their version didn't, make sure this is expected.
+
+| Package | Version | Old integrity | New integrity | Workspaces |
+|---|---|---|---|---|
+| typescript | 5.1.6 | `+"`sha512-typescript-5.1.6`"+` | `+"`sha512-tampered`"+` | `+"`.`"+` |
+
+| Package | Change | From | To | Workspaces |
+|---|---|---|---|---|
+| js-tokens | downgraded | 4.0.0 | 3.0.2 | `+"`packages/ui`"+` |
+| lodash | removed | 4.17.21 | - | `+"`.`"+` |
+| lodash-es | added | - | 4.17.21 | `+"`.`"+` |
+`)
+
+	diff, err = DiffLockfiles(from, from)
+	assert.NilError(t, err)
+	assert.Equal(t, len(diff.Changes), 0)
+	assert.Equal(t, diff.Markdown(), "### Lockfile changes\n\nNo package changes.\n")
+
+	t.Run("multiple versions", func(t *testing.T) {
+		lockfile := func(versions ...string) *Lockfile {
+			l := newLockfile("")
+			for _, version := range versions {
+				l.Packages[packageKey("debug", version)] = &LockfilePackage{Name: "debug", Version: version}
+			}
+			return l
+		}
+		diff, err := DiffLockfiles(lockfile("2.6.9", "3.2.7", "4.3.4"), lockfile("2.6.9", "4.3.5"))
+		assert.NilError(t, err)
+		assert.DeepEqual(t, diff.Changes, []PackageChange{
+			{Name: "debug", Kind: PackageRemoved, From: "3.2.7"},
+			{Name: "debug", Kind: PackageUpgraded, From: "4.3.4", To: "4.3.5"},
+		})
+	})
+
+	t.Run("different managers", func(t *testing.T) {
+		_, err := DiffLockfiles(from, &Lockfile{Manager: nodejsNpm.Name})
+		assert.ErrorContains(t, err, "can't compare")
+	})
+}
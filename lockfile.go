@@ -0,0 +1,358 @@
+package packagemanager
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/software-t-rex/packageJson"
+)
+
+// Lockfile is the package manager agnostic representation of a lockfile.
+type Lockfile struct {
+	// The Name of the package manager that wrote the lockfile (nodejs-pnpm...).
+	Manager string
+
+	// The lockfile format version as written in the lockfile.
+	Version string
+
+	// The workspaces recorded in the lockfile, keyed by their directory relative
+	// to the project root ("." for the root). Yarn classic doesn't record them,
+	// ReadLockfile infers them from the package.json files.
+	Importers map[string]*LockfileImporter
+
+	// The resolved packages, keyed by "name@version". Packages that can't be keyed
+	// by their version (patched, git or file dependencies) are keyed by their resolution.
+	Packages map[string]*LockfilePackage
+
+	// The package key each "name@range" descriptor resolves to. Yarn lockfiles
+	// are keyed by descriptors, other lockfiles don't record them.
+	Descriptors map[string]string
+}
+
+// LockfileImporter is a workspace recorded in a lockfile.
+type LockfileImporter struct {
+	// The direct dependencies of the workspace, keyed by name.
+	Dependencies map[string]LockfileDependency
+
+	// Inferred tells that the lockfile doesn't record the workspace (yarn classic, npm v1)
+	// and that it was inferred from its package.json.
+	Inferred bool
+}
+
+// LockfileDependency is a direct dependency of a workspace.
+type LockfileDependency struct {
+	// The dependency field declaring it (dependencies, devDependencies, optionalDependencies),
+	// empty when the lockfile doesn't tell.
+	Field string
+
+	// The range declared in package.json when the lockfile was written,
+	// empty when the lockfile doesn't record it.
+	// For inferred importers it is the range of the lockfile descriptor the dependency
+	// resolves with, if any, and the range currently declared for workspace links.
+	Specifier string
+
+	// The resolved version, empty for workspace links.
+	Version string
+
+	// The key of the resolved package in Lockfile.Packages, empty for workspace links.
+	Package string
+
+	// The directory of the linked workspace relative to the project root, empty for packages.
+	Link string
+}
+
+// LockfilePackage is a package resolved in a lockfile.
+type LockfilePackage struct {
+	Name    string
+	Version string
+
+	// Where the package comes from, usually its tarball url.
+	Resolved string
+
+	// The subresource integrity of the tarball (sha512-...), empty when unknown.
+	Integrity string
+
+	// The yarn berry cache checksum, which is not a subresource integrity.
+	Checksum string
+
+	// The resolved dependencies of the package: the key of the dependency in Lockfile.Packages, by name.
+	Dependencies         map[string]string
+	OptionalDependencies map[string]string
+
+	// The ranges the package declares for its dependencies and optional dependencies, by name,
+	// when the lockfile records them (npm, yarn). pnpm only records the resolved versions.
+	DependencyRanges map[string]string
+
+	// The peer dependency ranges declared by the package.
+	PeerDependencies map[string]string
+
+	// Whether the package is only needed by devDependencies, as recorded by the lockfile.
+	Dev bool
+
+	// Whether the package is only needed by optionalDependencies, as recorded by the lockfile.
+	Optional bool
+
+	// The license of the package when the lockfile records it (npm).
+	License string
+
+	// The install locations of the package relative to the project root, when the lockfile records them (npm).
+	Paths []string
+}
+
+// LockfileUnmarshaler is implemented by the Behavior of package managers whose lockfile can be read.
+type LockfileUnmarshaler interface {
+	// UnmarshalLockfile reads the lockfile contents.
+	UnmarshalLockfile(contents []byte) (*Lockfile, error)
+}
+
+// LockfileMarshaler is implemented by the Behavior of package managers whose lockfile can be written.
+type LockfileMarshaler interface {
+	// MarshalLockfile returns the contents of the lockfile, nil when it can't be written.
+	MarshalLockfile(lockfile *Lockfile) ([]byte, error)
+}
+
+func newLockfile(version string) *Lockfile {
+	return &Lockfile{
+		Version:     version,
+		Importers:   map[string]*LockfileImporter{},
+		Packages:    map[string]*LockfilePackage{},
+		Descriptors: map[string]string{},
+	}
+}
+
+// importer returns the importer at dir, creating it if needed
+func (l *Lockfile) importer(dir string) *LockfileImporter {
+	dir = path.Clean(dir)
+	importer, ok := l.Importers[dir]
+	if !ok {
+		importer = &LockfileImporter{Dependencies: map[string]LockfileDependency{}}
+		l.Importers[dir] = importer
+	}
+	return importer
+}
+
+// closure returns the sorted keys of the packages the workspace at dir depends on, directly or not,
+// following the links to sibling workspaces
+func (l *Lockfile) closure(dir string) []string {
+	seen := map[string]bool{}
+	var queue []string
+	for _, importerDir := range l.linkedImporters(dir) {
+		importer := l.Importers[importerDir]
+		for _, name := range sortedKeys(importer.Dependencies) {
+			if dependency := importer.Dependencies[name]; dependency.Link == "" && dependency.Package != "" {
+				queue = append(queue, dependency.Package)
+			}
+		}
+	}
+	for len(queue) > 0 {
+		key := queue[0]
+		queue = queue[1:]
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if pkg, ok := l.Packages[key]; ok {
+			for _, name := range sortedKeys(pkg.Dependencies) {
+				queue = append(queue, pkg.Dependencies[name])
+			}
+			for _, name := range sortedKeys(pkg.OptionalDependencies) {
+				queue = append(queue, pkg.OptionalDependencies[name])
+			}
+		}
+	}
+	return sortedKeys(seen)
+}
+
+// linkedImporters returns the sorted directories of the importer at dir and of the
+// importers it links to, directly or not
+func (l *Lockfile) linkedImporters(dir string) []string {
+	seen := map[string]bool{}
+	queue := []string{dir}
+	for len(queue) > 0 {
+		importerDir := queue[0]
+		queue = queue[1:]
+		importer, ok := l.Importers[importerDir]
+		if !ok || seen[importerDir] {
+			continue
+		}
+		seen[importerDir] = true
+		for _, name := range sortedKeys(importer.Dependencies) {
+			if link := importer.Dependencies[name].Link; link != "" {
+				queue = append(queue, link)
+			}
+		}
+	}
+	return sortedKeys(seen)
+}
+
+// packageKey returns the key of a package in Lockfile.Packages
+func packageKey(name string, version string) string {
+	return name + "@" + version
+}
+
+// Resolve returns the package a "name@range" descriptor resolves to, when recorded.
+func (l *Lockfile) Resolve(descriptor string) (*LockfilePackage, bool) {
+	key, ok := l.Descriptors[descriptor]
+	if !ok {
+		return nil, false
+	}
+	pkg, ok := l.Packages[key]
+	return pkg, ok
+}
+
+// stripNpmProtocol removes the npm: protocol of registry ranges, as users don't write it.
+// Aliases (npm:name@range) are left untouched.
+func stripNpmProtocol(versionRange string) string {
+	rest, found := strings.CutPrefix(versionRange, "npm:")
+	if !found || rest == "" || strings.Contains(rest[1:], "@") {
+		return versionRange
+	}
+	return rest
+}
+
+// registryTarballURL returns the url of a package tarball on the npm registry
+func registryTarballURL(name string, version string) string {
+	return "https://registry.npmjs.org/" + name + "/-/" + path.Base(name) + "-" + version + ".tgz"
+}
+
+// isRegistryTarballURL tells if resolved is the tarball of the package on the npm registry or its yarn mirror
+func isRegistryTarballURL(name string, version string, resolved string) bool {
+	resolved, _, _ = strings.Cut(resolved, "#")
+	resolved = strings.Replace(resolved, "https://registry.yarnpkg.com/", "https://registry.npmjs.org/", 1)
+	return resolved == registryTarballURL(name, version)
+}
+
+// yarnSha1Integrity returns the integrity of the sha1 hash yarn classic appends to resolved urls,
+// empty if there is none
+func yarnSha1Integrity(resolved string) string {
+	_, hash, _ := strings.Cut(resolved, "#")
+	sum, err := hex.DecodeString(hash)
+	if err != nil || len(sum) != sha1.Size {
+		return ""
+	}
+	return "sha1-" + base64.StdEncoding.EncodeToString(sum)
+}
+
+// relativePath returns the slash separated path of target relative to the directory dir,
+// both relative to the project root
+func relativePath(dir string, target string) string {
+	dirParts := strings.Split(path.Clean(dir), "/")
+	targetParts := strings.Split(path.Clean(target), "/")
+	if dirParts[0] == "." {
+		dirParts = nil
+	}
+	if targetParts[0] == "." {
+		targetParts = nil
+	}
+	common := 0
+	for common < len(dirParts) && common < len(targetParts) && dirParts[common] == targetParts[common] {
+		common++
+	}
+	parts := make([]string, 0, len(dirParts)-common+len(targetParts)-common)
+	for range dirParts[common:] {
+		parts = append(parts, "..")
+	}
+	parts = append(parts, targetParts[common:]...)
+	if len(parts) == 0 {
+		return "."
+	}
+	return strings.Join(parts, "/")
+}
+
+// nameDescriptor returns a descriptor of name, preferably one resolving to a version
+// that satisfies versionRange, empty if none
+func (l *Lockfile) nameDescriptor(name string, versionRange string) string {
+	found := ""
+	for _, descriptor := range sortedKeys(l.Descriptors) {
+		if descriptorName, _ := splitDescriptor(descriptor); descriptorName != name {
+			continue
+		}
+		pkg, ok := l.Packages[l.Descriptors[descriptor]]
+		if ok && versionSatisfies(versionRange, pkg.Version) {
+			return descriptor
+		}
+		if found == "" {
+			found = descriptor
+		}
+	}
+	return found
+}
+
+// hoistedPackage returns the key of the package installed at node_modules/name, empty if none
+func (l *Lockfile) hoistedPackage(name string) string {
+	for _, key := range sortedKeys(l.Packages) {
+		if contains(l.Packages[key].Paths, "node_modules/"+name) {
+			return key
+		}
+	}
+	return ""
+}
+
+// inferLockfileImporters fills the importers of a lockfile that doesn't record them
+// from the package.json files of the project, resolving the declared ranges with the
+// lockfile descriptors. A dependency whose range changed since the lockfile was written
+// resolves with another descriptor of the same name, preferably one whose version
+// satisfies the declared range. Lockfiles without descriptors (npm v1) resolve the
+// dependencies with the hoisted packages and leave the specifier empty, as they don't
+// record it. Dependencies missing from the lockfile are left out.
+func (pm PackageManager) inferLockfileImporters(fsys fs.FS, lockfile *Lockfile) error {
+	manifests := []string{"package.json"}
+	workspaces, err := pm.GetWorkspacesFS(fsys)
+	if err != nil && !errors.Is(err, ErrNoWorkspaces) {
+		return err
+	}
+	manifests = append(manifests, workspaces...)
+
+	dirs := map[string]string{}
+	pkgs := make([]*packageJson.PackageJSON, len(manifests))
+	for i, manifest := range manifests {
+		pkg, err := readPackageJSON(fsys, manifest)
+		if err != nil {
+			return err
+		}
+		if pkg.Name != "" {
+			dirs[pkg.Name] = path.Dir(manifest)
+		}
+		pkgs[i] = pkg
+	}
+
+	for i, pkg := range pkgs {
+		importer := lockfile.importer(path.Dir(manifests[i]))
+		importer.Inferred = true
+		for _, field := range dependencyFields(pkg) {
+			if field.Name == "peerDependencies" {
+				continue
+			}
+			for name, versionRange := range field.Dependencies {
+				if _, ok := importer.Dependencies[name]; ok {
+					continue
+				}
+				dependency := LockfileDependency{Field: field.Name, Specifier: versionRange}
+				if dir, ok := dirs[name]; ok {
+					dependency.Link = dir
+				} else if key, ok := lockfile.Descriptors[name+"@"+versionRange]; ok {
+					dependency.Package = key
+				} else if key, ok := lockfile.Descriptors[name+"@npm:"+versionRange]; ok {
+					dependency.Package = key
+				} else if descriptor := lockfile.nameDescriptor(name, versionRange); descriptor != "" {
+					_, lockedRange := splitDescriptor(descriptor)
+					dependency.Specifier, dependency.Package = stripNpmProtocol(lockedRange), lockfile.Descriptors[descriptor]
+				} else if key := lockfile.hoistedPackage(name); key != "" {
+					dependency.Specifier, dependency.Package = "", key
+				} else {
+					continue
+				}
+				if locked, ok := lockfile.Packages[dependency.Package]; ok {
+					dependency.Version = locked.Version
+				}
+				importer.Dependencies[name] = dependency
+			}
+		}
+	}
+	return nil
+}
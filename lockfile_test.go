@@ -0,0 +1,223 @@
+package packagemanager
+
+import (
+	"errors"
+	"os"
+	"path"
+	"regexp"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/v3/assert"
+)
+
+func readLockfileFixture(t *testing.T, pm PackageManager, name string) *Lockfile {
+	t.Helper()
+	contents, err := os.ReadFile(path.Join("testdata", "lockfiles", name))
+	assert.NilError(t, err)
+	lockfile, err := pm.UnmarshalLockfile(contents)
+	assert.NilError(t, err)
+	return lockfile
+}
+
+func Test_UnmarshalLockfile(t *testing.T) {
+	// all fixtures lock the same project: a root workspace depending on lodash
+	// and typescript (dev) and a packages/ui workspace depending on react
+	wantPackages := map[string]map[string]string{
+		"js-tokens@4.0.0":    nil,
+		"lodash@4.17.21":     nil,
+		"loose-envify@1.4.0": {"js-tokens": "js-tokens@4.0.0"},
+		"react@18.2.0":       {"loose-envify": "loose-envify@1.4.0"},
+		"typescript@5.1.6":   nil,
+	}
+	wantImporters := map[string]map[string]string{
+		".":           {"lodash": "^4.17.20 4.17.21", "typescript": "^5.0.0 5.1.6"},
+		"packages/ui": {"react": "^18.2.0 18.2.0"},
+	}
+	tests := []struct {
+		file        string
+		pm          PackageManager
+		wantVersion string
+		// whether the lockfile records the importers with their specifiers
+		importers bool
+		// whether the lockfile records the dev flag of packages
+		dev bool
+	}{
+		{file: "pnpm-v5.yaml", pm: nodejsPnpm, wantVersion: "5.4", importers: true, dev: true},
+		{file: "pnpm-v6.yaml", pm: nodejsPnpm, wantVersion: "6.0", importers: true, dev: true},
+		{file: "pnpm-v9.yaml", pm: nodejsPnpm, wantVersion: "9.0", importers: true},
+		{file: "npm-v1.json", pm: nodejsNpm, wantVersion: "1", dev: true},
+		{file: "npm-v3.json", pm: nodejsNpm, wantVersion: "3", importers: true, dev: true},
+		{file: "yarn-v1.lock", pm: nodejsYarn, wantVersion: "1"},
+		{file: "berry.lock", pm: nodejsBerry, wantVersion: "6", importers: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			lockfile := readLockfileFixture(t, tt.pm, tt.file)
+			assert.Equal(t, lockfile.Manager, tt.pm.Name)
+			assert.Equal(t, lockfile.Version, tt.wantVersion)
+
+			packages := map[string]map[string]string{}
+			for key, pkg := range lockfile.Packages {
+				packages[key] = pkg.Dependencies
+				assert.Equal(t, key, packageKey(pkg.Name, pkg.Version))
+				assert.Assert(t, pkg.Resolved != "")
+				assert.Equal(t, pkg.Dev, tt.dev && pkg.Name == "typescript", key)
+			}
+			assert.DeepEqual(t, packages, wantPackages)
+
+			if tt.importers {
+				importers := map[string]map[string]string{}
+				for dir, importer := range lockfile.Importers {
+					importers[dir] = map[string]string{}
+					for name, dep := range importer.Dependencies {
+						importers[dir][name] = dep.Specifier + " " + dep.Version
+						assert.Equal(t, dep.Package, packageKey(name, dep.Version))
+					}
+				}
+				assert.DeepEqual(t, importers, wantImporters)
+			}
+		})
+	}
+
+	t.Run("yarn descriptors", func(t *testing.T) {
+		for _, file := range []string{"yarn-v1.lock", "berry.lock"} {
+			pm := nodejsYarn
+			if file == "berry.lock" {
+				pm = nodejsBerry
+			}
+			pkg, ok := readLockfileFixture(t, pm, file).Resolve("js-tokens@^3.0.0 || ^4.0.0")
+			assert.Assert(t, ok, file)
+			assert.Equal(t, pkg.Version, "4.0.0")
+		}
+	})
+
+	t.Run("npm v1 installs", func(t *testing.T) {
+		lockfile := readLockfileFixture(t, nodejsNpm, "npm-v1.json")
+		assert.DeepEqual(t, lockfile.Packages["react@18.2.0"].Paths, []string{"node_modules/react"})
+		assert.Equal(t, len(lockfile.Importers), 0)
+	})
+
+	t.Run("npm v1 inferred importer", func(t *testing.T) {
+		contents, err := os.ReadFile("testdata/lockfiles/npm-v1.json")
+		assert.NilError(t, err)
+		lockfile, err := nodejsNpm.ReadLockfileFS(fstest.MapFS{
+			"package-lock.json": {Data: contents},
+			"package.json":      {Data: []byte(`{"dependencies": {"react": "^18.2.0"}, "devDependencies": {"typescript": "^5.1.0"}}`)},
+		})
+		assert.NilError(t, err)
+		// the hoisted transitive dependencies of react aren't direct dependencies
+		assert.DeepEqual(t, lockfile.Importers, map[string]*LockfileImporter{".": {
+			Inferred: true,
+			Dependencies: map[string]LockfileDependency{
+				"react":      {Field: "dependencies", Package: "react@18.2.0", Version: "18.2.0"},
+				"typescript": {Field: "devDependencies", Package: "typescript@5.1.6", Version: "5.1.6"},
+			},
+		}})
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := nodejsPnpm.UnmarshalLockfile([]byte("lockfileVersion: [\n"))
+		var parseErr *ParseError
+		assert.Assert(t, errors.As(err, &parseErr))
+		assert.Equal(t, parseErr.File, "pnpm-lock.yaml")
+	})
+}
+
+func Test_MarshalLockfile(t *testing.T) {
+	source := readLockfileFixture(t, nodejsNpm, "npm-v3.json")
+	for _, pm := range []PackageManager{nodejsPnpm, nodejsYarn} {
+		t.Run(pm.Name, func(t *testing.T) {
+			contents, err := pm.MarshalLockfile(source)
+			assert.NilError(t, err)
+			lockfile, err := pm.UnmarshalLockfile(contents)
+			assert.NilError(t, err)
+			assert.Equal(t, len(lockfile.Packages), len(source.Packages))
+			for key, pkg := range source.Packages {
+				written, ok := lockfile.Packages[key]
+				assert.Assert(t, ok, key)
+				assert.Equal(t, written.Integrity, pkg.Integrity, key)
+				assert.DeepEqual(t, written.Dependencies, pkg.Dependencies)
+			}
+			for dir, importer := range lockfile.Importers {
+				for name, dependency := range importer.Dependencies {
+					want := source.Importers[dir].Dependencies[name]
+					assert.Equal(t, dependency.Specifier+" "+dependency.Package, want.Specifier+" "+want.Package)
+				}
+			}
+		})
+	}
+
+	t.Run("pnpm format", func(t *testing.T) {
+		fixture, err := os.ReadFile("testdata/lockfiles/pnpm-v9.yaml")
+		assert.NilError(t, err)
+		contents, err := nodejsPnpm.MarshalLockfile(readLockfileFixture(t, nodejsPnpm, "pnpm-v9.yaml"))
+		assert.NilError(t, err)
+		// package metadata is not part of Lockfile
+		want := regexp.MustCompile(`(?m)^    (hasBin|engines): .*\n`).ReplaceAllString(string(fixture), "")
+		assert.Equal(t, string(contents), want)
+	})
+
+	t.Run("yarn requires ranges", func(t *testing.T) {
+		_, err := nodejsYarn.MarshalLockfile(readLockfileFixture(t, nodejsPnpm, "pnpm-v9.yaml"))
+		var unsupported *UnsupportedConfigError
+		assert.Assert(t, errors.As(err, &unsupported))
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		_, err := nodejsNpm.MarshalLockfile(source)
+		var unsupported *UnsupportedConfigError
+		assert.Assert(t, errors.As(err, &unsupported))
+	})
+
+	t.Run("yarn sha1", func(t *testing.T) {
+		integrity := yarnSha1Integrity("https://registry.yarnpkg.com/js-tokens/-/js-tokens-4.0.0.tgz#19203fb59991df98e3a287050d4647cdeaf32499")
+		assert.Equal(t, integrity, "sha1-GSA/tZmR35jjoocFDUZHzerzJJk=")
+	})
+}
+
+func Test_CheckLockfileDrift(t *testing.T) {
+	lockfile, err := os.ReadFile("testdata/lockfiles/pnpm-v9.yaml")
+	assert.NilError(t, err)
+	fsys := fstest.MapFS{
+		"pnpm-lock.yaml":           {Data: lockfile},
+		"pnpm-workspace.yaml":      {Data: []byte("packages:\n  - packages/*\n")},
+		"package.json":             {Data: []byte(`{"name": "root", "dependencies": {"lodash": "^4.17.20"}, "devDependencies": {"typescript": "^5.2.0"}}`)},
+		"packages/ui/package.json": {Data: []byte(`{"name": "ui", "dependencies": {"react-dom": "^18.2.0"}, "peerDependencies": {"react": "^18.0.0"}}`)},
+	}
+	drifts, err := nodejsPnpm.CheckLockfileDriftFS(fsys)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, drifts, []Drift{
+		{Workspace: ".", Name: "typescript", Kind: DriftChanged, Declared: "^5.2.0", Locked: "^5.0.0"},
+		{Workspace: "packages/ui", Name: "react", Kind: DriftRemoved, Locked: "^18.2.0"},
+		{Workspace: "packages/ui", Name: "react-dom", Kind: DriftAdded, Declared: "^18.2.0"},
+	})
+
+	t.Run("yarn classic", func(t *testing.T) {
+		lockfile, err := os.ReadFile("testdata/lockfiles/yarn-v1.lock")
+		assert.NilError(t, err)
+		drifts, err := nodejsYarn.CheckLockfileDriftFS(fstest.MapFS{
+			"yarn.lock":                {Data: lockfile},
+			"package.json":             {Data: []byte(`{"workspaces": ["packages/*"], "dependencies": {"lodash": "^4.17.21", "ui": "*"}, "devDependencies": {"typescript": "^5.2.0"}}`)},
+			"packages/ui/package.json": {Data: []byte(`{"name": "ui", "dependencies": {"react": "^18.2.0", "left-pad": "^1.3.0"}}`)},
+		})
+		assert.NilError(t, err)
+		// lodash and typescript were bumped from ^4.17.20 and ^5.0.0
+		assert.DeepEqual(t, drifts, []Drift{
+			{Workspace: ".", Name: "lodash", Kind: DriftChanged, Declared: "^4.17.21", Locked: "^4.17.20"},
+			{Workspace: ".", Name: "typescript", Kind: DriftUnsatisfied, Declared: "^5.2.0", Locked: "5.1.6"},
+			{Workspace: "packages/ui", Name: "left-pad", Kind: DriftAdded, Declared: "^1.3.0"},
+		})
+	})
+
+	t.Run("npm v1 versions", func(t *testing.T) {
+		lockfile, err := os.ReadFile("testdata/lockfiles/npm-v1.json")
+		assert.NilError(t, err)
+		drifts, err := nodejsNpm.CheckLockfileDriftFS(fstest.MapFS{
+			"package-lock.json": {Data: lockfile},
+			"package.json":      {Data: []byte(`{"dependencies": {"lodash": "^4.17.20"}, "devDependencies": {"typescript": "^5.2.0"}}`)},
+		})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, drifts, []Drift{{Workspace: ".", Name: "typescript", Kind: DriftUnsatisfied, Declared: "^5.2.0", Locked: "5.1.6"}})
+	})
+}
@@ -0,0 +1,49 @@
+package packagemanager
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/software-t-rex/packageJson"
+)
+
+// dependencyField is one of the dependency fields of a package.json
+type dependencyField struct {
+	// The field name in package.json
+	Name string
+	// The field content, shared with the package.json it was taken from
+	Dependencies map[string]string
+}
+
+// dependencyFields returns the dependency fields of pkg, in the order npm reads them
+func dependencyFields(pkg *packageJson.PackageJSON) []dependencyField {
+	return []dependencyField{
+		{"dependencies", pkg.Dependencies},
+		{"devDependencies", pkg.DevDependencies},
+		{"optionalDependencies", pkg.OptionalDependencies},
+		{"peerDependencies", pkg.PeerDependencies},
+	}
+}
+
+// splitDescriptor splits a "name@range" descriptor, taking care of scoped names
+func splitDescriptor(descriptor string) (name string, versionRange string) {
+	start := 0
+	if strings.HasPrefix(descriptor, "@") {
+		start = 1
+	}
+	i := strings.Index(descriptor[start:], "@")
+	if i < 0 {
+		return descriptor, ""
+	}
+	return descriptor[:start+i], descriptor[start+i+1:]
+}
+
+// sortedKeys returns the keys of m in lexical order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,360 @@
+package packagemanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/software-t-rex/packageJson"
+	"gopkg.in/yaml.v3"
+)
+
+// Migration is the set of changes moving a project to another package manager.
+type Migration struct {
+	// The contents of the files to write, by slash separated path relative to the project root.
+	Files map[string][]byte
+	// The files to remove, relative to the project root.
+	Remove []string
+	// What could not be migrated and needs a manual change.
+	Notes []string
+}
+
+// Migrate returns the changes moving the project in projectDirectory from pm to the package manager to.
+// See MigrateFS.
+func (pm PackageManager) Migrate(projectDirectory string, to PackageManager) (*Migration, error) {
+	return pm.MigrateFS(os.DirFS(projectDirectory), to)
+}
+
+// MigrateFS returns the changes moving the project stored at the root of fsys from pm to the package
+// manager to. The lockfile is converted keeping the resolved versions and integrity of every package,
+// so that installing with to doesn't change what is installed. The workspaces configuration
+// (package.json workspaces, pnpm-workspace.yaml), the packageManager field and the patches
+// (patch-package, pnpm patchedDependencies) are translated as well.
+// It returns an UnsupportedConfigError when to can't write lockfiles or when the lockfile records
+// something to can't express.
+func (pm PackageManager) MigrateFS(fsys fs.FS, to PackageManager) (*Migration, error) {
+	lockfile, err := pm.ReadLockfileFS(fsys)
+	if err != nil {
+		return nil, err
+	}
+	if lockfile == nil {
+		return nil, &UnsupportedConfigError{Manager: pm.Name, Reason: "reading the lockfile is not supported"}
+	}
+	migration := &Migration{Files: map[string][]byte{}}
+	manifest, err := fs.ReadFile(fsys, "package.json")
+	if err != nil {
+		return nil, err
+	}
+	pkg, err := readPackageJSON(fsys, "package.json")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pm.normalizeLockfileImporters(fsys, lockfile, migration); err != nil {
+		return nil, err
+	}
+	contents, err := to.MarshalLockfile(lockfile)
+	if err != nil {
+		return nil, err
+	}
+	migration.Files[to.Lockfile] = contents
+	if pm.Lockfile != to.Lockfile {
+		migration.Remove = append(migration.Remove, pm.Lockfile)
+	}
+
+	manifest, migratedPatches, err := pm.migratePatches(fsys, to, manifest, migration)
+	if err != nil {
+		return nil, err
+	}
+	if manifest, err = pm.migrateWorkspaces(fsys, to, manifest, pkg, migratedPatches, migration); err != nil {
+		return nil, err
+	}
+
+	if pkg.PackageManager != "" {
+		if to.Version != nil {
+			manifest, err = setTopLevelJSONField(manifest, "packageManager", to.Command+"@"+to.Version.String())
+		} else {
+			manifest, err = deleteJSONField(manifest, []string{"packageManager"})
+			migration.Notes = append(migration.Notes, fmt.Sprintf("package.json: the packageManager field was removed, set it to the %s version to use", to.Command))
+		}
+		if err != nil {
+			return nil, &ParseError{File: "package.json", Err: err}
+		}
+	}
+	migration.Files["package.json"] = manifest
+	return migration, nil
+}
+
+// Apply writes the migration to the project in projectDirectory.
+func (m *Migration) Apply(projectDirectory string) error {
+	for _, file := range sortedKeys(m.Files) {
+		target := filepath.Join(projectDirectory, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, m.Files[file], 0o644); err != nil {
+			return err
+		}
+	}
+	for _, file := range m.Remove {
+		if err := os.Remove(filepath.Join(projectDirectory, filepath.FromSlash(file))); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeLockfileImporters aligns the importers of lockfile with the package.json files of the project:
+// specifiers and fields are the declared ones and dependencies that aren't declared, like the hoisted
+// packages of npm v1 lockfiles, are dropped.
+func (pm PackageManager) normalizeLockfileImporters(fsys fs.FS, lockfile *Lockfile, migration *Migration) error {
+	manifests := []string{"package.json"}
+	workspaces, err := pm.GetWorkspacesFS(fsys)
+	if err != nil && !errors.Is(err, ErrNoWorkspaces) {
+		return err
+	}
+	manifests = append(manifests, workspaces...)
+
+	dirs := map[string]string{}
+	pkgs := make([]*packageJson.PackageJSON, len(manifests))
+	for i, manifest := range manifests {
+		if pkgs[i], err = readPackageJSON(fsys, manifest); err != nil {
+			return err
+		}
+		if pkgs[i].Name != "" {
+			dirs[pkgs[i].Name] = path.Dir(manifest)
+		}
+	}
+
+	for i, pkg := range pkgs {
+		dir := path.Dir(manifests[i])
+		locked := lockfile.importer(dir)
+		importer := &LockfileImporter{Dependencies: map[string]LockfileDependency{}}
+		for _, field := range dependencyFields(pkg) {
+			if field.Name == "peerDependencies" {
+				continue
+			}
+			for _, name := range sortedKeys(field.Dependencies) {
+				dependency, ok := locked.Dependencies[name]
+				if workspace, isWorkspace := dirs[name]; isWorkspace && (!ok || dependency.Link != "") {
+					dependency, ok = LockfileDependency{Link: workspace}, true
+				}
+				if !ok {
+					migration.Notes = append(migration.Notes, fmt.Sprintf("%s: %s is not in the lockfile, it will be resolved on install", manifests[i], name))
+					continue
+				}
+				dependency.Field, dependency.Specifier = field.Name, field.Dependencies[name]
+				importer.Dependencies[name] = dependency
+			}
+		}
+		lockfile.Importers[dir] = importer
+	}
+	return nil
+}
+
+// migrateWorkspaces moves the workspaces globs between package.json and pnpm-workspace.yaml.
+// migratedPatches are the patchedDependencies keys already moved to patch-package.
+func (pm PackageManager) migrateWorkspaces(fsys fs.FS, to PackageManager, manifest []byte, pkg *packageJson.PackageJSON, migratedPatches map[string]bool, migration *Migration) ([]byte, error) {
+	fromPnpm, toPnpm := pm.Name == nodejsPnpm.Name, to.Name == nodejsPnpm.Name
+	switch {
+	case !fromPnpm && toPnpm && len(pkg.Workspaces) > 0:
+		var buffer bytes.Buffer
+		encoder := yaml.NewEncoder(&buffer)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(PnpmWorkspaces{Packages: pkg.Workspaces}); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+		migration.Files[pnpmWorkspaceFile] = buffer.Bytes()
+		var err error
+		if manifest, err = deleteJSONField(manifest, []string{"workspaces"}); err != nil {
+			return nil, &ParseError{File: "package.json", Err: err}
+		}
+	case fromPnpm && !toPnpm && FileExistsFS(fsys, pnpmWorkspaceFile):
+		contents, err := fs.ReadFile(fsys, pnpmWorkspaceFile)
+		if err != nil {
+			return nil, err
+		}
+		var settings map[string]interface{}
+		if err := yaml.Unmarshal(contents, &settings); err != nil {
+			return nil, newYamlParseError(pnpmWorkspaceFile, err)
+		}
+		var workspace PnpmWorkspaces
+		if err := yaml.Unmarshal(contents, &workspace); err != nil {
+			return nil, newYamlParseError(pnpmWorkspaceFile, err)
+		}
+		if len(workspace.Packages) > 0 {
+			if manifest, err = setTopLevelJSONField(manifest, "workspaces", workspace.Packages); err != nil {
+				return nil, &ParseError{File: "package.json", Err: err}
+			}
+		}
+		delete(settings, "packages")
+		migratedHere := false
+		for key := range workspace.PatchedDependencies {
+			if migratedPatches[key] {
+				migratedHere = true
+				delete(workspace.PatchedDependencies, key)
+			}
+		}
+		if workspace.PatchedDependencies != nil && len(workspace.PatchedDependencies) == 0 {
+			delete(settings, "patchedDependencies")
+		}
+		if len(settings) == 0 {
+			migration.Remove = append(migration.Remove, pnpmWorkspaceFile)
+			break
+		}
+		migration.Notes = append(migration.Notes, fmt.Sprintf("%s: %s settings have no %s equivalent, the file was kept", pnpmWorkspaceFile, strings.Join(sortedKeys(settings), ", "), to.Command))
+		if migratedHere {
+			// the kept file must not reference the patches moved to patch-package
+			if migration.Files[pnpmWorkspaceFile], err = deleteYamlMappingKeys(contents, "patchedDependencies", migratedPatches); err != nil {
+				return nil, newYamlParseError(pnpmWorkspaceFile, err)
+			}
+		}
+	}
+	return manifest, nil
+}
+
+// migratePatches converts patch-package patches to pnpm patchedDependencies and back.
+// Other patches are left for a manual migration.
+// It returns the pnpm patchedDependencies keys moved to patch-package.
+func (pm PackageManager) migratePatches(fsys fs.FS, to PackageManager, manifest []byte, migration *Migration) ([]byte, map[string]bool, error) {
+	patches, err := pm.ListPatchesFS(fsys)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(patches) == 0 || pm.Name == to.Name || usesPatchPackage(pm) && usesPatchPackage(to) {
+		return manifest, nil, nil
+	}
+	if pm.Name == nodejsPnpm.Name && usesPatchPackage(to) {
+		return migratePnpmPatches(fsys, patches, manifest, migration)
+	}
+	if !usesPatchPackage(pm) || to.Name != nodejsPnpm.Name {
+		for _, patch := range patches {
+			migration.Notes = append(migration.Notes, fmt.Sprintf("%s: the patch of %s can't be migrated to %s", patch.File, patch.Name, to.Command))
+		}
+		return manifest, nil, nil
+	}
+
+	for _, patch := range patches {
+		content, err := fs.ReadFile(fsys, patch.File)
+		if err != nil {
+			return nil, nil, err
+		}
+		// pnpm patches are relative to the package directory
+		content = rewriteDiffPaths(content, packageRelativePath)
+		file := path.Join(patchPackageDir, strings.ReplaceAll(patch.Name, "/", "__")+"@"+patch.Version+".patch")
+		if manifest, err = setJSONField(manifest, []string{"pnpm", "patchedDependencies", patch.Name + "@" + patch.Version}, file); err != nil {
+			return nil, nil, &ParseError{File: "package.json", Err: err}
+		}
+		migration.Files[file] = content
+		migration.Remove = append(migration.Remove, patch.File)
+	}
+	migration.Notes = append(migration.Notes, "package.json: patch-package is no longer needed, remove it and its postinstall script")
+	return manifest, nil, nil
+}
+
+// migratePnpmPatches converts pnpm patchedDependencies to patch-package patches.
+// Patches of a range or of every version of a package can't be named after the
+// patched version and are left for a manual migration. It returns the keys of the migrated patches.
+func migratePnpmPatches(fsys fs.FS, patches []Patch, manifest []byte, migration *Migration) ([]byte, map[string]bool, error) {
+	migrated := map[string]bool{}
+	for _, patch := range patches {
+		if version, err := semver.NewVersion(patch.Version); err != nil || version.String() != patch.Version || !patch.Exists {
+			migration.Notes = append(migration.Notes, fmt.Sprintf("%s: the patch of %s can't be migrated to patch-package", patch.File, patch.Name))
+			continue
+		}
+		content, err := fs.ReadFile(fsys, patch.File)
+		if err != nil {
+			return nil, nil, err
+		}
+		// patch-package patches are relative to the project root
+		content = rewriteDiffPaths(content, func(file string) string {
+			return path.Join("node_modules", patch.Name, file)
+		})
+		file := path.Join(patchPackageDir, strings.ReplaceAll(patch.Name, "/", "+")+"+"+patch.Version+".patch")
+		migration.Files[file] = content
+		if file != patch.File {
+			migration.Remove = append(migration.Remove, patch.File)
+		}
+		if manifest, err = deleteJSONField(manifest, []string{"pnpm", "patchedDependencies", patch.Name + "@" + patch.Version}); err != nil {
+			return nil, nil, &ParseError{File: "package.json", Err: err}
+		}
+		migrated[patch.Name+"@"+patch.Version] = true
+	}
+	if len(migrated) == 0 {
+		return manifest, nil, nil
+	}
+
+	// drop the pnpm settings left empty
+	for _, keys := range [][]string{{"pnpm", "patchedDependencies"}, {"pnpm"}} {
+		var pkg map[string]interface{}
+		if err := json.Unmarshal(manifest, &pkg); err != nil {
+			return nil, nil, &ParseError{File: "package.json", Line: jsonErrorLine(manifest, err), Err: err}
+		}
+		value := interface{}(pkg)
+		for _, key := range keys {
+			object, _ := value.(map[string]interface{})
+			value = object[key]
+		}
+		if object, ok := value.(map[string]interface{}); ok && len(object) == 0 {
+			var err error
+			if manifest, err = deleteJSONField(manifest, keys); err != nil {
+				return nil, nil, &ParseError{File: "package.json", Err: err}
+			}
+		}
+	}
+	migration.Notes = append(migration.Notes, `package.json: add patch-package to the devDependencies and a "postinstall": "patch-package" script to apply the patches`)
+	return manifest, migrated, nil
+}
+
+// deleteYamlMappingKeys returns the yaml document content without the keys of the mapping at field,
+// and without field when none is left
+func deleteYamlMappingKeys(content []byte, field string, keys map[string]bool) ([]byte, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+	if len(document.Content) == 1 && document.Content[0].Kind == yaml.MappingNode {
+		root := document.Content[0]
+		var fields []*yaml.Node
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if mapping := root.Content[i+1]; root.Content[i].Value == field && mapping.Kind == yaml.MappingNode {
+				var kept []*yaml.Node
+				for j := 0; j+1 < len(mapping.Content); j += 2 {
+					if !keys[mapping.Content[j].Value] {
+						kept = append(kept, mapping.Content[j], mapping.Content[j+1])
+					}
+				}
+				if mapping.Content = kept; len(kept) == 0 {
+					continue
+				}
+			}
+			fields = append(fields, root.Content[i], root.Content[i+1])
+		}
+		root.Content = fields
+	}
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// usesPatchPackage tells if pm patches packages with patch-package
+func usesPatchPackage(pm PackageManager) bool {
+	return pm.Name == nodejsNpm.Name || pm.Name == nodejsYarn.Name
+}
@@ -0,0 +1,150 @@
+package packagemanager
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/v3/assert"
+)
+
+func Test_Migrate(t *testing.T) {
+	yarnLock, err := os.ReadFile("testdata/lockfiles/yarn-v1.lock")
+	assert.NilError(t, err)
+	patch := "diff --git a/node_modules/lodash/index.js b/node_modules/lodash/index.js\n" +
+		"--- a/node_modules/lodash/index.js\n" +
+		"+++ b/node_modules/lodash/index.js\n" +
+		"@@ -1,2 +1,2 @@\n" +
+		"--- a/not/a/header\n" +
+		"+module.exports = require('./lodash');\n"
+	fsys := fstest.MapFS{
+		"yarn.lock": {Data: yarnLock},
+		"package.json": {Data: []byte(`{
+  "name": "root",
+  "workspaces": ["packages/*"],
+  "packageManager": "yarn@1.22.19",
+  "dependencies": {"lodash": "^4.17.20"},
+  "devDependencies": {"typescript": "^5.0.0"}
+}
+`)},
+		"packages/ui/package.json":        {Data: []byte(`{"name": "ui", "dependencies": {"react": "^18.2.0", "root": "*"}}`)},
+		"patches/lodash+4.17.21.patch":    {Data: []byte(patch)},
+		"patches/left-pad+1.3.0+001.info": {Data: []byte("not a patch")},
+	}
+	pnpm, err := nodejsPnpm.WithVersion("9.1.0")
+	assert.NilError(t, err)
+
+	migration, err := nodejsYarn.MigrateFS(fsys, *pnpm)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, migration.Remove, []string{"yarn.lock", "patches/lodash+4.17.21.patch"})
+	assert.Equal(t, string(migration.Files["pnpm-workspace.yaml"]), "packages:\n  - packages/*\n")
+	assert.Equal(t, string(migration.Files["package.json"]), `{
+  "name": "root",
+  "packageManager": "pnpm@9.1.0",
+  "dependencies": {"lodash": "^4.17.20"},
+  "devDependencies": {"typescript": "^5.0.0"},
+  "pnpm": {"patchedDependencies":{"lodash@4.17.21":"patches/lodash@4.17.21.patch"}}
+}
+`)
+	assert.Equal(t, string(migration.Files["patches/lodash@4.17.21.patch"]), "diff --git a/index.js b/index.js\n"+
+		"--- a/index.js\n"+
+		"+++ b/index.js\n"+
+		"@@ -1,2 +1,2 @@\n"+
+		"--- a/not/a/header\n"+
+		"+module.exports = require('./lodash');\n")
+
+	lockfile, err := nodejsPnpm.UnmarshalLockfile(migration.Files["pnpm-lock.yaml"])
+	assert.NilError(t, err)
+	assert.Equal(t, lockfile.Importers["."].Dependencies["lodash"].Version, "4.17.21")
+	assert.Equal(t, lockfile.Importers["packages/ui"].Dependencies["root"].Link, ".")
+	assert.Equal(t, lockfile.Packages["react@18.2.0"].Integrity, "sha512-react-18.2.0")
+
+	assert.DeepEqual(t, migration.Notes, []string{"package.json: patch-package is no longer needed, remove it and its postinstall script"})
+
+	t.Run("npm to yarn", func(t *testing.T) {
+		npmLock, err := os.ReadFile("testdata/lockfiles/npm-v3.json")
+		assert.NilError(t, err)
+		migration, err := nodejsNpm.MigrateFS(fstest.MapFS{
+			"package-lock.json":            {Data: npmLock},
+			"package.json":                 fsys["package.json"],
+			"packages/ui/package.json":     fsys["packages/ui/package.json"],
+			"patches/lodash+4.17.21.patch": {Data: []byte(patch)},
+		}, nodejsYarn)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, migration.Remove, []string{"package-lock.json"})
+		// yarn resolves packages from its registry mirror
+		resolved := regexp.MustCompile(`(?m)^  resolved .*\n`)
+		assert.Equal(t, resolved.ReplaceAllString(string(migration.Files["yarn.lock"]), ""), resolved.ReplaceAllString(string(yarnLock), ""))
+		// no version to pin
+		assert.Assert(t, !strings.Contains(string(migration.Files["package.json"]), "packageManager"))
+		assert.Equal(t, len(migration.Notes), 1)
+	})
+
+	t.Run("pnpm to yarn", func(t *testing.T) {
+		pnpmLock := "lockfileVersion: '9.0'\nimporters:\n  .:\n    dependencies:\n" +
+			"      '@acme/x':\n        specifier: 1.0.0\n        version: 1.0.0\n" +
+			"      lodash:\n        specifier: ^4.17.20\n        version: 4.17.21\n" +
+			"packages:\n  '@acme/x@1.0.0':\n    resolution: {integrity: sha512-x}\n  lodash@4.17.21:\n    resolution: {integrity: sha512-lodash}\n" +
+			"snapshots:\n  '@acme/x@1.0.0': {}\n  lodash@4.17.21: {}\n"
+		pnpmPatch := "--- a/index.js\n+++ b/index.js\n@@ -1 +1 @@\n-old\n+new\n"
+		fsys := fstest.MapFS{
+			"pnpm-lock.yaml":      {Data: []byte(pnpmLock)},
+			"pnpm-workspace.yaml": {Data: []byte("patchedDependencies:\n  '@acme/x@1.0.0': patches/@acme__x@1.0.0.patch\n")},
+			"package.json": {Data: []byte(`{
+  "dependencies": {"@acme/x": "1.0.0", "lodash": "^4.17.20"},
+  "pnpm": {"patchedDependencies": {"lodash@4.17.21": "patches/lodash@4.17.21.patch"}}
+}
+`)},
+			"patches/lodash@4.17.21.patch": {Data: []byte(pnpmPatch)},
+			"patches/@acme__x@1.0.0.patch": {Data: []byte(pnpmPatch)},
+		}
+		migration, err := nodejsPnpm.MigrateFS(fsys, nodejsYarn)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, migration.Remove, []string{"pnpm-lock.yaml", "patches/@acme__x@1.0.0.patch", "patches/lodash@4.17.21.patch", "pnpm-workspace.yaml"})
+		assert.Equal(t, string(migration.Files["package.json"]), `{
+  "dependencies": {"@acme/x": "1.0.0", "lodash": "^4.17.20"}
+}
+`)
+		assert.Equal(t, string(migration.Files["patches/@acme+x+1.0.0.patch"]), "--- a/node_modules/@acme/x/index.js\n+++ b/node_modules/@acme/x/index.js\n@@ -1 +1 @@\n-old\n+new\n")
+		assert.Equal(t, string(migration.Files["patches/lodash+4.17.21.patch"]), "--- a/node_modules/lodash/index.js\n+++ b/node_modules/lodash/index.js\n@@ -1 +1 @@\n-old\n+new\n")
+		assert.DeepEqual(t, migration.Notes, []string{`package.json: add patch-package to the devDependencies and a "postinstall": "patch-package" script to apply the patches`})
+
+		// patches of every version of a package have no patch-package equivalent
+		fsys["package.json"] = &fstest.MapFile{Data: []byte(`{
+  "dependencies": {"@acme/x": "1.0.0", "lodash": "^4.17.20"},
+  "pnpm": {"patchedDependencies": {"lodash@4.17.21": "patches/lodash@4.17.21.patch", "debug": "patches/debug.patch"}}
+}
+`)}
+		fsys["patches/debug.patch"] = &fstest.MapFile{Data: []byte(pnpmPatch)}
+		migration, err = nodejsPnpm.MigrateFS(fsys, nodejsYarn)
+		assert.NilError(t, err)
+		assert.Equal(t, string(migration.Files["package.json"]), `{
+  "dependencies": {"@acme/x": "1.0.0", "lodash": "^4.17.20"},
+  "pnpm": {"patchedDependencies": {"debug": "patches/debug.patch"}}
+}
+`)
+		assert.Equal(t, migration.Notes[0], "patches/debug.patch: the patch of debug can't be migrated to patch-package")
+
+		// pnpm-workspace.yaml is kept with the patches that were not migrated
+		fsys["pnpm-workspace.yaml"] = &fstest.MapFile{Data: []byte("packages:\n  - packages/*\npatchedDependencies:\n  '@acme/x@1.0.0': patches/@acme__x@1.0.0.patch\n  debug: patches/debug.patch # every version\n")}
+		migration, err = nodejsPnpm.MigrateFS(fsys, nodejsYarn)
+		assert.NilError(t, err)
+		assert.Assert(t, !contains(migration.Remove, "pnpm-workspace.yaml"))
+		assert.Equal(t, string(migration.Files["pnpm-workspace.yaml"]), "packages:\n  - packages/*\npatchedDependencies:\n  debug: patches/debug.patch # every version\n")
+		assert.Assert(t, contains(migration.Remove, "patches/@acme__x@1.0.0.patch"))
+	})
+
+	t.Run("pnpm lockfiles don't record ranges", func(t *testing.T) {
+		_, err := nodejsPnpm.MigrateFS(fstest.MapFS{
+			"pnpm-lock.yaml":           {Data: migration.Files["pnpm-lock.yaml"]},
+			"pnpm-workspace.yaml":      {Data: migration.Files["pnpm-workspace.yaml"]},
+			"package.json":             {Data: migration.Files["package.json"]},
+			"packages/ui/package.json": fsys["packages/ui/package.json"],
+		}, nodejsYarn)
+		var unsupported *UnsupportedConfigError
+		assert.Assert(t, errors.As(err, &unsupported))
+	})
+}
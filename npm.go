@@ -1,12 +1,36 @@
 package packagemanager
 
 import (
+	"encoding/json"
 	"fmt"
-	"path/filepath"
+	"io/fs"
 
-	"github.com/software-t-rex/packageJson"
+	"github.com/Masterminds/semver"
 )
 
+// npmVersionFromLockfile returns the lowest npm version writing the lockfile
+// format used by the project.
+func npmVersionFromLockfile(fsys fs.FS, lockfilePath string) (*semver.Version, error) {
+	bytes, err := fs.ReadFile(fsys, lockfilePath)
+	if err != nil {
+		return nil, err
+	}
+	var header struct {
+		LockfileVersion int `json:"lockfileVersion"`
+	}
+	if err := json.Unmarshal(bytes, &header); err != nil {
+		return nil, &ParseError{File: lockfilePath, Err: err}
+	}
+	// https://docs.npmjs.com/cli/v9/configuring-npm/package-lock-json#lockfileversion
+	switch header.LockfileVersion {
+	case 1:
+		return semver.NewVersion("5.0.0")
+	case 2, 3:
+		return semver.NewVersion("7.0.0")
+	}
+	return nil, fmt.Errorf("unknown npm lockfileVersion %d", header.LockfileVersion)
+}
+
 var nodejsNpm = PackageManager{
 	Name:         "nodejs-npm",
 	Slug:         "npm",
@@ -16,44 +40,43 @@ var nodejsNpm = PackageManager{
 	PackageDir:   "node_modules",
 	ArgSeparator: []string{"--"},
 
-	getWorkspaceGlobs: func(rootpath string) ([]string, error) {
-		pkg, err := packageJson.Read(filepath.Join(rootpath, "package.json"))
-		if err != nil {
-			return nil, fmt.Errorf("package.json: %w", err)
-		}
-		if len(pkg.Workspaces) == 0 {
-			return nil, fmt.Errorf("package.json: no workspaces found. packagemanager requires npm workspaces to be defined in the root package.json")
-		}
-		return pkg.Workspaces, nil
-	},
+	Behavior: BehaviorFuncs{
+		WorkspaceGlobsFunc: func(fsys fs.FS) ([]string, error) {
+			return readPackageJSONWorkspaces(fsys, "npm")
+		},
 
-	getWorkspaceIgnores: func(pm PackageManager, rootpath string) ([]string, error) {
-		// Matches upstream values:
-		// function: https://github.com/npm/map-workspaces/blob/a46503543982cb35f51cc2d6253d4dcc6bca9b32/lib/index.js#L73
-		// key code: https://github.com/npm/map-workspaces/blob/a46503543982cb35f51cc2d6253d4dcc6bca9b32/lib/index.js#L90-L96
-		// call site: https://github.com/npm/cli/blob/7a858277171813b37d46a032e49db44c8624f78f/lib/workspaces/get-workspaces.js#L14
-		return []string{
-			"**/node_modules/**",
-		}, nil
-	},
+		WorkspaceIgnoresFunc: func(pm PackageManager, fsys fs.FS) ([]string, error) {
+			// Matches upstream values:
+			// function: https://github.com/npm/map-workspaces/blob/a46503543982cb35f51cc2d6253d4dcc6bca9b32/lib/index.js#L73
+			// key code: https://github.com/npm/map-workspaces/blob/a46503543982cb35f51cc2d6253d4dcc6bca9b32/lib/index.js#L90-L96
+			// call site: https://github.com/npm/cli/blob/7a858277171813b37d46a032e49db44c8624f78f/lib/workspaces/get-workspaces.js#L14
+			return []string{
+				"**/node_modules/**",
+			}, nil
+		},
 
-	Matches: func(manager string, version string) (bool, error) {
-		return manager == "npm", nil
-	},
+		MatchesFunc: func(manager string, version string) (bool, error) {
+			return manager == "npm", nil
+		},
 
-	detect: func(projectDirectory string, packageManager *PackageManager) (bool, error) {
-		specfileExists := FileExists(filepath.Join(projectDirectory, packageManager.Specfile))
-		lockfileExists := FileExists(filepath.Join(projectDirectory, packageManager.Lockfile))
+		DetectFunc: func(fsys fs.FS, packageManager *PackageManager) (bool, error) {
+			specfileExists := FileExistsFS(fsys, packageManager.Specfile)
+			lockfileExists := FileExistsFS(fsys, packageManager.Lockfile)
 
-		return (specfileExists && lockfileExists), nil
-	},
+			if specfileExists && lockfileExists {
+				// an unreadable lockfile version is not a detection failure
+				packageManager.Version, _ = npmVersionFromLockfile(fsys, packageManager.Lockfile)
+			}
 
-	canPrune: func(cwd string) (bool, error) {
-		return true, nil
-	},
+			return (specfileExists && lockfileExists), nil
+		},
+
+		CanPruneFunc: func(fsys fs.FS) (bool, error) {
+			return true, nil
+		},
 
-	// @FIXME unsuported lockfile
-	// UnmarshalLockfile: func(contents []byte) (lockfile.Lockfile, error) {
-	// 	return lockfile.DecodeNpmLockfile(contents)
-	// },
+		UnmarshalLockfileFunc: unmarshalNpmLockfile,
+
+		ListPatchesFunc: patchPackageListPatches,
+	},
 }
@@ -0,0 +1,185 @@
+package packagemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// npmLockfile is package-lock.json (https://docs.npmjs.com/cli/configuring-npm/package-lock-json)
+type npmLockfile struct {
+	LockfileVersion int `json:"lockfileVersion"`
+	// v2 and v3, keyed by install location
+	Packages map[string]npmLockfilePackage `json:"packages"`
+	// v1 and v2, as a tree
+	Dependencies map[string]npmLockfileDependency `json:"dependencies"`
+}
+
+type npmLockfilePackage struct {
+	Name                 string            `json:"name"`
+	Version              string            `json:"version"`
+	Resolved             string            `json:"resolved"`
+	Integrity            string            `json:"integrity"`
+	License              string            `json:"license"`
+	Link                 bool              `json:"link"`
+	Dev                  bool              `json:"dev"`
+	Optional             bool              `json:"optional"`
+	DevOptional          bool              `json:"devOptional"`
+	Dependencies         map[string]string `json:"dependencies"`
+	DevDependencies      map[string]string `json:"devDependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+	PeerDependencies     map[string]string `json:"peerDependencies"`
+}
+
+type npmLockfileDependency struct {
+	Version      string                           `json:"version"`
+	Resolved     string                           `json:"resolved"`
+	Integrity    string                           `json:"integrity"`
+	Dev          bool                             `json:"dev"`
+	Optional     bool                             `json:"optional"`
+	Requires     map[string]string                `json:"requires"`
+	Dependencies map[string]npmLockfileDependency `json:"dependencies"`
+}
+
+// unmarshalNpmLockfile reads package-lock.json or npm-shrinkwrap.json contents
+func unmarshalNpmLockfile(contents []byte) (*Lockfile, error) {
+	var raw npmLockfile
+	if err := json.Unmarshal(contents, &raw); err != nil {
+		return nil, &ParseError{File: "package-lock.json", Line: jsonErrorLine(contents, err), Err: err}
+	}
+	if raw.LockfileVersion < 1 || raw.LockfileVersion > 3 {
+		return nil, &UnsupportedConfigError{Manager: "nodejs-npm", Reason: fmt.Sprintf("lockfile version %d is not supported", raw.LockfileVersion)}
+	}
+
+	packages := raw.Packages
+	if packages == nil {
+		// v1 only has the dependency tree, flatten it to install locations
+		packages = map[string]npmLockfilePackage{}
+		flattenNpmDependencies("", raw.Dependencies, packages)
+	}
+
+	lockfile := newLockfile(strconv.Itoa(raw.LockfileVersion))
+	keys := map[string]string{}
+	for _, location := range sortedKeys(packages) {
+		entry := packages[location]
+		if !strings.Contains(location, "node_modules/") || entry.Link || strings.HasPrefix(entry.Version, "file:") {
+			continue
+		}
+		name := entry.Name
+		if name == "" {
+			name = location[strings.LastIndex(location, "node_modules/")+len("node_modules/"):]
+		}
+		key := packageKey(name, entry.Version)
+		if !strings.HasPrefix(entry.Resolved, "https://") && !strings.HasPrefix(entry.Resolved, "http://") && entry.Resolved != "" {
+			key = packageKey(name, entry.Resolved)
+		}
+		keys[location] = key
+		if pkg, ok := lockfile.Packages[key]; ok {
+			pkg.Paths = append(pkg.Paths, location)
+			continue
+		}
+		lockfile.Packages[key] = &LockfilePackage{
+			Name:             name,
+			Version:          entry.Version,
+			Resolved:         entry.Resolved,
+			Integrity:        entry.Integrity,
+			License:          entry.License,
+			PeerDependencies: entry.PeerDependencies,
+			Dev:              entry.Dev,
+			Optional:         entry.Optional,
+			Paths:            []string{location},
+		}
+	}
+
+	// resolve dependencies the way node does, from the closest node_modules up
+	resolve := func(from string, name string) (LockfileDependency, bool) {
+		for dir := from; ; {
+			location := path.Join(dir, "node_modules", name)
+			if entry, ok := packages[location]; ok {
+				if entry.Link {
+					return LockfileDependency{Link: entry.Resolved}, true
+				}
+				if target, ok := strings.CutPrefix(entry.Version, "file:"); ok {
+					return LockfileDependency{Link: target}, true
+				}
+				return LockfileDependency{Version: lockfile.Packages[keys[location]].Version, Package: keys[location]}, true
+			}
+			if dir == "" || dir == "." {
+				return LockfileDependency{}, false
+			}
+			if i := strings.LastIndex(dir, "/node_modules/"); i >= 0 {
+				dir = dir[:i]
+			} else {
+				dir = ""
+			}
+		}
+	}
+
+	for _, location := range sortedKeys(packages) {
+		entry := packages[location]
+		if key, ok := keys[location]; ok {
+			pkg := lockfile.Packages[key]
+			if pkg.Paths[0] != location {
+				continue
+			}
+			for _, name := range sortedKeys(entry.Dependencies) {
+				if dependency, ok := resolve(location, name); ok && dependency.Package != "" {
+					mergeDependencyKeys(&pkg.Dependencies, map[string]string{name: dependency.Package})
+					mergeDependencyKeys(&pkg.DependencyRanges, map[string]string{name: entry.Dependencies[name]})
+				}
+			}
+			for _, name := range sortedKeys(entry.OptionalDependencies) {
+				if dependency, ok := resolve(location, name); ok && dependency.Package != "" {
+					mergeDependencyKeys(&pkg.OptionalDependencies, map[string]string{name: dependency.Package})
+					mergeDependencyKeys(&pkg.DependencyRanges, map[string]string{name: entry.OptionalDependencies[name]})
+				}
+			}
+			continue
+		}
+		if strings.Contains(location, "node_modules/") || entry.Link {
+			continue
+		}
+
+		// the root project or a workspace folder
+		importer := lockfile.importer(location)
+		for _, field := range []struct {
+			name         string
+			dependencies map[string]string
+		}{
+			{"dependencies", entry.Dependencies},
+			{"devDependencies", entry.DevDependencies},
+			{"optionalDependencies", entry.OptionalDependencies},
+		} {
+			for name, specifier := range field.dependencies {
+				dependency, _ := resolve(location, name)
+				dependency.Field, dependency.Specifier = field.name, specifier
+				importer.Dependencies[name] = dependency
+			}
+		}
+	}
+
+	return lockfile, nil
+}
+
+// flattenNpmDependencies converts a v1 dependency tree to v2 install locations
+func flattenNpmDependencies(parent string, dependencies map[string]npmLockfileDependency, packages map[string]npmLockfilePackage) {
+	for name, dependency := range dependencies {
+		location := path.Join(parent, "node_modules", name)
+		entry := npmLockfilePackage{
+			Version:      dependency.Version,
+			Resolved:     dependency.Resolved,
+			Integrity:    dependency.Integrity,
+			Dev:          dependency.Dev,
+			Optional:     dependency.Optional,
+			Dependencies: dependency.Requires,
+		}
+		// aliases are recorded as npm:name@version
+		if alias, ok := strings.CutPrefix(dependency.Version, "npm:"); ok {
+			entry.Name, entry.Version = splitDescriptor(alias)
+		}
+		packages[location] = entry
+		flattenNpmDependencies(location, dependency.Dependencies, packages)
+	}
+}
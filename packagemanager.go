@@ -11,13 +11,18 @@
 package packagemanager
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
-	"regexp"
 	"strings"
 
+	"github.com/Masterminds/semver"
 	"github.com/bmatcuk/doublestar/v4"
 	"github.com/software-t-rex/packageJson"
 )
@@ -49,60 +54,60 @@ type PackageManager struct {
 	// should be passed through to the underlying script.
 	ArgSeparator []string
 
-	// Return the list of workspace glob
-	getWorkspaceGlobs func(rootpath string) ([]string, error)
+	// The version of the Package Manager used by the project, nil when it could not be resolved.
+	// When resolved from a lockfile it is the lowest version writing that lockfile format.
+	Version *semver.Version
 
-	// Return the list of workspace ignore globs
-	getWorkspaceIgnores func(pm PackageManager, rootpath string) ([]string, error)
+	// The order in which package managers are tried during detection, higher first.
+	Priority int
 
-	// Detect if Turbo knows how to produce a pruned workspace for the project
-	canPrune func(cwd string) (bool, error)
+	// The implementation of the Package Manager specific parts.
+	Behavior Behavior
 
-	// Test a manager and version tuple to see if it is the Package Manager.
-	Matches func(manager string, version string) (bool, error)
-
-	// Detect if the project is using the Package Manager by inspecting the system.
-	detect func(projectDirectory string, packageManager *PackageManager) (bool, error)
-
-	// @FIXME missing Lockfile support
-	// Read a lockfile for a given package manager
-	// UnmarshalLockfile func(contents []byte) (lockfile.Lockfile, error)
-
-	// Prune the given pkgJSON to only include references to the given patches
-	prunePatches func(pkgJSON *packageJson.PackageJSON, patches []string) error
+	// The Runner used to run the Package Manager commands, an OSRunner when nil.
+	Runner Runner
 }
 
-var packageManagers = []PackageManager{
-	nodejsYarn,
-	nodejsBerry,
-	nodejsNpm,
-	nodejsPnpm,
-	nodejsPnpm6,
-}
-
-var (
-	packageManagerPattern = `(npm|pnpm|yarn)@(\d+)\.\d+\.\d+(-.+)?`
-	packageManagerRegex   = regexp.MustCompile(packageManagerPattern)
-)
-
 // ParsePackageManagerString takes a package manager version string parses it into consituent components
+// Any corepack integrity hash is ignored, use ParsePackageManagerSpec to retrieve it.
 func ParsePackageManagerString(packageManager string) (manager string, version string, err error) {
-	match := packageManagerRegex.FindString(packageManager)
-	if len(match) == 0 {
-		return "", "", fmt.Errorf("we could not parse packageManager field in package.json, expected: %s, received: %s", packageManagerPattern, packageManager)
+	spec, err := ParsePackageManagerSpec(packageManager)
+	if err != nil {
+		return "", "", err
+	}
+	if spec.Version == "" {
+		return "", "", &ParseError{
+			File: "package.json",
+			Err:  fmt.Errorf("we could not infer the version of %s from %s", spec.Name, spec.URL),
+		}
 	}
 
-	return strings.Split(match, "@")[0], strings.Split(match, "@")[1], nil
+	return spec.Name, spec.Version, nil
 }
 
 // GetPackageManager attempts all methods for identifying the package manager in use.
 func GetPackageManager(projectDirectory string, pkg *packageJson.PackageJSON) (packageManager *PackageManager, err error) {
+	return GetPackageManagerContext(context.Background(), projectDirectory, pkg)
+}
+
+// GetPackageManagerContext is the same as GetPackageManager, ctx bounding any command it runs.
+func GetPackageManagerContext(ctx context.Context, projectDirectory string, pkg *packageJson.PackageJSON) (packageManager *PackageManager, err error) {
 	result, _ := GetPackageManagerFromString(pkg.PackageManager)
 	if result != nil {
 		return result, nil
 	}
 
-	return DetectPackageManager(projectDirectory)
+	return DetectPackageManagerContext(ctx, projectDirectory)
+}
+
+// GetPackageManagerFS is the same as GetPackageManager for a project stored in fsys.
+func GetPackageManagerFS(fsys fs.FS, pkg *packageJson.PackageJSON) (packageManager *PackageManager, err error) {
+	result, _ := GetPackageManagerFromString(pkg.PackageManager)
+	if result != nil {
+		return result, nil
+	}
+
+	return DetectPackageManagerFS(fsys)
 }
 
 func GetPackageManagerFromString(packageManagerStr string) (packageManager *PackageManager, err error) {
@@ -113,125 +118,393 @@ func GetPackageManagerFromString(packageManagerStr string) (packageManager *Pack
 	if err != nil {
 		return nil, err
 	}
-	for _, packageManager := range packageManagers {
+	for _, packageManager := range RegisteredPackageManagers() {
 		isResponsible, err := packageManager.Matches(manager, version)
 		if isResponsible && (err == nil) {
-			return &packageManager, nil
+			return packageManager.WithVersion(version)
 		}
 	}
 	return nil, fmt.Errorf("we didn't find a matching package manager for '%s'", packageManagerStr)
 }
 
-// detectPackageManager attempts to detect the package manager by inspecting the project directory state.
+// DetectPackageManager attempts to detect the package manager by inspecting the project directory state.
+// The version of the returned package manager is resolved from the lockfile when possible,
+// falling back to the output of `<command> --version` in the project directory.
 func DetectPackageManager(projectDirectory string) (packageManager *PackageManager, err error) {
-	for _, packageManager := range packageManagers {
-		isResponsible, err := packageManager.detect(projectDirectory, &packageManager)
+	return DetectPackageManagerContext(context.Background(), projectDirectory)
+}
+
+// DetectPackageManagerContext is the same as DetectPackageManager, ctx bounding any command it runs.
+func DetectPackageManagerContext(ctx context.Context, projectDirectory string) (packageManager *PackageManager, err error) {
+	packageManager, err = DetectPackageManagerFS(os.DirFS(projectDirectory))
+	if err != nil {
+		return nil, err
+	}
+	if packageManager.Version == nil {
+		// not being able to tell the version is not a detection failure,
+		// and the installed version only counts if it's consistent with what we detected
+		version, err := packageManager.getVersion(ctx, projectDirectory)
+		if matches, _ := packageManager.Matches(packageManager.Slug, version); err == nil && matches {
+			packageManager.Version, _ = semver.NewVersion(version)
+			packageManager.resolveArgSeparator()
+		}
+	}
+	return packageManager, nil
+}
+
+// DetectPackageManagerFS attempts to detect the package manager by inspecting the
+// state of the project stored at the root of fsys.
+// The version of the returned package manager is resolved from the lockfile and
+// is nil when it can't be.
+func DetectPackageManagerFS(fsys fs.FS) (packageManager *PackageManager, err error) {
+	for _, packageManager := range RegisteredPackageManagers() {
+		isResponsible, err := packageManager.Behavior.Detect(fsys, &packageManager)
 		if err != nil {
 			return nil, err
 		}
 		if isResponsible {
+			packageManager.resolveArgSeparator()
 			return &packageManager, nil
 		}
 	}
 
-	return nil, fmt.Errorf("we did not detect an in-use package manager for your project. Please set the \"packageManager\" property in your root package.json (https://nodejs.org/api/packages.html#packagemanager)")
+	return nil, fmt.Errorf("%w. Please set the \"packageManager\" property in your root package.json (https://nodejs.org/api/packages.html#packagemanager)", ErrNoPackageManager)
 }
 
 // GetWorkspaces returns the list of package.json files for the current mono[space|repo].
 func (pm PackageManager) GetWorkspaces(rootpath string, relativePath bool) ([]string, error) {
-	globs, err := pm.getWorkspaceGlobs(rootpath)
+	res, err := pm.GetWorkspacesFS(os.DirFS(rootpath))
+	if err != nil {
+		return nil, err
+	}
+
+	// make res fullpath
+	if !relativePath {
+		for i, workspace := range res {
+			res[i] = filepath.Join(rootpath, workspace)
+		}
+	}
+
+	return res, nil
+}
+
+// GetWorkspacesFS returns the list of package.json files for the mono[space|repo]
+// stored at the root of fsys. Returned paths are relative to the root of fsys.
+func (pm PackageManager) GetWorkspacesFS(fsys fs.FS) ([]string, error) {
+	globs, err := pm.Behavior.WorkspaceGlobs(fsys)
 	if err != nil {
 		return nil, err
 	}
 
 	justJsons := make([]string, len(globs))
 	for i, space := range globs {
-		justJsons[i] = filepath.Join(space, "package.json")
+		justJsons[i] = path.Join(space, "package.json")
 	}
 
-	ignores, err := pm.getWorkspaceIgnores(pm, rootpath)
+	ignores, err := pm.Behavior.WorkspaceIgnores(pm, fsys)
 	if err != nil {
 		return nil, err
 	}
 
 	// f, err := globby.GlobFiles(rootpath, justJsons, ignores)
-	fs := os.DirFS(rootpath)
 	var res []string
 	for _, glob := range justJsons {
-		founds, err := doublestar.Glob(fs, glob)
+		founds, err := doublestar.Glob(fsys, glob)
 		if err != nil {
 			return nil, err
 		}
 		res = append(res, founds...)
 	}
 	for _, glob := range ignores {
-		for i, path := range res {
-			match, err := doublestar.Match(path, glob)
+		kept := res[:0]
+		for _, workspace := range res {
+			match, err := doublestar.Match(glob, workspace)
 			if err != nil {
 				return nil, err
 			}
-			if match {
-				res = append(res[:i], res[i+1:]...)
+			if !match {
+				kept = append(kept, workspace)
 			}
 		}
+		res = kept
 	}
 
-	// make res fullpath
-	if !relativePath {
-		for i, path := range res {
-			res[i] = filepath.Join(rootpath, path)
+	return res, nil
+}
+
+// WorkspaceForPath returns the directory of the innermost workspace containing file.
+// Symlinks are resolved before comparison, so a file reached through a linked
+// directory maps to the workspace it really lives in. Files that don't belong to
+// any workspace (including files outside of rootpath) resolve to rootpath itself.
+// A relative file is considered relative to rootpath.
+func (pm PackageManager) WorkspaceForPath(rootpath string, file string) (string, error) {
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(rootpath, file)
+	}
+	target, err := realPath(file)
+	if err != nil {
+		return "", err
+	}
+
+	workspaces, err := pm.GetWorkspaces(rootpath, false)
+	if err != nil {
+		return "", err
+	}
+
+	owner := rootpath
+	ownerDepth := -1
+	for _, workspace := range workspaces {
+		dir := filepath.Dir(workspace)
+		realDir, err := realPath(dir)
+		if err != nil {
+			return "", err
+		}
+		rel, err := filepath.Rel(realDir, target)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		// the deepest directory containing the file is the innermost workspace
+		if depth := strings.Count(realDir, string(filepath.Separator)); depth > ownerDepth {
+			owner = dir
+			ownerDepth = depth
 		}
 	}
 
-	return res, nil
+	return owner, nil
+}
+
+// realPath returns the absolute path with symlinks evaluated. The path doesn't
+// need to exist, in which case its deepest existing parent is evaluated.
+func realPath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	existing := path
+	missing := ""
+	for !PathExists(existing) {
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return path, nil
+		}
+		missing = filepath.Join(filepath.Base(existing), missing)
+		existing = parent
+	}
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(resolved, missing), nil
+}
+
+// WorkspaceForPathFS is the same as WorkspaceForPath for a project stored in fsys.
+// file must be relative to the root of fsys, symlinks are not resolved.
+func (pm PackageManager) WorkspaceForPathFS(fsys fs.FS, file string) (string, error) {
+	workspaces, err := pm.GetWorkspacesFS(fsys)
+	if err != nil {
+		return "", err
+	}
+
+	file = path.Clean(file)
+	owner := "."
+	for _, workspace := range workspaces {
+		dir := path.Dir(workspace)
+		if (file == dir || strings.HasPrefix(file, dir+"/")) && len(dir) > len(owner) {
+			owner = dir
+		}
+	}
+
+	return owner, nil
 }
 
 // GetWorkspaceIgnores returns an array of globs not to search for workspaces.
 func (pm PackageManager) GetWorkspaceIgnores(rootpath string) ([]string, error) {
-	return pm.getWorkspaceIgnores(pm, rootpath)
+	return pm.GetWorkspaceIgnoresFS(os.DirFS(rootpath))
+}
+
+// GetWorkspaceIgnoresFS returns an array of globs not to search for workspaces
+// in the project stored at the root of fsys.
+func (pm PackageManager) GetWorkspaceIgnoresFS(fsys fs.FS) ([]string, error) {
+	return pm.Behavior.WorkspaceIgnores(pm, fsys)
 }
 
 // CanPrune returns if we can produce a pruned workspace. Can error if fs issues occur
 func (pm PackageManager) CanPrune(projectDirectory string) (bool, error) {
-	if pm.canPrune != nil {
-		return pm.canPrune(projectDirectory)
+	return pm.CanPruneFS(os.DirFS(projectDirectory))
+}
+
+// CanPruneFS returns if we can produce a pruned workspace for the project stored at the root of fsys.
+// An UnsupportedConfigError returned by the Behavior without a Manager is attributed to pm.
+func (pm PackageManager) CanPruneFS(fsys fs.FS) (bool, error) {
+	canPrune, err := pm.Behavior.CanPrune(fsys)
+	var unsupported *UnsupportedConfigError
+	if errors.As(err, &unsupported) && unsupported.Manager == "" {
+		unsupported.Manager = pm.Name
 	}
-	return false, nil
+	return canPrune, err
+}
+
+// ReadLockfile will read the applicable lockfile into memory.
+// It returns nil when the package manager lockfile is not supported.
+func (pm PackageManager) ReadLockfile(projectDirectory string) (*Lockfile, error) {
+	return pm.ReadLockfileFS(os.DirFS(projectDirectory))
+}
+
+// ReadLockfileFS reads the lockfile of the project stored at the root of fsys.
+// It returns nil when the package manager lockfile is not supported.
+// Workspaces missing from the lockfile (yarn classic, npm v1) are inferred from the package.json files,
+// see LockfileImporter.Inferred.
+func (pm PackageManager) ReadLockfileFS(fsys fs.FS) (*Lockfile, error) {
+	if _, ok := pm.Behavior.(LockfileUnmarshaler); !ok {
+		return nil, nil
+	}
+	if behavior, ok := pm.Behavior.(BehaviorFuncs); ok && behavior.UnmarshalLockfileFunc == nil {
+		return nil, nil
+	}
+	contents, err := fs.ReadFile(fsys, pm.Lockfile)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", pm.Lockfile, err)
+	}
+	lockfile, err := pm.UnmarshalLockfile(contents)
+	if err != nil || lockfile == nil || len(lockfile.Importers) > 0 {
+		return lockfile, err
+	}
+	if err := pm.inferLockfileImporters(fsys, lockfile); err != nil {
+		return nil, err
+	}
+	return lockfile, nil
+}
+
+// UnmarshalLockfile reads lockfile contents written by the package manager.
+// It returns nil when the package manager lockfile is not supported.
+func (pm PackageManager) UnmarshalLockfile(contents []byte) (*Lockfile, error) {
+	unmarshaler, ok := pm.Behavior.(LockfileUnmarshaler)
+	if !ok {
+		return nil, nil
+	}
+	lockfile, err := unmarshaler.UnmarshalLockfile(contents)
+	if err != nil {
+		var parseErr *ParseError
+		var unsupportedErr *UnsupportedConfigError
+		if errors.As(err, &parseErr) || errors.As(err, &unsupportedErr) {
+			return nil, err
+		}
+		return nil, &ParseError{File: pm.Lockfile, Err: err}
+	}
+	if lockfile != nil {
+		lockfile.Manager = pm.Name
+	}
+	return lockfile, nil
+}
+
+// MarshalLockfile returns the contents of the lockfile written by the package manager,
+// keeping the resolved versions and integrity of the packages.
+// It returns an UnsupportedConfigError when the package manager lockfile can't be written.
+func (pm PackageManager) MarshalLockfile(lockfile *Lockfile) ([]byte, error) {
+	var contents []byte
+	var err error
+	if marshaler, ok := pm.Behavior.(LockfileMarshaler); ok {
+		contents, err = marshaler.MarshalLockfile(lockfile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if contents == nil {
+		return nil, &UnsupportedConfigError{Manager: pm.Name, Reason: "writing the lockfile is not supported"}
+	}
+	return contents, nil
+}
+
+// PrunePatchedPackages will alter the provided pkgJSON to only reference the provided patches.
+// Missing sections are left untouched, the returned summary lists the removed references.
+func (pm PackageManager) PrunePatchedPackages(pkgJSON *packageJson.PackageJSON, patches []string) (*PruneSummary, error) {
+	return pm.Behavior.PrunePatches(pkgJSON, patches)
+}
+
+// PruneWorkspaceConfigurationPatches returns the contents of the workspace configuration
+// (WorkspaceConfigurationPath) only referencing the provided patches. Contents are returned
+// unchanged when the package manager doesn't declare patches in its workspace configuration.
+func (pm PackageManager) PruneWorkspaceConfigurationPatches(contents []byte, patches []string) ([]byte, *PruneSummary, error) {
+	pruner, ok := pm.Behavior.(WorkspaceConfigurationPatchPruner)
+	if !ok {
+		return contents, &PruneSummary{}, nil
+	}
+	return pruner.PruneWorkspaceConfigurationPatches(contents, patches)
+}
+
+// PruneLockfilePatches returns the lockfile contents only referencing the provided patches.
+// Contents are returned unchanged when the package manager doesn't record patches in its lockfile.
+func (pm PackageManager) PruneLockfilePatches(contents []byte, patches []string) ([]byte, error) {
+	pruner, ok := pm.Behavior.(LockfilePatchPruner)
+	if !ok {
+		return contents, nil
+	}
+	pruned, err := pruner.PruneLockfilePatches(contents, patches)
+	if err != nil {
+		return nil, &ParseError{File: pm.Lockfile, Err: err}
+	}
+	return pruned, nil
 }
 
-// @FIXME missing lockfile support
-// ReadLockfile will read the applicable lockfile into memory
-// func (pm PackageManager) ReadLockfile(projectDirectory string) (lockfile.Lockfile, error) {
-// 	if pm.UnmarshalLockfile == nil {
-// 		return nil, nil
-// 	}
-// 	contents, err := os.ReadFile(filepath.Join(projectDirectory, pm.Lockfile))
-// 	if err != nil {
-// 		return nil, fmt.Errorf("reading %s: %w", pm.Lockfile, err)
-// 	}
-// 	return pm.UnmarshalLockfile(contents)
-// }
+// WithVersion returns a copy of the package manager resolved for the given version.
+func (pm PackageManager) WithVersion(version string) (*PackageManager, error) {
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s version: %w", pm.Name, err)
+	}
+	pm.Version = v
+	pm.resolveArgSeparator()
+	return &pm, nil
+}
+
+// Matches tests a manager and version tuple to see if it is the Package Manager.
+func (pm PackageManager) Matches(manager string, version string) (bool, error) {
+	return pm.Behavior.Matches(manager, version)
+}
 
-// PrunePatchedPackages will alter the provided pkgJSON to only reference the provided patches
-func (pm PackageManager) PrunePatchedPackages(pkgJSON *packageJson.PackageJSON, patches []string) error {
-	if pm.prunePatches != nil {
-		return pm.prunePatches(pkgJSON, patches)
+func (pm *PackageManager) resolveArgSeparator() {
+	if separator, ok := pm.Behavior.ArgSeparator(pm.Version); ok {
+		pm.ArgSeparator = separator
 	}
-	return nil
 }
 
+// GetVersion returns the version of the package manager installed on the system.
+// It may differ from the Version used by the project.
 func (pm PackageManager) GetVersion() (string, error) {
-	cmd := exec.Command(pm.Command, "--version")
-	out, err := cmd.Output()
+	return pm.GetVersionContext(context.Background())
+}
+
+// GetVersionContext is the same as GetVersion, ctx bounding the command it runs.
+func (pm PackageManager) GetVersionContext(ctx context.Context) (string, error) {
+	return pm.getVersion(ctx, "")
+}
+
+func (pm PackageManager) getVersion(ctx context.Context, dir string) (string, error) {
+	result, err := pm.runner().Run(ctx, dir, []string{pm.Command, "--version"}, nil)
 	if err != nil {
 		return "", fmt.Errorf("could not detect %s version: %w", pm.Name, err)
 	}
-	return strings.TrimSpace(string(out)), nil
+	if result.ExitCode != 0 {
+		return "", fmt.Errorf("could not detect %s version: exit code %d: %s", pm.Name, result.ExitCode, bytes.TrimSpace(result.Stderr))
+	}
+	return strings.TrimSpace(string(result.Stdout)), nil
+}
+
+func (pm PackageManager) runner() Runner {
+	if pm.Runner != nil {
+		return pm.Runner
+	}
+	return OSRunner{}
 }
 
 // Same as GetVersion but remove any +suffix
 func (pm PackageManager) GetStandardVersion() (string, error) {
-	version, error := pm.GetVersion()
+	return pm.GetStandardVersionContext(context.Background())
+}
+
+// GetStandardVersionContext is the same as GetStandardVersion, ctx bounding the command it runs.
+func (pm PackageManager) GetStandardVersionContext(ctx context.Context) (string, error) {
+	version, error := pm.GetVersionContext(ctx)
 	return strings.Split(version, "+")[0], error
 }
 
@@ -240,6 +513,49 @@ type YarnRC struct {
 	NodeLinker string `yaml:"nodeLinker"`
 }
 
+// readPackageJSON reads the package.json at name in fsys
+func readPackageJSON(fsys fs.FS, name string) (*packageJson.PackageJSON, error) {
+	content, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	pkg := &packageJson.PackageJSON{}
+	if err := json.Unmarshal(content, pkg); err != nil {
+		return nil, &ParseError{File: name, Line: jsonErrorLine(content, err), Err: err}
+	}
+	return pkg, nil
+}
+
+// jsonErrorLine returns the line at which a json decoding error occurred, 0 when unknown
+func jsonErrorLine(content []byte, err error) int {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) {
+		offset = syntaxErr.Offset
+	} else if errors.As(err, &typeErr) {
+		offset = typeErr.Offset
+	} else {
+		return 0
+	}
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+	return bytes.Count(content[:offset], []byte("\n")) + 1
+}
+
+// readPackageJSONWorkspaces returns the workspaces globs defined in the root package.json
+func readPackageJSONWorkspaces(fsys fs.FS, tool string) ([]string, error) {
+	pkg, err := readPackageJSON(fsys, "package.json")
+	if err != nil {
+		return nil, err
+	}
+	if len(pkg.Workspaces) == 0 {
+		return nil, fmt.Errorf("package.json: %w. packagemanager requires %s workspaces to be defined in the root package.json", ErrNoWorkspaces, tool)
+	}
+	return pkg.Workspaces, nil
+}
+
 func FileExists(path string) bool {
 	info, err := os.Lstat(path)
 	return err == nil && !info.IsDir()
@@ -250,40 +566,63 @@ func PathExists(path string) bool {
 	return err == nil
 }
 
-func hasFile(name, dir string) (bool, error) {
-	files, err := os.ReadDir(dir)
+// FileExistsFS is the same as FileExists for a name in fsys.
+func FileExistsFS(fsys fs.FS, name string) bool {
+	info, err := fs.Stat(fsys, name)
+	return err == nil && !info.IsDir()
+}
 
+func FindupFrom(name, dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
 	if err != nil {
-		return false, err
+		return "", err
 	}
-
-	for _, f := range files {
-		if name == f.Name() {
-			return true, nil
-		}
+	root := filepath.VolumeName(dir) + string(filepath.Separator)
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return "", err
 	}
-
-	return false, nil
+	found, err := FindupFromFS(os.DirFS(root), name, filepath.ToSlash(rel))
+	if err != nil || found == "" {
+		return "", err
+	}
+	return filepath.Join(root, filepath.FromSlash(found)), nil
 }
 
-func FindupFrom(name, dir string) (string, error) {
+// FindupFromFS searches for name in dir and its parents up to the root of fsys.
+// It returns the path of the first match relative to the root of fsys, or an empty string.
+func FindupFromFS(fsys fs.FS, name, dir string) (string, error) {
 	for {
-		found, err := hasFile(name, dir)
+		found, err := hasFile(fsys, name, dir)
 
 		if err != nil {
 			return "", err
 		}
 
 		if found {
-			return filepath.Join(dir, name), nil
+			return path.Join(dir, name), nil
 		}
 
-		parent := filepath.Dir(dir)
-
-		if parent == dir {
+		if dir == "." {
 			return "", nil
 		}
 
-		dir = parent
+		dir = path.Dir(dir)
 	}
 }
+
+func hasFile(fsys fs.FS, name, dir string) (bool, error) {
+	files, err := fs.ReadDir(fsys, dir)
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, f := range files {
+		if name == f.Name() {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
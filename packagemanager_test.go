@@ -1,11 +1,13 @@
 package packagemanager
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"reflect"
 	"sort"
 	"testing"
+	"testing/fstest"
 
 	"github.com/software-t-rex/packageJson"
 
@@ -83,6 +85,27 @@ func TestParsePackageManagerString(t *testing.T) {
 			wantVersion:    "111.0.1",
 			wantErr:        false,
 		},
+		{
+			name:           "strips corepack integrity hash",
+			packageManager: "pnpm@8.6.0+sha256.0e8ba39a9a9d7ae1da3e11c1f01c2b1a6e0bf2ba0ebd0a3ff5fbbc1fb4c2e5b3",
+			wantManager:    "pnpm",
+			wantVersion:    "8.6.0",
+			wantErr:        false,
+		},
+		{
+			name:           "infers version from corepack url",
+			packageManager: "yarn@https://registry.npmjs.org/@yarnpkg/cli-dist/-/cli-dist-3.2.3.tgz#sha224.16a0797d1710d1fb7ec40ab5c3801b68370a612a9b66ba117ad9924b",
+			wantManager:    "yarn",
+			wantVersion:    "3.2.3",
+			wantErr:        false,
+		},
+		{
+			name:           "errors with an url without version",
+			packageManager: "yarn@https://example.com/yarn.tgz",
+			wantManager:    "",
+			wantVersion:    "",
+			wantErr:        true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -122,7 +145,7 @@ func TestGetPackageManager(t *testing.T) {
 			name:             "finds pnpm6 from a package manager string",
 			projectDirectory: cwd,
 			pkg:              &packageJson.PackageJSON{PackageManager: "pnpm@1.2.3"},
-			want:             "nodejs-pnpm6",
+			want:             "nodejs-pnpm",
 			wantErr:          false,
 		},
 		{
@@ -177,7 +200,7 @@ func Test_GetPackageManagerFromString(t *testing.T) {
 		{
 			name:       "finds pnpm6 from a package manager string",
 			pkgMngrStr: "pnpm@1.2.3",
-			want:       "nodejs-pnpm6",
+			want:       "nodejs-pnpm",
 			wantErr:    false,
 		},
 		{
@@ -229,7 +252,6 @@ func Test_GetWorkspaces(t *testing.T) {
 		"nodejs-berry": filepath.Join(cwd, "testdata/with-yarn"),
 		"nodejs-yarn":  filepath.Join(cwd, "testdata/with-yarn"),
 		"nodejs-pnpm":  filepath.Join(cwd, "testdata/basic"),
-		"nodejs-pnpm6": filepath.Join(cwd, "testdata/basic"),
 	}
 
 	want := map[string][]string{
@@ -261,13 +283,6 @@ func Test_GetWorkspaces(t *testing.T) {
 			filepath.ToSlash(filepath.Join(cwd, "testdata/basic/packages/tsconfig/package.json")),
 			filepath.ToSlash(filepath.Join(cwd, "testdata/basic/packages/ui/package.json")),
 		},
-		"nodejs-pnpm6": {
-			filepath.ToSlash(filepath.Join(cwd, "testdata/basic/apps/docs/package.json")),
-			filepath.ToSlash(filepath.Join(cwd, "testdata/basic/apps/web/package.json")),
-			filepath.ToSlash(filepath.Join(cwd, "testdata/basic/packages/eslint-config-custom/package.json")),
-			filepath.ToSlash(filepath.Join(cwd, "testdata/basic/packages/tsconfig/package.json")),
-			filepath.ToSlash(filepath.Join(cwd, "testdata/basic/packages/ui/package.json")),
-		},
 	}
 
 	tests := make([]test, len(packageManagers))
@@ -301,6 +316,22 @@ func Test_GetWorkspaces(t *testing.T) {
 	}
 }
 
+func Test_GetWorkspacesFS_ignores(t *testing.T) {
+	// adjacent ignored workspaces must all be dropped
+	fsys := fstest.MapFS{
+		"package.json":                              {Data: []byte(`{"workspaces": ["packages/**"]}`)},
+		"packages/a/package.json":                   {Data: []byte(`{"name": "a"}`)},
+		"packages/a/node_modules/b/package.json":    {Data: []byte(`{"name": "b"}`)},
+		"packages/a/node_modules/c/package.json":    {Data: []byte(`{"name": "c"}`)},
+		"packages/d/package.json":                   {Data: []byte(`{"name": "d"}`)},
+		"packages/d/node_modules/@e/f/package.json": {Data: []byte(`{"name": "@e/f"}`)},
+	}
+	workspaces, err := nodejsNpm.GetWorkspacesFS(fsys)
+	assert.NilError(t, err)
+	sort.Strings(workspaces)
+	assert.DeepEqual(t, workspaces, []string{"packages/a/package.json", "packages/d/package.json"})
+}
+
 func Test_GetWorkspaceIgnores(t *testing.T) {
 	type test struct {
 		name     string
@@ -317,7 +348,6 @@ func Test_GetWorkspaceIgnores(t *testing.T) {
 		"nodejs-berry": {"**/node_modules", "**/.git", "**/.yarn"},
 		"nodejs-yarn":  {"apps/*/node_modules/**", "packages/*/node_modules/**"},
 		"nodejs-pnpm":  {"**/node_modules/**", "**/bower_components/**", "packages/skip"},
-		"nodejs-pnpm6": {"**/node_modules/**", "**/bower_components/**", "packages/skip"},
 	}
 
 	tests := make([]test, len(packageManagers))
@@ -372,7 +402,6 @@ func Test_CanPrune(t *testing.T) {
 		"nodejs-berry": {false, true},
 		"nodejs-yarn":  {true, false},
 		"nodejs-pnpm":  {true, false},
-		"nodejs-pnpm6": {true, false},
 	}
 
 	tests := make([]test, len(packageManagers))
@@ -400,3 +429,248 @@ func Test_CanPrune(t *testing.T) {
 		})
 	}
 }
+
+func Test_WorkspaceForPath(t *testing.T) {
+	cwd, err := os.Getwd()
+	assert.NilError(t, err, "os.Getwd")
+	rootPath := filepath.Join(cwd, "testdata/basic")
+
+	// nested workspaces and symlinks are setup in a temporary directory
+	nestedRoot := t.TempDir()
+	writeFiles(t, nestedRoot, map[string]string{
+		"package.json":                           `{"name": "root"}`,
+		"pnpm-workspace.yaml":                    "packages:\n  - \"packages/**\"\n",
+		"packages/a/package.json":                `{"name": "a"}`,
+		"packages/a/nested/package.json":         `{"name": "nested"}`,
+		"packages/a/nested/src/index.js":         "",
+		"packages/a/src/index.js":                "",
+		"packages/a/node_modules/b/index.js":     "",
+		"packages/a/node_modules/b/package.json": `{"name": "b"}`,
+	})
+	linkDir := t.TempDir()
+	err = os.Symlink(filepath.Join(nestedRoot, "packages/a/nested"), filepath.Join(linkDir, "link"))
+	assert.NilError(t, err, "os.Symlink")
+
+	tests := []struct {
+		name     string
+		rootPath string
+		file     string
+		want     string
+	}{
+		{"file in a workspace", rootPath, filepath.Join(rootPath, "apps/web/package.json"), filepath.Join(rootPath, "apps/web")},
+		{"missing file in a workspace", rootPath, filepath.Join(rootPath, "apps/web/pages/index.tsx"), filepath.Join(rootPath, "apps/web")},
+		{"relative file", rootPath, "packages/ui/index.tsx", filepath.Join(rootPath, "packages/ui")},
+		{"file at root", rootPath, filepath.Join(rootPath, "package.json"), rootPath},
+		{"file outside root", rootPath, filepath.Join(cwd, "go.mod"), rootPath},
+		{"innermost workspace", nestedRoot, filepath.Join(nestedRoot, "packages/a/nested/src/index.js"), filepath.Join(nestedRoot, "packages/a/nested")},
+		{"outer workspace", nestedRoot, filepath.Join(nestedRoot, "packages/a/src/index.js"), filepath.Join(nestedRoot, "packages/a")},
+		{"ignored directories", nestedRoot, filepath.Join(nestedRoot, "packages/a/node_modules/b/index.js"), filepath.Join(nestedRoot, "packages/a")},
+		{"symlinked file", nestedRoot, filepath.Join(linkDir, "link/src/index.js"), filepath.Join(nestedRoot, "packages/a/nested")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := nodejsPnpm.WorkspaceForPath(tt.rootPath, tt.file)
+			assert.NilError(t, err)
+			assert.Equal(t, filepath.ToSlash(got), filepath.ToSlash(tt.want))
+		})
+	}
+}
+
+// writeFiles creates the given files relative to root
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		assert.NilError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NilError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+}
+
+func Test_StructuredErrors(t *testing.T) {
+	cwd, err := os.Getwd()
+	assert.NilError(t, err, "os.Getwd")
+
+	var parseErr *ParseError
+	var unsupportedErr *UnsupportedConfigError
+
+	_, _, err = ParsePackageManagerString("npm@latest")
+	assert.Assert(t, errors.As(err, &parseErr), "ParsePackageManagerString() error = %v", err)
+	assert.Equal(t, parseErr.File, "package.json")
+
+	_, err = DetectPackageManager(t.TempDir())
+	assert.Assert(t, errors.Is(err, ErrNoPackageManager), "DetectPackageManager() error = %v", err)
+
+	_, err = nodejsNpm.GetWorkspaces(filepath.Join(cwd, "testdata/basic"), false)
+	assert.Assert(t, errors.Is(err, ErrNoWorkspaces), "GetWorkspaces() error = %v", err)
+
+	invalidRoot := t.TempDir()
+	writeFiles(t, invalidRoot, map[string]string{
+		".yarnrc.yml":         "nodeLinker: node-modules\nnodeLinker: pnp\n",
+		"pnpm-workspace.yaml": "packages:\n  - \"apps/*\n",
+	})
+	_, err = isNMLinker(os.DirFS(invalidRoot))
+	assert.Assert(t, errors.As(err, &parseErr), "isNMLinker() error = %v", err)
+	assert.Equal(t, parseErr.File, ".yarnrc.yml")
+	assert.Equal(t, parseErr.Line, 2)
+	_, err = nodejsPnpm.GetWorkspaces(invalidRoot, false)
+	assert.Assert(t, errors.As(err, &parseErr), "GetWorkspaces() error = %v", err)
+	assert.Equal(t, parseErr.File, "pnpm-workspace.yaml")
+
+	pnpRoot := t.TempDir()
+	writeFiles(t, pnpRoot, map[string]string{".yarnrc.yml": "nodeLinker: pnp\n"})
+	_, err = nodejsBerry.CanPrune(pnpRoot)
+	assert.Assert(t, errors.As(err, &unsupportedErr), "CanPrune() error = %v", err)
+	assert.Equal(t, unsupportedErr.Manager, "nodejs-berry")
+	renamed := nodejsBerry
+	renamed.Name = "custom-berry"
+	_, err = renamed.CanPrune(pnpRoot)
+	assert.Assert(t, errors.As(err, &unsupportedErr), "CanPrune() error = %v", err)
+	assert.Equal(t, unsupportedErr.Manager, "custom-berry")
+}
+
+func Test_PackageManagerVersion(t *testing.T) {
+	cwd, err := os.Getwd()
+	assert.NilError(t, err, "os.Getwd")
+
+	fromString := []struct {
+		pkgMngrStr       string
+		wantVersion      string
+		wantArgSeparator []string
+	}{
+		{"pnpm@6.32.0", "6.32.0", []string{"--"}},
+		{"pnpm@8.6.0+sha256.abc", "8.6.0", nil},
+		{"npm@9.1.0", "9.1.0", []string{"--"}},
+		{"yarn@1.22.19", "1.22.19", []string{"--"}},
+	}
+	for _, tt := range fromString {
+		t.Run(tt.pkgMngrStr, func(t *testing.T) {
+			pm, err := GetPackageManagerFromString(tt.pkgMngrStr)
+			assert.NilError(t, err)
+			assert.Equal(t, pm.Version.String(), tt.wantVersion)
+			assert.DeepEqual(t, pm.ArgSeparator, tt.wantArgSeparator)
+		})
+	}
+
+	fromLockfile := []struct {
+		name             string
+		files            map[string]string
+		wantName         string
+		wantVersion      string
+		wantArgSeparator []string
+	}{
+		{
+			name:             "pnpm 6 lockfile",
+			files:            map[string]string{"package.json": "{}", "pnpm-lock.yaml": "lockfileVersion: 5.3\n"},
+			wantName:         "nodejs-pnpm",
+			wantVersion:      "6.0.0",
+			wantArgSeparator: []string{"--"},
+		},
+		{
+			name:        "pnpm 8 lockfile",
+			files:       map[string]string{"package.json": "{}", "pnpm-lock.yaml": "lockfileVersion: '6.0'\n"},
+			wantName:    "nodejs-pnpm",
+			wantVersion: "8.0.0",
+		},
+		{
+			name:             "npm 7 lockfile",
+			files:            map[string]string{"package.json": "{}", "package-lock.json": `{"lockfileVersion": 2}`},
+			wantName:         "nodejs-npm",
+			wantVersion:      "7.0.0",
+			wantArgSeparator: []string{"--"},
+		},
+	}
+	for _, tt := range fromLockfile {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFiles(t, root, tt.files)
+			pm, err := DetectPackageManager(root)
+			assert.NilError(t, err)
+			assert.Equal(t, pm.Name, tt.wantName)
+			assert.Equal(t, pm.Version.String(), tt.wantVersion)
+			assert.DeepEqual(t, pm.ArgSeparator, tt.wantArgSeparator)
+		})
+	}
+
+	pm, err := DetectPackageManager(filepath.Join(cwd, "testdata/basic"))
+	assert.NilError(t, err)
+	assert.Equal(t, pm.Name, "nodejs-pnpm")
+	assert.Equal(t, pm.Version.String(), "7.0.0")
+}
+
+func Test_FS(t *testing.T) {
+	file := func(content string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(content)}
+	}
+	berryFS := fstest.MapFS{
+		"package.json":               file(`{"workspaces": ["apps/*", "packages/*"]}`),
+		"yarn.lock":                  file("__metadata:\n  version: 6\n  cacheKey: 8\n"),
+		".yarnrc.yml":                file("nodeLinker: node-modules\n"),
+		"apps/web/package.json":      file(`{"name": "web"}`),
+		"apps/web/src/index.ts":      file(""),
+		"packages/ui/package.json":   file(`{"name": "ui"}`),
+		"packages/ui/.yarn/a/b.json": file(""),
+	}
+	classicFS := fstest.MapFS{
+		"package.json": file(`{"workspaces": ["apps/*"]}`),
+		"yarn.lock":    file("# THIS IS AN AUTOGENERATED FILE. DO NOT EDIT THIS FILE DIRECTLY.\n# yarn lockfile v1\n"),
+	}
+	invalidFS := fstest.MapFS{
+		"package.json":      file("{\n  \"workspaces\": [\"apps/*\",]\n}"),
+		"package-lock.json": file(`{"lockfileVersion": 3}`),
+	}
+
+	pm, err := DetectPackageManagerFS(berryFS)
+	assert.NilError(t, err)
+	assert.Equal(t, pm.Name, "nodejs-berry")
+	assert.Equal(t, pm.Version.String(), "3.2.0")
+
+	workspaces, err := pm.GetWorkspacesFS(berryFS)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, workspaces, []string{"apps/web/package.json", "packages/ui/package.json"})
+
+	owner, err := pm.WorkspaceForPathFS(berryFS, "apps/web/src/index.ts")
+	assert.NilError(t, err)
+	assert.Equal(t, owner, "apps/web")
+	owner, err = pm.WorkspaceForPathFS(berryFS, "apps/webapp/index.ts")
+	assert.NilError(t, err)
+	assert.Equal(t, owner, ".")
+
+	canPrune, err := pm.CanPruneFS(berryFS)
+	assert.NilError(t, err)
+	assert.Assert(t, canPrune)
+
+	pm, err = DetectPackageManagerFS(classicFS)
+	assert.NilError(t, err)
+	assert.Equal(t, pm.Name, "nodejs-yarn")
+	assert.Assert(t, pm.Version == nil)
+
+	pm, err = DetectPackageManagerFS(invalidFS)
+	assert.NilError(t, err)
+	_, err = pm.GetWorkspacesFS(invalidFS)
+	var parseErr *ParseError
+	assert.Assert(t, errors.As(err, &parseErr), "GetWorkspacesFS() error = %v", err)
+	assert.Equal(t, parseErr.Line, 2)
+
+	found, err := FindupFromFS(berryFS, "package.json", "packages/ui/.yarn/a")
+	assert.NilError(t, err)
+	assert.Equal(t, found, "packages/ui/package.json")
+	found, err = FindupFromFS(berryFS, ".yarnrc.yml", "apps/web/src")
+	assert.NilError(t, err)
+	assert.Equal(t, found, ".yarnrc.yml")
+	found, err = FindupFromFS(berryFS, "missing.json", "apps/web/src")
+	assert.NilError(t, err)
+	assert.Equal(t, found, "")
+}
+
+func Test_FindupFrom(t *testing.T) {
+	cwd, err := os.Getwd()
+	assert.NilError(t, err, "os.Getwd")
+
+	found, err := FindupFrom("go.mod", filepath.Join(cwd, "testdata/basic/apps/web"))
+	assert.NilError(t, err)
+	assert.Equal(t, found, filepath.Join(cwd, "go.mod"))
+
+	found, err = FindupFrom("pnpm-workspace.yaml", "testdata/basic/apps/web")
+	assert.NilError(t, err)
+	assert.Equal(t, found, filepath.Join(cwd, "testdata/basic/pnpm-workspace.yaml"))
+}
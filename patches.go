@@ -0,0 +1,412 @@
+package packagemanager
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+// Patch is a patch file referenced by a project.
+type Patch struct {
+	// The name of the patched package.
+	Name string
+
+	// The version of the patched package. It may be a range for berry patches
+	// and is empty when the patch applies to every version.
+	Version string
+
+	// The path of the patch file, slash separated and relative to the project root.
+	File string
+
+	// Whether the patch file exists.
+	Exists bool
+}
+
+// ListPatches returns every patch file referenced by the project in projectDirectory.
+// Returned files are relative to projectDirectory and can be given to PrunePatchedPackages.
+func (pm PackageManager) ListPatches(projectDirectory string) ([]Patch, error) {
+	return pm.ListPatchesFS(os.DirFS(projectDirectory))
+}
+
+// ListPatchesFS returns every patch file referenced by the project stored at the root of fsys.
+// Package managers whose Behavior doesn't implement PatchLister have no patches.
+func (pm PackageManager) ListPatchesFS(fsys fs.FS) ([]Patch, error) {
+	lister, ok := pm.Behavior.(PatchLister)
+	if !ok {
+		return nil, nil
+	}
+	patches, err := lister.ListPatches(fsys)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(patches, func(i, j int) bool {
+		return patches[i].File < patches[j].File
+	})
+	return patches, nil
+}
+
+// PrunedPatch is a patch reference removed when pruning patches.
+type PrunedPatch struct {
+	// The file the reference was removed from (package.json, pnpm-workspace.yaml).
+	File string
+
+	// The field holding the reference (pnpm.patchedDependencies, resolutions, dependencies...).
+	Field string
+
+	// The dependency or resolution name.
+	Key string
+
+	// The removed value.
+	Patch string
+
+	// The value replacing the reference, empty when the reference was deleted.
+	Replacement string
+}
+
+// PruneSummary reports the patch references removed when pruning patches.
+type PruneSummary struct {
+	Removed []PrunedPatch
+}
+
+// normalizePatchPath returns a patch path stripped of its leading "./"
+func normalizePatchPath(patchPath string) string {
+	return path.Clean(strings.TrimPrefix(patchPath, "./"))
+}
+
+// pnpmListPatches lists the patchedDependencies of the pnpm settings
+func pnpmListPatches(fsys fs.FS) ([]Patch, error) {
+	settings, err := readPnpmSettingsFS(fsys)
+	if err != nil {
+		return nil, err
+	}
+	patchedDependencies := settings.PatchedDependencies
+
+	var patches []Patch
+	for _, dependency := range sortedKeys(patchedDependencies) {
+		name, version := splitDescriptor(dependency)
+		file := normalizePatchPath(patchedDependencies[dependency])
+		patches = append(patches, Patch{Name: name, Version: version, File: file, Exists: FileExistsFS(fsys, file)})
+	}
+	return patches, nil
+}
+
+// berryListPatches lists the patch files of the patch: descriptors of the project
+func berryListPatches(fsys fs.FS) ([]Patch, error) {
+	references, err := ListBerryPatches(fsys)
+	if err != nil {
+		return nil, err
+	}
+	var patches []Patch
+	seen := map[string]int{}
+	for _, reference := range references {
+		version := reference.Params.Get("version")
+		if version == "" {
+			version = strings.TrimPrefix(reference.SourceRange(), "npm:")
+		}
+		for _, patchPath := range reference.Paths {
+			if isBerryBuiltinPatch(patchPath) {
+				continue
+			}
+			file := berryPatchFile(reference, patchPath)
+			key := reference.Ident + "\x00" + file
+			if i, ok := seen[key]; ok {
+				// the lockfile knows the exact version
+				if reference.Params.Has("version") {
+					patches[i].Version = version
+				}
+				continue
+			}
+			seen[key] = len(patches)
+			patches = append(patches, Patch{Name: reference.Ident, Version: version, File: file, Exists: FileExistsFS(fsys, file)})
+		}
+	}
+	return patches, nil
+}
+
+// berryPatchFile resolves a patch path to the project root: paths are relative
+// to the workspace declaring them unless they start with "~/".
+func berryPatchFile(reference BerryPatchReference, patchPath string) string {
+	if strings.HasPrefix(patchPath, "~/") {
+		return path.Clean(patchPath[2:])
+	}
+	workspace := path.Dir(reference.File)
+	if reference.Field == "" {
+		// lockfile descriptors are bound to their workspace by the locator parameter
+		workspace = "."
+		if _, locatorRange := splitDescriptor(reference.Params.Get("locator")); strings.HasPrefix(locatorRange, "workspace:") {
+			workspace = strings.TrimPrefix(locatorRange, "workspace:")
+		}
+	}
+	return path.Join(workspace, patchPath)
+}
+
+// patchPackageDir is the default directory of patch-package (https://github.com/ds300/patch-package)
+const patchPackageDir = "patches"
+
+// patchPackageListPatches lists the patch files of the patch-package convention
+// used with npm and yarn classic: patches/<name>+<version>.patch, where scopes
+// are written @scope+name and nested packages are separated by "++".
+func patchPackageListPatches(fsys fs.FS) ([]Patch, error) {
+	entries, err := fs.ReadDir(fsys, patchPackageDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var patches []Patch
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".patch") {
+			continue
+		}
+		name, version, ok := parsePatchPackageFilename(entry.Name())
+		if !ok {
+			continue
+		}
+		patches = append(patches, Patch{Name: name, Version: version, File: path.Join(patchPackageDir, entry.Name()), Exists: true})
+	}
+	return patches, nil
+}
+
+// parsePatchPackageFilename parses names like @scope+name+1.0.0.patch, parent++child+1.0.0+dev.patch
+// or name+1.0.0+001+description.patch and returns the patched package
+func parsePatchPackageFilename(filename string) (name string, version string, ok bool) {
+	packages := strings.Split(strings.TrimSuffix(filename, ".patch"), "++")
+	parts := strings.Split(packages[len(packages)-1], "+")
+	if strings.HasPrefix(parts[0], "@") {
+		if len(parts) < 3 {
+			return "", "", false
+		}
+		parts = append([]string{parts[0] + "/" + parts[1]}, parts[2:]...)
+	}
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// PatchCheck is the result of checking a patch against the installed package.
+type PatchCheck struct {
+	Patch Patch
+
+	// The directory of the installed package, relative to the project root.
+	// It is empty when the package is not installed.
+	PackageDir string
+
+	// The hunks of the patch that don't apply to the installed package.
+	// Hunks already applied to the installed package are not failures.
+	Failures []HunkFailure
+}
+
+// Applies tells if the patch can be applied to the installed package.
+func (c PatchCheck) Applies() bool {
+	return c.PackageDir != "" && len(c.Failures) == 0
+}
+
+// HunkFailure is a hunk of a patch that doesn't apply.
+type HunkFailure struct {
+	// The patched file, relative to the package directory,
+	// or the patch file, relative to the project root, when it is missing.
+	File string
+
+	// The index of the hunk in the file diff (1-based), 0 when the whole file fails.
+	Hunk int
+
+	// The line where the hunk was expected in the original file.
+	OldStart int
+
+	Reason string
+}
+
+func (f HunkFailure) String() string {
+	if f.Hunk == 0 {
+		return fmt.Sprintf("%s: %s", f.File, f.Reason)
+	}
+	return fmt.Sprintf("%s: hunk #%d at line %d: %s", f.File, f.Hunk, f.OldStart, f.Reason)
+}
+
+// CheckPatches checks that the given patches, as returned by ListPatches, apply
+// to the packages installed in the PackageDir of projectDirectory.
+func (pm PackageManager) CheckPatches(projectDirectory string, patches []Patch) ([]PatchCheck, error) {
+	return pm.CheckPatchesFS(os.DirFS(projectDirectory), patches)
+}
+
+// CheckPatchesFS checks that the given patches apply to the packages installed
+// in the PackageDir of the project stored at the root of fsys.
+func (pm PackageManager) CheckPatchesFS(fsys fs.FS, patches []Patch) ([]PatchCheck, error) {
+	checks := make([]PatchCheck, 0, len(patches))
+	for _, patch := range patches {
+		check := PatchCheck{Patch: patch}
+		var err error
+		check.PackageDir, err = pm.installedPackageDir(fsys, patch.Name, patch.Version)
+		if err != nil {
+			return nil, err
+		}
+		content, err := fs.ReadFile(fsys, patch.File)
+		if errors.Is(err, fs.ErrNotExist) {
+			check.Failures = []HunkFailure{{File: patch.File, Reason: "patch file not found"}}
+			checks = append(checks, check)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		diffs, err := ParseUnifiedDiff(content)
+		if err != nil {
+			return nil, &ParseError{File: patch.File, Err: err}
+		}
+		if check.PackageDir != "" {
+			packageFS, err := fs.Sub(fsys, check.PackageDir)
+			if err != nil {
+				return nil, err
+			}
+			if check.Failures, err = CheckDiff(packageFS, diffs); err != nil {
+				return nil, err
+			}
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+// installedPackageDir returns the directory where the package is installed, empty if none.
+// It looks into paths, the install locations recorded by the lockfile, then PackageDir/name
+// and the pnpm virtual store (node_modules/.pnpm). A hoisted copy of another version is
+// skipped when version is an exact version.
+func (pm PackageManager) installedPackageDir(fsys fs.FS, name string, version string, paths ...string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	for _, dir := range paths {
+		if FileExistsFS(fsys, path.Join(dir, "package.json")) {
+			return dir, nil
+		}
+	}
+	dir := path.Join(pm.PackageDir, name)
+	if FileExistsFS(fsys, path.Join(dir, "package.json")) {
+		installed, err := readPackageJSON(fsys, path.Join(dir, "package.json"))
+		if err != nil {
+			return "", err
+		}
+		if _, err := semver.NewVersion(version); err != nil || installed.Version == version {
+			return dir, nil
+		}
+	}
+	return pm.pnpmStorePackageDir(fsys, name, version)
+}
+
+// pnpmStorePackageDir returns the directory where the package is installed in the pnpm virtual store, empty if none.
+func (pm PackageManager) pnpmStorePackageDir(fsys fs.FS, name string, version string) (string, error) {
+	storeName := strings.ReplaceAll(name, "/", "+") + "@"
+	if _, err := semver.NewVersion(version); err == nil {
+		storeName += version
+	}
+	candidates, err := fs.Glob(fsys, path.Join(pm.PackageDir, ".pnpm", storeName+"*", "node_modules", name, "package.json"))
+	if err != nil {
+		return "", err
+	}
+	if len(candidates) == 0 {
+		return "", nil
+	}
+	return path.Dir(candidates[0]), nil
+}
+
+// CheckDiff checks that diffs apply to the package stored at the root of packageFS,
+// an installed package or an extracted tarball. Paths of patch-package diffs
+// (node_modules/<name>/file) are resolved to the package root.
+// Hunks already applied to the package are not reported as failures.
+func CheckDiff(packageFS fs.FS, diffs []FileDiff) ([]HunkFailure, error) {
+	var failures []HunkFailure
+	for _, diff := range diffs {
+		file := packageRelativePath(diff.NewPath)
+		if diff.OldPath != "" {
+			file = packageRelativePath(diff.OldPath)
+		}
+		content, err := fs.ReadFile(packageFS, file)
+		if errors.Is(err, fs.ErrNotExist) {
+			if diff.OldPath != "" && diff.NewPath != "" {
+				failures = append(failures, HunkFailure{File: file, Reason: "file not found"})
+			}
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		lines := strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		if diff.OldPath == "" {
+			if len(diff.Hunks) == 1 && equalLines(lines, diff.Hunks[0].newLines()) {
+				continue
+			}
+			failures = append(failures, HunkFailure{File: file, Reason: "file already exists"})
+			continue
+		}
+
+		offset := 0
+		for i, hunk := range diff.Hunks {
+			if at := findLines(lines, hunk.oldLines(), hunk.OldStart-1+offset); at >= 0 {
+				offset = at - (hunk.OldStart - 1)
+				continue
+			}
+			if findLines(lines, hunk.newLines(), hunk.NewStart-1) >= 0 {
+				// already applied
+				continue
+			}
+			failures = append(failures, HunkFailure{File: file, Hunk: i + 1, OldStart: hunk.OldStart, Reason: "content does not match"})
+		}
+	}
+	return failures, nil
+}
+
+// packageRelativePath strips patch-package paths from their node_modules/<name>/ prefix
+func packageRelativePath(file string) string {
+	i := strings.LastIndex(file, "node_modules/")
+	if i < 0 {
+		return file
+	}
+	rest := file[i+len("node_modules/"):]
+	segments := 1
+	if strings.HasPrefix(rest, "@") {
+		segments = 2
+	}
+	parts := strings.SplitN(rest, "/", segments+1)
+	if len(parts) <= segments {
+		return file
+	}
+	return parts[segments]
+}
+
+// findLines returns the index where want appears in lines, searching from hint outwards, -1 if not found
+func findLines(lines []string, want []string, hint int) int {
+	last := len(lines) - len(want)
+	if hint < 0 {
+		hint = 0
+	} else if hint > last {
+		hint = last
+	}
+	for distance := 0; hint-distance >= 0 || hint+distance <= last; distance++ {
+		for _, at := range []int{hint - distance, hint + distance} {
+			if at >= 0 && at <= last && equalLines(lines[at:at+len(want)], want) {
+				return at
+			}
+		}
+	}
+	return -1
+}
+
+func equalLines(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
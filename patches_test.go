@@ -0,0 +1,224 @@
+package packagemanager
+
+import (
+	"path"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/v3/assert"
+)
+
+func Test_ListPatches(t *testing.T) {
+	tests := []struct {
+		name string
+		pm   PackageManager
+		fsys fstest.MapFS
+		want []Patch
+	}{
+		{
+			name: "pnpm",
+			pm:   nodejsPnpm,
+			fsys: fstest.MapFS{
+				"package.json":                 {Data: []byte(`{"pnpm": {"patchedDependencies": {"lodash@4.17.21": "patches/lodash@4.17.21.patch", "@types/node@18.0.0": "patches/@types__node@18.0.0.patch"}}}`)},
+				"pnpm-workspace.yaml":          {Data: []byte("packages:\n  - packages/*\npatchedDependencies:\n  debug: ./patches/debug.patch\n")},
+				"patches/lodash@4.17.21.patch": {Data: []byte("")},
+				"patches/debug.patch":          {Data: []byte("")},
+			},
+			want: []Patch{
+				{Name: "@types/node", Version: "18.0.0", File: "patches/@types__node@18.0.0.patch", Exists: false},
+				{Name: "debug", File: "patches/debug.patch", Exists: true},
+				{Name: "lodash", Version: "4.17.21", File: "patches/lodash@4.17.21.patch", Exists: true},
+			},
+		},
+		{
+			name: "berry",
+			pm:   nodejsBerry,
+			fsys: fstest.MapFS{
+				"package.json": {Data: []byte(`{
+					"workspaces": ["packages/*"],
+					"resolutions": {"lodash": "patch:lodash@npm%3A4.17.21#./.yarn/patches/lodash.patch"}
+				}`)},
+				"packages/ui/package.json": {Data: []byte(`{"dependencies": {
+					"left-pad": "patch:left-pad@npm%3A^1.3.0#./left-pad.patch",
+					"typescript": "patch:typescript@npm%3A5.0.4#optional!builtin<compat/typescript>"
+				}}`)},
+				"yarn.lock":                  {Data: []byte(berryPatchedLockfile)},
+				".yarn/patches/lodash.patch": {Data: []byte("")},
+				"packages/ui/left-pad.patch": {Data: []byte("")},
+			},
+			want: []Patch{
+				{Name: "debug", Version: "4.3.4", File: ".yarn/patches/debug.patch", Exists: false},
+				{Name: "lodash", Version: "4.17.21", File: ".yarn/patches/lodash.patch", Exists: true},
+				{Name: "left-pad", Version: "^1.3.0", File: "packages/ui/left-pad.patch", Exists: true},
+			},
+		},
+		{
+			name: "patch-package",
+			pm:   nodejsNpm,
+			fsys: fstest.MapFS{
+				"package.json":                                {Data: []byte(`{}`)},
+				"patches/@babel+core+7.22.0.patch":            {Data: []byte("")},
+				"patches/react-scripts++webpack+5.88.0.patch": {Data: []byte("")},
+				"patches/left-pad+1.3.0+001+fix.patch":        {Data: []byte("")},
+				"patches/README.md":                           {Data: []byte("")},
+			},
+			want: []Patch{
+				{Name: "@babel/core", Version: "7.22.0", File: "patches/@babel+core+7.22.0.patch", Exists: true},
+				{Name: "left-pad", Version: "1.3.0", File: "patches/left-pad+1.3.0+001+fix.patch", Exists: true},
+				{Name: "webpack", Version: "5.88.0", File: "patches/react-scripts++webpack+5.88.0.patch", Exists: true},
+			},
+		},
+		{
+			name: "no patches",
+			pm:   nodejsYarn,
+			fsys: fstest.MapFS{"package.json": {Data: []byte(`{}`)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.pm.ListPatchesFS(tt.fsys)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, got, tt.want)
+		})
+	}
+}
+
+const leftPadPatch = `diff --git a/index.js b/index.js
+index 1111111..2222222 100644
+--- a/index.js
++++ b/index.js
+@@ -1,4 +1,4 @@
+ module.exports = leftPad;
+ 
+-function leftPad(str, len, ch) {
++function leftPad(str, len, ch = ' ') {
+   str = String(str);
+@@ -8,3 +8,4 @@
+   return str;
+ }
++// patched
+ // end
+diff --git a/NOTES.md b/NOTES.md
+new file mode 100644
+--- /dev/null
++++ b/NOTES.md
+@@ -0,0 +1 @@
++patched
+`
+
+func Test_ParseUnifiedDiff(t *testing.T) {
+	diffs, err := ParseUnifiedDiff([]byte(leftPadPatch))
+	assert.NilError(t, err)
+	assert.Equal(t, len(diffs), 2)
+	assert.Equal(t, diffs[0].OldPath, "index.js")
+	assert.Equal(t, diffs[0].NewPath, "index.js")
+	assert.DeepEqual(t, diffs[0].Hunks[1], Hunk{OldStart: 8, OldLines: 3, NewStart: 8, NewLines: 4, Lines: []string{"   return str;", " }", "+// patched", " // end"}})
+	assert.Equal(t, diffs[1].OldPath, "")
+	assert.Equal(t, diffs[1].NewPath, "NOTES.md")
+
+	_, err = ParseUnifiedDiff([]byte("--- a/index.js\n+++ b/index.js\n@@ -1,2 +1,2 @@\n-foo\n"))
+	assert.ErrorContains(t, err, "unexpected end of hunk")
+}
+
+func Test_CheckPatches(t *testing.T) {
+	original := "module.exports = leftPad;\n\nfunction leftPad(str, len, ch) {\n  str = String(str);\n  var i = -1;\n  while (++i < len) str = ch + str;\n  // moved\n  return str;\n}\n// end\n"
+	upgraded := "module.exports = leftPad;\n\nfunction leftPad(str, len, fill) {\n  str = String(str);\n  return str.padStart(len, fill);\n}\n// end\n"
+	patched := "module.exports = leftPad;\n\nfunction leftPad(str, len, ch = ' ') {\n  str = String(str);\n  var i = -1;\n  while (++i < len) str = ch + str;\n  // moved\n  return str;\n}\n// patched\n// end\n"
+	patch := Patch{Name: "left-pad", Version: "1.3.0", File: "patches/left-pad@1.3.0.patch", Exists: true}
+
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		// the version of the installed packages, 1.3.0 by default
+		version      string
+		wantDir      string
+		wantFailures []HunkFailure
+	}{
+		{
+			name:    "applies with offset",
+			files:   fstest.MapFS{"node_modules/left-pad/index.js": {Data: []byte("// header\n" + original)}},
+			wantDir: "node_modules/left-pad",
+		},
+		{
+			name: "already applied in the pnpm store",
+			files: fstest.MapFS{
+				"node_modules/.pnpm/left-pad@1.3.0_patch_hash=abc/node_modules/left-pad/index.js": {Data: []byte(patched)},
+				"node_modules/.pnpm/left-pad@1.3.0_patch_hash=abc/node_modules/left-pad/NOTES.md": {Data: []byte("patched\n")},
+			},
+			wantDir: "node_modules/.pnpm/left-pad@1.3.0_patch_hash=abc/node_modules/left-pad",
+		},
+		{
+			name:    "upgraded",
+			files:   fstest.MapFS{"node_modules/left-pad/index.js": {Data: []byte(upgraded)}, "node_modules/left-pad/NOTES.md": {Data: []byte("other\n")}},
+			wantDir: "node_modules/left-pad",
+			wantFailures: []HunkFailure{
+				{File: "index.js", Hunk: 1, OldStart: 1, Reason: "content does not match"},
+				{File: "index.js", Hunk: 2, OldStart: 8, Reason: "content does not match"},
+				{File: "NOTES.md", Reason: "file already exists"},
+			},
+		},
+		{
+			name:  "not installed",
+			files: fstest.MapFS{},
+		},
+		{
+			name:    "hoisted copy of another version",
+			files:   fstest.MapFS{"node_modules/left-pad/index.js": {Data: []byte(upgraded)}},
+			version: "2.0.0",
+		},
+		{
+			name: "hoisted copy of another version and the pnpm store",
+			files: fstest.MapFS{
+				"node_modules/left-pad/index.js":                                   {Data: []byte(upgraded)},
+				"node_modules/left-pad/package.json":                               {Data: []byte(`{"name": "left-pad", "version": "2.0.0"}`)},
+				"node_modules/.pnpm/left-pad@1.3.0/node_modules/left-pad/index.js": {Data: []byte(original)},
+			},
+			wantDir: "node_modules/.pnpm/left-pad@1.3.0/node_modules/left-pad",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.files["patches/left-pad@1.3.0.patch"] = &fstest.MapFile{Data: []byte(leftPadPatch)}
+			version := tt.version
+			if version == "" {
+				version = "1.3.0"
+			}
+			for name := range tt.files {
+				if dir, file := path.Split(name); file == "index.js" && tt.files[dir+"package.json"] == nil {
+					tt.files[dir+"package.json"] = &fstest.MapFile{Data: []byte(`{"name": "left-pad", "version": "` + version + `"}`)}
+				}
+			}
+			checks, err := nodejsPnpm.CheckPatchesFS(tt.files, []Patch{patch})
+			assert.NilError(t, err)
+			assert.Equal(t, len(checks), 1)
+			assert.Equal(t, checks[0].PackageDir, tt.wantDir)
+			assert.DeepEqual(t, checks[0].Failures, tt.wantFailures)
+			assert.Equal(t, checks[0].Applies(), tt.wantDir != "" && len(tt.wantFailures) == 0)
+		})
+	}
+
+	t.Run("missing patch file", func(t *testing.T) {
+		files := fstest.MapFS{
+			"patches/left-pad@1.3.0.patch":       {Data: []byte(leftPadPatch)},
+			"node_modules/left-pad/index.js":     {Data: []byte(original)},
+			"node_modules/left-pad/NOTES.md":     {Data: []byte("patched\n")},
+			"node_modules/left-pad/package.json": {Data: []byte(`{"name": "left-pad", "version": "1.3.0"}`)},
+		}
+		missing := Patch{Name: "left-pad", Version: "1.3.0", File: "patches/left-pad@1.2.0.patch"}
+		checks, err := nodejsPnpm.CheckPatchesFS(files, []Patch{missing, patch})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, checks, []PatchCheck{
+			{Patch: missing, PackageDir: "node_modules/left-pad", Failures: []HunkFailure{{File: "patches/left-pad@1.2.0.patch", Reason: "patch file not found"}}},
+			{Patch: patch, PackageDir: "node_modules/left-pad"},
+		})
+		assert.Assert(t, !checks[0].Applies())
+	})
+}
+
+func Test_CheckDiff_patchPackage(t *testing.T) {
+	diffs, err := ParseUnifiedDiff([]byte("--- a/node_modules/@scope/pkg/lib/index.js\n+++ b/node_modules/@scope/pkg/lib/index.js\n@@ -1 +1 @@\n-old\n+new\n"))
+	assert.NilError(t, err)
+	failures, err := CheckDiff(fstest.MapFS{"lib/index.js": {Data: []byte("old\n")}}, diffs)
+	assert.NilError(t, err)
+	assert.Equal(t, len(failures), 0)
+}
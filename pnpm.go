@@ -1,9 +1,9 @@
 package packagemanager
 
 import (
+	"bytes"
 	"fmt"
-	"os"
-	"path/filepath"
+	"io/fs"
 	"strings"
 
 	"github.com/Masterminds/semver"
@@ -11,32 +11,114 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-// PnpmWorkspaces is a representation of workspace package globs found
-// in pnpm-workspace.yaml
+// PnpmWorkspaces is a representation of pnpm-workspace.yaml. Since pnpm 9 it holds
+// the workspace package globs along with settings previously read from the pnpm
+// field of package.json, use PackageManager.ReadPnpmSettings to get the settings in effect.
+// (https://pnpm.io/pnpm-workspace_yaml)
 type PnpmWorkspaces struct {
-	Packages []string `yaml:"packages,omitempty"`
+	Packages []string `yaml:"packages,omitempty" json:"-"`
+
+	// The default catalog, an alias of Catalogs["default"].
+	Catalog map[string]string `yaml:"catalog,omitempty" json:"-"`
+
+	// Named catalogs of dependency versions, referenced by catalog:<name> ranges.
+	Catalogs map[string]map[string]string `yaml:"catalogs,omitempty" json:"-"`
+
+	Overrides              map[string]string               `yaml:"overrides,omitempty" json:"overrides,omitempty"`
+	PatchedDependencies    map[string]string               `yaml:"patchedDependencies,omitempty" json:"patchedDependencies,omitempty"`
+	OnlyBuiltDependencies  []string                        `yaml:"onlyBuiltDependencies,omitempty" json:"onlyBuiltDependencies,omitempty"`
+	NeverBuiltDependencies []string                        `yaml:"neverBuiltDependencies,omitempty" json:"neverBuiltDependencies,omitempty"`
+	PackageExtensions      map[string]PnpmPackageExtension `yaml:"packageExtensions,omitempty" json:"packageExtensions,omitempty"`
+}
+
+// PnpmPackageExtension extends the manifest of the packages matching its selector
+// (https://pnpm.io/package_json#pnpmpackageextensions)
+type PnpmPackageExtension struct {
+	Dependencies         map[string]string                 `yaml:"dependencies,omitempty" json:"dependencies,omitempty"`
+	OptionalDependencies map[string]string                 `yaml:"optionalDependencies,omitempty" json:"optionalDependencies,omitempty"`
+	PeerDependencies     map[string]string                 `yaml:"peerDependencies,omitempty" json:"peerDependencies,omitempty"`
+	PeerDependenciesMeta map[string]PnpmPeerDependencyMeta `yaml:"peerDependenciesMeta,omitempty" json:"peerDependenciesMeta,omitempty"`
+}
+
+// PnpmPeerDependencyMeta is the metadata of a peer dependency
+type PnpmPeerDependencyMeta struct {
+	Optional bool `yaml:"optional,omitempty" json:"optional,omitempty"`
 }
 
-func readPnpmWorkspacePackages(workspaceFile string) ([]string, error) {
-	bytes, err := os.ReadFile(workspaceFile)
+// Pnpm6Workspaces is a representation of workspace package globs found
+// in pnpm-workspace.yaml
+//
+// Deprecated: pnpm 6 shares its workspace format with later versions, use PnpmWorkspaces.
+type Pnpm6Workspaces = PnpmWorkspaces
+
+// pnpmLockfileHeader is the part of pnpm-lock.yaml needed to identify its format
+type pnpmLockfileHeader struct {
+	LockfileVersion string `yaml:"lockfileVersion"`
+}
+
+// pnpmVersionFromLockfile returns the lowest pnpm version writing the lockfile
+// format used by the project.
+func pnpmVersionFromLockfile(fsys fs.FS, lockfilePath string) (*semver.Version, error) {
+	bytes, err := fs.ReadFile(fsys, lockfilePath)
+	if err != nil {
+		return nil, err
+	}
+	var header pnpmLockfileHeader
+	if err := yaml.Unmarshal(bytes, &header); err != nil {
+		return nil, newYamlParseError(lockfilePath, err)
+	}
+	lockfileVersion, err := semver.NewVersion(header.LockfileVersion)
+	if err != nil {
+		return nil, &ParseError{File: lockfilePath, Err: fmt.Errorf("invalid lockfileVersion: %w", err)}
+	}
+	// https://github.com/pnpm/spec/tree/master/lockfile
+	switch {
+	case lockfileVersion.Major() >= 7:
+		return semver.NewVersion("9.0.0")
+	case lockfileVersion.Major() == 6:
+		return semver.NewVersion("8.0.0")
+	case lockfileVersion.Major() == 5 && lockfileVersion.Minor() >= 4:
+		return semver.NewVersion("7.0.0")
+	case lockfileVersion.Major() == 5 && lockfileVersion.Minor() == 3:
+		return semver.NewVersion("6.0.0")
+	}
+	return nil, fmt.Errorf("unknown pnpm lockfileVersion %s", header.LockfileVersion)
+}
+
+// pnpmArgSeparator returns the argument separator for the given pnpm version
+func pnpmArgSeparator(version *semver.Version) []string {
+	// pnpm v7+ changed their handling of '--'. We no longer need to pass it to pass args to
+	// the script being run, and in fact doing so will cause the '--' to be passed through verbatim,
+	// potentially breaking scripts that aren't expecting it.
+	if version != nil && version.Major() < 7 {
+		return []string{"--"}
+	}
+	// We are allowed to use nil here because ArgSeparator already has a type, so it's a typed nil,
+	// This could just as easily be []string{}, but the style guide says to prefer
+	// nil for empty slices.
+	return nil
+}
+
+func readPnpmWorkspacePackages(fsys fs.FS, workspaceFile string) ([]string, error) {
+	bytes, err := fs.ReadFile(fsys, workspaceFile)
 	if err != nil {
 		return nil, fmt.Errorf("%v: %w", workspaceFile, err)
 	}
 	var pnpmWorkspaces PnpmWorkspaces
 	if err := yaml.Unmarshal(bytes, &pnpmWorkspaces); err != nil {
-		return nil, fmt.Errorf("%v: %w", workspaceFile, err)
+		return nil, newYamlParseError(workspaceFile, err)
 	}
 	return pnpmWorkspaces.Packages, nil
 }
 
-func getPnpmWorkspaceGlobs(rootpath string) ([]string, error) {
-	pkgGlobs, err := readPnpmWorkspacePackages(filepath.Join(rootpath, "pnpm-workspace.yaml"))
+func getPnpmWorkspaceGlobs(fsys fs.FS) ([]string, error) {
+	pkgGlobs, err := readPnpmWorkspacePackages(fsys, "pnpm-workspace.yaml")
 	if err != nil {
 		return nil, err
 	}
 
 	if len(pkgGlobs) == 0 {
-		return nil, fmt.Errorf("pnpm-workspace.yaml: no packages found. packagemanager requires pnpm workspaces and thus packages to be defined in the root pnpm-workspace.yaml")
+		return nil, fmt.Errorf("pnpm-workspace.yaml: %w. packagemanager requires pnpm workspaces and thus packages to be defined in the root pnpm-workspace.yaml", ErrNoWorkspaces)
 	}
 
 	filteredPkgGlobs := []string{}
@@ -48,7 +130,7 @@ func getPnpmWorkspaceGlobs(rootpath string) ([]string, error) {
 	return filteredPkgGlobs, nil
 }
 
-func getPnpmWorkspaceIgnores(pm PackageManager, rootpath string) ([]string, error) {
+func getPnpmWorkspaceIgnores(pm PackageManager, fsys fs.FS) ([]string, error) {
 	// Matches upstream values:
 	// function: https://github.com/pnpm/pnpm/blob/d99daa902442e0c8ab945143ebaf5cdc691a91eb/packages/find-packages/src/index.ts#L27
 	// key code: https://github.com/pnpm/pnpm/blob/d99daa902442e0c8ab945143ebaf5cdc691a91eb/packages/find-packages/src/index.ts#L30
@@ -57,7 +139,7 @@ func getPnpmWorkspaceIgnores(pm PackageManager, rootpath string) ([]string, erro
 		"**/node_modules/**",
 		"**/bower_components/**",
 	}
-	pkgGlobs, err := readPnpmWorkspacePackages(filepath.Join(rootpath, "pnpm-workspace.yaml"))
+	pkgGlobs, err := readPnpmWorkspacePackages(fsys, "pnpm-workspace.yaml")
 	if err != nil {
 		return nil, err
 	}
@@ -76,94 +158,154 @@ var nodejsPnpm = PackageManager{
 	Specfile:   "package.json",
 	Lockfile:   "pnpm-lock.yaml",
 	PackageDir: "node_modules",
-	// pnpm v7+ changed their handling of '--'. We no longer need to pass it to pass args to
-	// the script being run, and in fact doing so will cause the '--' to be passed through verbatim,
-	// potentially breaking scripts that aren't expecting it.
-	// We are allowed to use nil here because ArgSeparator already has a type, so it's a typed nil,
-	// This could just as easily be []string{}, but the style guide says to prefer
-	// nil for empty slices.
-	ArgSeparator:               nil,
+	// Default to the latest behavior, the actual separator is resolved with the version
+	ArgSeparator:               pnpmArgSeparator(nil),
 	WorkspaceConfigurationPath: "pnpm-workspace.yaml",
 
-	getWorkspaceGlobs: getPnpmWorkspaceGlobs,
+	Behavior: BehaviorFuncs{
+		ArgSeparatorFunc: pnpmArgSeparator,
 
-	getWorkspaceIgnores: getPnpmWorkspaceIgnores,
+		WorkspaceGlobsFunc: getPnpmWorkspaceGlobs,
 
-	Matches: func(manager string, version string) (bool, error) {
-		if manager != "pnpm" {
-			return false, nil
-		}
+		WorkspaceIgnoresFunc: getPnpmWorkspaceIgnores,
 
-		v, err := semver.NewVersion(version)
-		if err != nil {
-			return false, fmt.Errorf("could not parse pnpm version: %w", err)
-		}
-		c, err := semver.NewConstraint(">=7.0.0")
-		if err != nil {
-			return false, fmt.Errorf("could not create constraint: %w", err)
-		}
+		MatchesFunc: func(manager string, version string) (bool, error) {
+			if manager != "pnpm" {
+				return false, nil
+			}
 
-		return c.Check(v), nil
-	},
+			// behavior differences between versions are resolved by the instance
+			if _, err := semver.NewVersion(version); err != nil {
+				return false, fmt.Errorf("could not parse pnpm version: %w", err)
+			}
 
-	detect: func(projectDirectory string, packageManager *PackageManager) (bool, error) {
-		specfileExists := FileExists(filepath.Join(projectDirectory, packageManager.Specfile))
-		lockfileExists := FileExists(filepath.Join(projectDirectory, packageManager.Lockfile))
+			return true, nil
+		},
 
-		return (specfileExists && lockfileExists), nil
-	},
+		DetectFunc: func(fsys fs.FS, packageManager *PackageManager) (bool, error) {
+			specfileExists := FileExistsFS(fsys, packageManager.Specfile)
+			lockfileExists := FileExistsFS(fsys, packageManager.Lockfile)
 
-	canPrune: func(cwd string) (bool, error) {
-		return true, nil
-	},
+			if specfileExists && lockfileExists {
+				// an unreadable lockfile version is not a detection failure
+				packageManager.Version, _ = pnpmVersionFromLockfile(fsys, packageManager.Lockfile)
+			}
 
-	// @FIXME unsuported lockfile
-	// UnmarshalLockfile: func(contents []byte) (lockfile.Lockfile, error) {
-	// 	return lockfile.DecodeNpmLockfile(contents)
-	// },
+			return (specfileExists && lockfileExists), nil
+		},
 
-	prunePatches: func(pkgJSON *packageJson.PackageJSON, patches []string) error {
-		return pnpmPrunePatches(pkgJSON, patches)
+		CanPruneFunc: func(fsys fs.FS) (bool, error) {
+			return true, nil
+		},
+
+		UnmarshalLockfileFunc: unmarshalPnpmLockfile,
+		MarshalLockfileFunc:   marshalPnpmLockfile,
+
+		PrunePatchesFunc: pnpmPrunePatches,
+
+		PruneWorkspaceConfigurationPatchesFunc: pnpmPruneWorkspacePatches,
+
+		ListPatchesFunc: pnpmListPatches,
+
+		ReadPnpmSettingsFunc: readPnpmSettingsFS,
 	},
 }
 
-func pnpmPrunePatches(pkgJSON *packageJson.PackageJSON, patches []string) error {
+// pnpmPatchWanted tells if the patch file is one of patches
+func pnpmPatchWanted(patch string, patches []string) bool {
+	for _, wantedPatch := range patches {
+		if normalizePatchPath(wantedPatch) == normalizePatchPath(patch) {
+			return true
+		}
+	}
+	return false
+}
+
+// pnpmPrunePatches removes from the pnpm.patchedDependencies of pkgJSON the patches
+// that are not in patches. Missing sections are ignored.
+func pnpmPrunePatches(pkgJSON *packageJson.PackageJSON, patches []string) (*PruneSummary, error) {
 	pkgJSON.Mu.Lock()
 	defer pkgJSON.Mu.Unlock()
 
-	keysToDelete := []string{}
+	summary := &PruneSummary{}
+	if pkgJSON.Pnpm == nil {
+		return summary, nil
+	}
 	pnpmConfig, ok := pkgJSON.Pnpm.(map[string]interface{})
 	if !ok {
-		return fmt.Errorf("invalid structure for pnpm field in package.json")
+		return nil, fmt.Errorf("invalid structure for pnpm field in package.json")
+	}
+	if pnpmConfig["patchedDependencies"] == nil {
+		return summary, nil
 	}
 	patchedDependencies, ok := pnpmConfig["patchedDependencies"].(map[string]interface{})
 	if !ok {
-		return fmt.Errorf("invalid structure for patchedDependencies field in package.json")
+		return nil, fmt.Errorf("invalid structure for patchedDependencies field in package.json")
 	}
 
-	for dependency, untypedPatch := range patchedDependencies {
-		patch, ok := untypedPatch.(string)
+	for _, dependency := range sortedKeys(patchedDependencies) {
+		patch, ok := patchedDependencies[dependency].(string)
 		if !ok {
-			return fmt.Errorf("expected only strings in patchedDependencies. Got %v", untypedPatch)
+			return nil, fmt.Errorf("expected only strings in patchedDependencies. Got %v", patchedDependencies[dependency])
 		}
 
-		inPatches := false
+		if !pnpmPatchWanted(patch, patches) {
+			delete(patchedDependencies, dependency)
+			summary.Removed = append(summary.Removed, PrunedPatch{File: "package.json", Field: "pnpm.patchedDependencies", Key: dependency, Patch: patch})
+		}
+	}
 
-		for _, wantedPatch := range patches {
-			if wantedPatch == patch {
-				inPatches = true
-				break
+	return summary, nil
+}
+
+// pnpmPruneWorkspacePatches removes from the patchedDependencies of pnpm-workspace.yaml
+// the patches that are not in patches, keeping comments. The contents are returned
+// as is when nothing is removed.
+func pnpmPruneWorkspacePatches(contents []byte, patches []string) ([]byte, *PruneSummary, error) {
+	summary := &PruneSummary{}
+	var document yaml.Node
+	if err := yaml.Unmarshal(contents, &document); err != nil {
+		return nil, nil, newYamlParseError("pnpm-workspace.yaml", err)
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return contents, summary, nil
+	}
+	root := document.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "patchedDependencies" {
+			continue
+		}
+		patchedDependencies := root.Content[i+1]
+		if patchedDependencies.Kind != yaml.MappingNode {
+			return nil, nil, &ParseError{File: "pnpm-workspace.yaml", Line: patchedDependencies.Line, Err: fmt.Errorf("invalid structure for patchedDependencies")}
+		}
+		kept := []*yaml.Node{}
+		for j := 0; j+1 < len(patchedDependencies.Content); j += 2 {
+			dependency, patch := patchedDependencies.Content[j], patchedDependencies.Content[j+1]
+			if pnpmPatchWanted(patch.Value, patches) {
+				kept = append(kept, dependency, patch)
+				continue
 			}
+			summary.Removed = append(summary.Removed, PrunedPatch{File: "pnpm-workspace.yaml", Field: "patchedDependencies", Key: dependency.Value, Patch: patch.Value})
 		}
-
-		if !inPatches {
-			keysToDelete = append(keysToDelete, dependency)
+		if len(summary.Removed) == 0 {
+			return contents, summary, nil
 		}
+		if len(kept) == 0 {
+			root.Content = append(root.Content[:i:i], root.Content[i+2:]...)
+		} else {
+			patchedDependencies.Content = kept
+		}
+		var buffer bytes.Buffer
+		encoder := yaml.NewEncoder(&buffer)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(&document); err != nil {
+			return nil, nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, nil, err
+		}
+		return buffer.Bytes(), summary, nil
 	}
-
-	for _, key := range keysToDelete {
-		delete(patchedDependencies, key)
-	}
-
-	return nil
+	return contents, summary, nil
 }
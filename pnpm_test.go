@@ -1,9 +1,11 @@
 package packagemanager
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
+	"testing/fstest"
 
 	"github.com/software-t-rex/packageJson"
 	"gotest.tools/v3/assert"
@@ -37,8 +39,9 @@ func Test_PnpmPrunePatches_KeepsNecessary(t *testing.T) {
 
 	assert.DeepEqual(t, initialPatches, map[string]interface{}{"is-odd@3.0.1": "patches/is-odd@3.0.1.patch"})
 
-	err := pnpmPrunePatches(pkgJSON, []string{"patches/is-odd@3.0.1.patch"})
+	summary, err := pnpmPrunePatches(pkgJSON, []string{"patches/is-odd@3.0.1.patch"})
 	assert.NilError(t, err)
+	assert.Equal(t, len(summary.Removed), 0)
 
 	newPatches := pnpmPatchesSection(t, pkgJSON)
 	assert.DeepEqual(t, newPatches, map[string]interface{}{"is-odd@3.0.1": "patches/is-odd@3.0.1.patch"})
@@ -50,9 +53,135 @@ func Test_PnpmPrunePatches_RemovesExtra(t *testing.T) {
 
 	assert.DeepEqual(t, initialPatches, map[string]interface{}{"is-odd@3.0.1": "patches/is-odd@3.0.1.patch"})
 
-	err := pnpmPrunePatches(pkgJSON, nil)
+	summary, err := pnpmPrunePatches(pkgJSON, nil)
 	assert.NilError(t, err)
+	assert.DeepEqual(t, summary.Removed, []PrunedPatch{
+		{File: "package.json", Field: "pnpm.patchedDependencies", Key: "is-odd@3.0.1", Patch: "patches/is-odd@3.0.1.patch"},
+	})
 
 	newPatches := pnpmPatchesSection(t, pkgJSON)
 	assert.DeepEqual(t, newPatches, map[string]interface{}{})
 }
+
+func Test_PnpmPrunePatches_MissingSections(t *testing.T) {
+	for _, pkgJSON := range []*packageJson.PackageJSON{
+		{},
+		{Pnpm: map[string]interface{}{"overrides": map[string]interface{}{}}},
+	} {
+		summary, err := pnpmPrunePatches(pkgJSON, nil)
+		assert.NilError(t, err)
+		assert.Equal(t, len(summary.Removed), 0)
+	}
+
+	_, err := pnpmPrunePatches(&packageJson.PackageJSON{Pnpm: "invalid"}, nil)
+	assert.ErrorContains(t, err, "invalid structure for pnpm field")
+}
+
+func Test_PnpmPruneWorkspacePatches(t *testing.T) {
+	contents := []byte(`packages:
+  - packages/*
+# patched until upstream merges the fix
+patchedDependencies:
+  is-odd@3.0.1: patches/is-odd@3.0.1.patch
+  is-even: ./patches/is-even.patch
+`)
+	pruned, summary, err := nodejsPnpm.PruneWorkspaceConfigurationPatches(contents, []string{"patches/is-even.patch"})
+	assert.NilError(t, err)
+	assert.Equal(t, string(pruned), `packages:
+  - packages/*
+# patched until upstream merges the fix
+patchedDependencies:
+  is-even: ./patches/is-even.patch
+`)
+	assert.DeepEqual(t, summary.Removed, []PrunedPatch{
+		{File: "pnpm-workspace.yaml", Field: "patchedDependencies", Key: "is-odd@3.0.1", Patch: "patches/is-odd@3.0.1.patch"},
+	})
+
+	pruned, _, err = nodejsPnpm.PruneWorkspaceConfigurationPatches(contents, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, string(pruned), "packages:\n  - packages/*\n")
+
+	unchanged, summary, err := nodejsPnpm.PruneWorkspaceConfigurationPatches([]byte("packages: [apps/*]\n"), nil)
+	assert.NilError(t, err)
+	assert.Equal(t, string(unchanged), "packages: [apps/*]\n")
+	assert.Equal(t, len(summary.Removed), 0)
+}
+
+func Test_ReadPnpmSettingsFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"package.json": {Data: []byte(`{
+			"pnpm": {
+				"overrides": {"foo": "1.0.0", "bar": "2.0.0"},
+				"onlyBuiltDependencies": ["esbuild"],
+				"patchedDependencies": {"is-odd@3.0.1": "patches/is-odd@3.0.1.patch"},
+				"packageExtensions": {"react-redux@1": {"peerDependencies": {"react-dom": "*"}, "peerDependenciesMeta": {"react-dom": {"optional": true}}}}
+			}
+		}`)},
+		"pnpm-workspace.yaml": {Data: []byte(`packages:
+  - packages/*
+catalog:
+  react: ^18.2.0
+catalogs:
+  legacy:
+    react: ^16.14.0
+overrides:
+  foo: 1.1.0
+neverBuiltDependencies:
+  - fsevents
+`)},
+	}
+	settings, err := nodejsPnpm.ReadPnpmSettingsFS(fsys)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, *settings, PnpmWorkspaces{
+		Packages: []string{"packages/*"},
+		Catalog:  map[string]string{"react": "^18.2.0"},
+		Catalogs: map[string]map[string]string{
+			"default": {"react": "^18.2.0"},
+			"legacy":  {"react": "^16.14.0"},
+		},
+		Overrides:              map[string]string{"foo": "1.1.0", "bar": "2.0.0"},
+		PatchedDependencies:    map[string]string{"is-odd@3.0.1": "patches/is-odd@3.0.1.patch"},
+		OnlyBuiltDependencies:  []string{"esbuild"},
+		NeverBuiltDependencies: []string{"fsevents"},
+		PackageExtensions: map[string]PnpmPackageExtension{
+			"react-redux@1": {
+				PeerDependencies:     map[string]string{"react-dom": "*"},
+				PeerDependenciesMeta: map[string]PnpmPeerDependencyMeta{"react-dom": {Optional: true}},
+			},
+		},
+	})
+
+	fsys["pnpm-workspace.yaml"] = &fstest.MapFile{Data: []byte("catalog:\n  react: ^18.2.0\ncatalogs:\n  default:\n    react: ^17.0.0\n")}
+	_, err = nodejsPnpm.ReadPnpmSettingsFS(fsys)
+	var parseErr *ParseError
+	assert.Assert(t, errors.As(err, &parseErr), "expected a ParseError, got %v", err)
+	assert.Equal(t, parseErr.File, "pnpm-workspace.yaml")
+}
+
+func Test_ReadPnpmSettingsFS_unsupported(t *testing.T) {
+	fsys := fstest.MapFS{"package.json": {Data: []byte(`{"pnpm": {"overrides": {"foo": "1.0.0"}}}`)}}
+	for _, pm := range []PackageManager{nodejsNpm, nodejsYarn, nodejsBerry} {
+		_, err := pm.ReadPnpmSettingsFS(fsys)
+		var unsupported *UnsupportedConfigError
+		assert.Assert(t, errors.As(err, &unsupported), "%s: expected an UnsupportedConfigError, got %v", pm.Name, err)
+		assert.Equal(t, unsupported.Manager, pm.Name)
+	}
+}
+
+func Test_ReadPnpmSettingsFS_precedence(t *testing.T) {
+	fsys := fstest.MapFS{
+		"package.json": {Data: []byte(`{
+			"pnpm": {
+				"patchedDependencies": {"lodash@4.17.21": "patches/lodash.patch", "debug": "patches/debug-old.patch"},
+				"onlyBuiltDependencies": ["esbuild"]
+			}
+		}`)},
+		"pnpm-workspace.yaml": {Data: []byte("patchedDependencies:\n  debug: patches/debug.patch\nonlyBuiltDependencies:\n  - sharp\n")},
+	}
+	settings, err := nodejsPnpm.ReadPnpmSettingsFS(fsys)
+	assert.NilError(t, err)
+	// map entries are merged, pnpm-workspace.yaml wins on conflicts
+	assert.DeepEqual(t, settings.PatchedDependencies, map[string]string{"lodash@4.17.21": "patches/lodash.patch", "debug": "patches/debug.patch"})
+	// other settings are replaced
+	assert.DeepEqual(t, settings.OnlyBuiltDependencies, []string{"sharp"})
+}
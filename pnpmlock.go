@@ -0,0 +1,406 @@
+package packagemanager
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"gopkg.in/yaml.v3"
+)
+
+// pnpmLockfileName is the lockfile of pnpm
+const pnpmLockfileName = "pnpm-lock.yaml"
+
+// pnpmLockfile is the part of pnpm-lock.yaml common to the lockfile versions 5.3 to 9
+// (https://github.com/pnpm/spec/tree/master/lockfile)
+type pnpmLockfile struct {
+	LockfileVersion string `yaml:"lockfileVersion"`
+
+	// the root project of lockfiles without workspaces (v5)
+	pnpmLockfileImporter `yaml:",inline"`
+
+	Importers map[string]pnpmLockfileImporter `yaml:"importers"`
+	Packages  map[string]pnpmLockfilePackage  `yaml:"packages"`
+	// v9 moved the dependencies of packages to snapshots
+	Snapshots map[string]pnpmLockfileSnapshot `yaml:"snapshots"`
+}
+
+type pnpmLockfileImporter struct {
+	// v5 records the specifiers apart from the versions
+	Specifiers           map[string]string                    `yaml:"specifiers"`
+	Dependencies         map[string]pnpmLockfileImporterEntry `yaml:"dependencies"`
+	DevDependencies      map[string]pnpmLockfileImporterEntry `yaml:"devDependencies"`
+	OptionalDependencies map[string]pnpmLockfileImporterEntry `yaml:"optionalDependencies"`
+}
+
+// pnpmLockfileImporterEntry is a version (v5) or a specifier and version pair (v6+)
+type pnpmLockfileImporterEntry struct {
+	Specifier string `yaml:"specifier"`
+	Version   string `yaml:"version"`
+}
+
+func (e *pnpmLockfileImporterEntry) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		e.Version = node.Value
+		return nil
+	}
+	type plain pnpmLockfileImporterEntry
+	return node.Decode((*plain)(e))
+}
+
+type pnpmLockfilePackage struct {
+	Resolution struct {
+		Integrity string `yaml:"integrity"`
+		Tarball   string `yaml:"tarball"`
+		Directory string `yaml:"directory"`
+		Repo      string `yaml:"repo"`
+		Commit    string `yaml:"commit"`
+	} `yaml:"resolution"`
+	Name                 string            `yaml:"name"`
+	Version              string            `yaml:"version"`
+	Dependencies         map[string]string `yaml:"dependencies"`
+	OptionalDependencies map[string]string `yaml:"optionalDependencies"`
+	PeerDependencies     map[string]string `yaml:"peerDependencies"`
+	Dev                  bool              `yaml:"dev"`
+	Optional             bool              `yaml:"optional"`
+}
+
+type pnpmLockfileSnapshot struct {
+	Dependencies         map[string]string `yaml:"dependencies"`
+	OptionalDependencies map[string]string `yaml:"optionalDependencies"`
+	Optional             bool              `yaml:"optional"`
+}
+
+// unmarshalPnpmLockfile reads pnpm-lock.yaml contents
+func unmarshalPnpmLockfile(contents []byte) (*Lockfile, error) {
+	var raw pnpmLockfile
+	if err := yaml.Unmarshal(contents, &raw); err != nil {
+		return nil, newYamlParseError(pnpmLockfileName, err)
+	}
+	lockfileVersion, err := semver.NewVersion(raw.LockfileVersion)
+	if err != nil {
+		return nil, &ParseError{File: pnpmLockfileName, Err: fmt.Errorf("invalid lockfileVersion %q", raw.LockfileVersion)}
+	}
+	major := int(lockfileVersion.Major())
+	if major < 5 {
+		return nil, &UnsupportedConfigError{Manager: "nodejs-pnpm", Reason: "lockfile version " + raw.LockfileVersion + " is not supported"}
+	}
+
+	lockfile := newLockfile(raw.LockfileVersion)
+	importers := raw.Importers
+	if len(importers) == 0 {
+		importers = map[string]pnpmLockfileImporter{".": raw.pnpmLockfileImporter}
+	}
+	for dir, rawImporter := range importers {
+		importer := lockfile.importer(dir)
+		for _, field := range []struct {
+			name         string
+			dependencies map[string]pnpmLockfileImporterEntry
+		}{
+			{"dependencies", rawImporter.Dependencies},
+			{"devDependencies", rawImporter.DevDependencies},
+			{"optionalDependencies", rawImporter.OptionalDependencies},
+		} {
+			for name, entry := range field.dependencies {
+				dependency := LockfileDependency{Field: field.name, Specifier: entry.Specifier}
+				if major == 5 {
+					dependency.Specifier = rawImporter.Specifiers[name]
+				}
+				if link, ok := strings.CutPrefix(entry.Version, "link:"); ok {
+					dependency.Link = path.Join(dir, link)
+				} else {
+					dependency.Package, dependency.Version = pnpmDependencyKey(major, name, entry.Version)
+				}
+				importer.Dependencies[name] = dependency
+			}
+		}
+	}
+
+	for _, rawKey := range sortedKeys(raw.Packages) {
+		rawPackage := raw.Packages[rawKey]
+		name, version := pnpmPackageKey(major, rawKey)
+		if rawPackage.Name != "" {
+			name, version = rawPackage.Name, rawPackage.Version
+		}
+		key := packageKey(name, version)
+		if pkg, ok := lockfile.Packages[key]; ok {
+			// another peer dependencies variant of the same package
+			mergeDependencyKeys(&pkg.Dependencies, pnpmDependencyKeys(major, rawPackage.Dependencies))
+			mergeDependencyKeys(&pkg.OptionalDependencies, pnpmDependencyKeys(major, rawPackage.OptionalDependencies))
+			continue
+		}
+		pkg := &LockfilePackage{
+			Name:                 name,
+			Version:              version,
+			Integrity:            rawPackage.Resolution.Integrity,
+			Resolved:             rawPackage.Resolution.Tarball,
+			PeerDependencies:     rawPackage.PeerDependencies,
+			Dependencies:         pnpmDependencyKeys(major, rawPackage.Dependencies),
+			OptionalDependencies: pnpmDependencyKeys(major, rawPackage.OptionalDependencies),
+			Dev:                  rawPackage.Dev,
+			Optional:             rawPackage.Optional,
+		}
+		switch {
+		case rawPackage.Resolution.Repo != "":
+			pkg.Resolved = rawPackage.Resolution.Repo + "#" + rawPackage.Resolution.Commit
+		case rawPackage.Resolution.Directory != "":
+			pkg.Resolved = "file:" + rawPackage.Resolution.Directory
+		case pkg.Resolved == "":
+			pkg.Resolved = registryTarballURL(name, version)
+		}
+		lockfile.Packages[key] = pkg
+	}
+
+	for _, rawKey := range sortedKeys(raw.Snapshots) {
+		snapshot := raw.Snapshots[rawKey]
+		name, version := pnpmPackageKey(major, rawKey)
+		pkg, ok := lockfile.Packages[packageKey(name, version)]
+		if !ok {
+			continue
+		}
+		mergeDependencyKeys(&pkg.Dependencies, pnpmDependencyKeys(major, snapshot.Dependencies))
+		mergeDependencyKeys(&pkg.OptionalDependencies, pnpmDependencyKeys(major, snapshot.OptionalDependencies))
+		pkg.Optional = pkg.Optional || snapshot.Optional
+	}
+
+	return lockfile, nil
+}
+
+// pnpmPackageKey parses a packages key:
+// /name/1.0.0_peer@1.0.0 (v5), /name@1.0.0(peer@1.0.0) (v6), name@1.0.0(peer@1.0.0) (v9)
+func pnpmPackageKey(major int, rawKey string) (name string, version string) {
+	key := strings.TrimPrefix(rawKey, "/")
+	if major >= 6 {
+		key, _, _ = strings.Cut(key, "(")
+		return splitDescriptor(key)
+	}
+	i := strings.LastIndex(key, "/")
+	if i < 0 {
+		return key, ""
+	}
+	version, _, _ = strings.Cut(key[i+1:], "_")
+	return key[:i], version
+}
+
+// pnpmDependencyKey returns the package key and version of a dependency reference,
+// which is either a version (with peer dependencies suffix) or a package key for aliases
+func pnpmDependencyKey(major int, name string, reference string) (key string, version string) {
+	isKey := strings.HasPrefix(reference, "/")
+	if major >= 9 {
+		withoutPeers, _, _ := strings.Cut(reference, "(")
+		isKey = strings.Contains(withoutPeers, "@")
+	}
+	if isKey {
+		aliasName, aliasVersion := pnpmPackageKey(major, reference)
+		return packageKey(aliasName, aliasVersion), aliasVersion
+	}
+	if major >= 6 {
+		version, _, _ = strings.Cut(reference, "(")
+	} else {
+		version, _, _ = strings.Cut(reference, "_")
+	}
+	return packageKey(name, version), version
+}
+
+// pnpmDependencyKeys maps the dependencies of a package to their package keys, skipping links
+func pnpmDependencyKeys(major int, dependencies map[string]string) map[string]string {
+	if dependencies == nil {
+		return nil
+	}
+	keys := make(map[string]string, len(dependencies))
+	for name, reference := range dependencies {
+		if strings.HasPrefix(reference, "link:") {
+			continue
+		}
+		keys[name], _ = pnpmDependencyKey(major, name, reference)
+	}
+	return keys
+}
+
+// mergeDependencyKeys adds to dependencies the dependencies it doesn't have yet
+func mergeDependencyKeys(dependencies *map[string]string, other map[string]string) {
+	for name, key := range other {
+		if *dependencies == nil {
+			*dependencies = map[string]string{}
+		}
+		if _, ok := (*dependencies)[name]; !ok {
+			(*dependencies)[name] = key
+		}
+	}
+}
+
+// marshalPnpmLockfile writes a lockfile in the pnpm-lock.yaml v9 format. Peer dependency suffixes
+// are not recorded in Lockfile, pnpm adds them back on the next install without changing versions.
+func marshalPnpmLockfile(lockfile *Lockfile) ([]byte, error) {
+	root := yamlMapping()
+	lockfileVersion := yamlScalar("9.0")
+	lockfileVersion.Style = yaml.SingleQuotedStyle
+	appendYamlPair(root, "lockfileVersion", lockfileVersion)
+	settings := yamlMapping()
+	appendYamlPair(settings, "autoInstallPeers", yamlBool(true))
+	appendYamlPair(settings, "excludeLinksFromLockfile", yamlBool(false))
+	appendYamlPair(root, "settings", settings)
+
+	importers := yamlMapping()
+	for _, dir := range sortedKeys(lockfile.Importers) {
+		importer := lockfile.Importers[dir]
+		node := yamlMapping()
+		for _, field := range []string{"dependencies", "devDependencies", "optionalDependencies"} {
+			dependencies := yamlMapping()
+			for _, name := range sortedKeys(importer.Dependencies) {
+				dependency := importer.Dependencies[name]
+				if dependency.Field != field && (dependency.Field != "" || field != "dependencies") {
+					continue
+				}
+				var version string
+				if dependency.Link != "" {
+					version = "link:" + relativePath(dir, dependency.Link)
+				} else if pkg, ok := lockfile.Packages[dependency.Package]; ok {
+					version = pnpmDependencyReference(name, pkg)
+				} else {
+					continue
+				}
+				entry := yamlMapping()
+				appendYamlPair(entry, "specifier", yamlScalar(dependency.Specifier))
+				appendYamlPair(entry, "version", yamlScalar(version))
+				appendYamlPair(dependencies, name, entry)
+			}
+			if len(dependencies.Content) > 0 {
+				appendYamlPair(node, field, dependencies)
+			}
+		}
+		if len(node.Content) == 0 {
+			node.Style = yaml.FlowStyle
+		}
+		appendYamlPair(importers, dir, node)
+	}
+	appendYamlPair(root, "importers", importers)
+
+	packages := yamlMapping()
+	snapshots := yamlMapping()
+	for _, key := range sortedKeys(lockfile.Packages) {
+		pkg := lockfile.Packages[key]
+		rawKey := pkg.Name + "@" + pkg.Version
+		resolution, err := pnpmResolution(pkg)
+		if err != nil {
+			return nil, err
+		}
+		node := yamlMapping()
+		appendYamlPair(node, "resolution", resolution)
+		if len(pkg.PeerDependencies) > 0 {
+			peers := yamlMapping()
+			for _, name := range sortedKeys(pkg.PeerDependencies) {
+				appendYamlPair(peers, name, yamlScalar(pkg.PeerDependencies[name]))
+			}
+			appendYamlPair(node, "peerDependencies", peers)
+		}
+		appendYamlPair(packages, rawKey, node)
+
+		snapshot := yamlMapping()
+		for _, field := range []struct {
+			name         string
+			dependencies map[string]string
+		}{
+			{"dependencies", pkg.Dependencies},
+			{"optionalDependencies", pkg.OptionalDependencies},
+		} {
+			dependencies := yamlMapping()
+			for _, name := range sortedKeys(field.dependencies) {
+				if dependency, ok := lockfile.Packages[field.dependencies[name]]; ok {
+					appendYamlPair(dependencies, name, yamlScalar(pnpmDependencyReference(name, dependency)))
+				}
+			}
+			if len(dependencies.Content) > 0 {
+				appendYamlPair(snapshot, field.name, dependencies)
+			}
+		}
+		if pkg.Optional {
+			appendYamlPair(snapshot, "optional", yamlBool(true))
+		}
+		if len(snapshot.Content) == 0 {
+			snapshot.Style = yaml.FlowStyle
+		}
+		appendYamlPair(snapshots, rawKey, snapshot)
+	}
+	appendYamlPair(root, "packages", packages)
+	appendYamlPair(root, "snapshots", snapshots)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	// pnpm separates top level keys and the entries of importers, packages and snapshots with blank lines
+	var out bytes.Buffer
+	section := ""
+	for i, line := range strings.SplitAfter(buf.String(), "\n") {
+		if !strings.HasPrefix(line, " ") && line != "" {
+			section, _, _ = strings.Cut(line, ":")
+			if i > 0 {
+				out.WriteString("\n")
+			}
+		} else if section != "settings" && strings.HasPrefix(line, "  ") && !strings.HasPrefix(line, "   ") {
+			out.WriteString("\n")
+		}
+		out.WriteString(line)
+	}
+	return out.Bytes(), nil
+}
+
+// pnpmDependencyReference returns the reference to pkg of a dependency named name: its version,
+// or its name and version for aliases
+func pnpmDependencyReference(name string, pkg *LockfilePackage) string {
+	if pkg.Name != name {
+		return pkg.Name + "@" + pkg.Version
+	}
+	return pkg.Version
+}
+
+// pnpmResolution returns the resolution of a package: its integrity, and its tarball
+// when it doesn't come from the npm registry
+func pnpmResolution(pkg *LockfilePackage) (*yaml.Node, error) {
+	integrity := pkg.Integrity
+	if integrity == "" {
+		integrity = yarnSha1Integrity(pkg.Resolved)
+	}
+	unsupported := func(reason string) error {
+		return &UnsupportedConfigError{Manager: "nodejs-pnpm", Reason: packageKey(pkg.Name, pkg.Version) + ": " + reason}
+	}
+	if pkg.Resolved != "" && !strings.HasPrefix(pkg.Resolved, "https://") && !strings.HasPrefix(pkg.Resolved, "http://") {
+		return nil, unsupported("resolution " + pkg.Resolved + " can't be converted")
+	}
+	if integrity == "" {
+		return nil, unsupported("no integrity recorded")
+	}
+	resolution := yamlMapping()
+	resolution.Style = yaml.FlowStyle
+	appendYamlPair(resolution, "integrity", yamlScalar(integrity))
+	if pkg.Resolved != "" && !isRegistryTarballURL(pkg.Name, pkg.Version, pkg.Resolved) {
+		appendYamlPair(resolution, "tarball", yamlScalar(pkg.Resolved))
+	}
+	return resolution, nil
+}
+
+func yamlMapping() *yaml.Node {
+	return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+}
+
+func yamlScalar(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+func yamlBool(value bool) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(value)}
+}
+
+func appendYamlPair(mapping *yaml.Node, key string, value *yaml.Node) {
+	mapping.Content = append(mapping.Content, yamlScalar(key), value)
+}
@@ -0,0 +1,109 @@
+package packagemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// pnpmWorkspaceFile is the pnpm workspace configuration
+const pnpmWorkspaceFile = "pnpm-workspace.yaml"
+
+// ReadPnpmSettings returns the pnpm settings in effect for the project in projectDirectory.
+// See ReadPnpmSettingsFS.
+func (pm PackageManager) ReadPnpmSettings(projectDirectory string) (*PnpmWorkspaces, error) {
+	return pm.ReadPnpmSettingsFS(os.DirFS(projectDirectory))
+}
+
+// ReadPnpmSettingsFS returns the pnpm settings in effect for the project stored
+// at the root of fsys. It fails with an UnsupportedConfigError for package managers
+// whose Behavior doesn't implement PnpmSettingsReader.
+func (pm PackageManager) ReadPnpmSettingsFS(fsys fs.FS) (*PnpmWorkspaces, error) {
+	reader, ok := pm.Behavior.(PnpmSettingsReader)
+	if behavior, isFuncs := pm.Behavior.(BehaviorFuncs); isFuncs && behavior.ReadPnpmSettingsFunc == nil {
+		ok = false
+	}
+	if !ok {
+		return nil, &UnsupportedConfigError{Manager: pm.Name, Reason: "pnpm settings are not supported"}
+	}
+	return reader.ReadPnpmSettings(fsys)
+}
+
+// readPnpmSettingsFS returns the pnpm settings in effect for the project stored
+// at the root of fsys, merged from the pnpm field of package.json and pnpm-workspace.yaml.
+// The entries of map settings (overrides, patchedDependencies, packageExtensions) are
+// merged one by one, those of pnpm-workspace.yaml taking precedence; other settings
+// defined in pnpm-workspace.yaml replace the ones of package.json.
+// The default catalog is available both as Catalog and Catalogs["default"].
+func readPnpmSettingsFS(fsys fs.FS) (*PnpmWorkspaces, error) {
+	pkg, err := readPackageJSON(fsys, "package.json")
+	if err != nil {
+		return nil, err
+	}
+	settings := &PnpmWorkspaces{}
+	if pkg.Pnpm != nil {
+		// the pnpm field is untyped, round trip it through json to decode it
+		bytes, err := json.Marshal(pkg.Pnpm)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(bytes, settings); err != nil {
+			return nil, &ParseError{File: "package.json", Err: fmt.Errorf("invalid pnpm field: %w", err)}
+		}
+	}
+
+	if !FileExistsFS(fsys, pnpmWorkspaceFile) {
+		return settings, nil
+	}
+	bytes, err := fs.ReadFile(fsys, pnpmWorkspaceFile)
+	if err != nil {
+		return nil, err
+	}
+	var workspace PnpmWorkspaces
+	if err := yaml.Unmarshal(bytes, &workspace); err != nil {
+		return nil, newYamlParseError(pnpmWorkspaceFile, err)
+	}
+
+	settings.Packages = workspace.Packages
+	if workspace.Catalog != nil || workspace.Catalogs != nil {
+		if _, ok := workspace.Catalogs["default"]; ok && workspace.Catalog != nil {
+			return nil, &ParseError{File: pnpmWorkspaceFile, Err: fmt.Errorf("the default catalog is defined by both catalog and catalogs.default")}
+		}
+		settings.Catalogs = map[string]map[string]string{}
+		for name, catalog := range workspace.Catalogs {
+			settings.Catalogs[name] = catalog
+		}
+		if workspace.Catalog != nil {
+			settings.Catalogs["default"] = workspace.Catalog
+		}
+		settings.Catalog = settings.Catalogs["default"]
+	}
+	settings.Overrides = mergeSettingEntries(settings.Overrides, workspace.Overrides)
+	settings.PatchedDependencies = mergeSettingEntries(settings.PatchedDependencies, workspace.PatchedDependencies)
+	if workspace.OnlyBuiltDependencies != nil {
+		settings.OnlyBuiltDependencies = workspace.OnlyBuiltDependencies
+	}
+	if workspace.NeverBuiltDependencies != nil {
+		settings.NeverBuiltDependencies = workspace.NeverBuiltDependencies
+	}
+	settings.PackageExtensions = mergeSettingEntries(settings.PackageExtensions, workspace.PackageExtensions)
+	return settings, nil
+}
+
+// mergeSettingEntries returns the entries of base overridden by those of override
+func mergeSettingEntries[V any](base map[string]V, override map[string]V) map[string]V {
+	if override == nil {
+		return base
+	}
+	merged := make(map[string]V, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		merged[key] = value
+	}
+	return merged
+}
@@ -0,0 +1,110 @@
+package packagemanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/software-t-rex/packageJson"
+)
+
+// workspaceProtocol prefixes dependency ranges resolved to a workspace of the project
+const workspaceProtocol = "workspace:"
+
+// PublishManifest returns the package.json contents manifest ready to be published: its workspace:
+// ranges are replaced with the versions of the sibling workspaces, as pnpm and yarn berry do when
+// packing. The other fields and the formatting of manifest are left untouched.
+//
+//   - workspace:* becomes 1.2.3
+//   - workspace:^ and workspace:~ become ^1.2.3 and ~1.2.3
+//   - workspace:^1.0.0 becomes ^1.0.0, provided the workspace version satisfies it
+//   - workspace:other@* (an alias) becomes npm:other@1.2.3
+//
+// It fails with ErrUnknownWorkspace when a range references a package that is not
+// in workspaces, and with ErrPrivateWorkspace when a dependency references a private
+// workspace. devDependencies may reference private workspaces as consumers of the
+// package don't install them.
+func PublishManifest(manifest []byte, workspaces []*packageJson.PackageJSON) ([]byte, error) {
+	pkg := &packageJson.PackageJSON{}
+	if err := json.Unmarshal(manifest, pkg); err != nil {
+		return nil, &ParseError{File: "package.json", Line: jsonErrorLine(manifest, err), Err: err}
+	}
+
+	workspacesByName := map[string]*packageJson.PackageJSON{}
+	for _, workspace := range workspaces {
+		workspacesByName[workspace.Name] = workspace
+	}
+
+	published := manifest
+	var errs []error
+	for _, field := range dependencyFields(pkg) {
+		for _, name := range sortedKeys(field.Dependencies) {
+			versionRange := field.Dependencies[name]
+			if !strings.HasPrefix(versionRange, workspaceProtocol) {
+				continue
+			}
+			resolved, err := resolveWorkspaceRange(name, versionRange, workspacesByName, field.Name != "devDependencies")
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s of %s: %w", field.Name, pkg.Name, err))
+				continue
+			}
+			if published, err = setJSONField(published, []string{field.Name, name}, resolved); err != nil {
+				return nil, &ParseError{File: "package.json", Err: err}
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return published, nil
+}
+
+// resolveWorkspaceRange returns the published range of a workspace: range
+func resolveWorkspaceRange(name string, versionRange string, workspaces map[string]*packageJson.PackageJSON, public bool) (string, error) {
+	target := name
+	spec := strings.TrimPrefix(versionRange, workspaceProtocol)
+	alias := false
+	if strings.HasPrefix(spec, ".") || (strings.Contains(spec, "/") && !strings.HasPrefix(spec, "@")) {
+		return "", fmt.Errorf("%s: path references (%s) are not supported", name, versionRange)
+	}
+	if aliasName, aliasRange := splitDescriptor(spec); len(spec) > 1 && strings.Contains(spec[1:], "@") {
+		target, spec, alias = aliasName, aliasRange, true
+	}
+
+	workspace, ok := workspaces[target]
+	if !ok {
+		return "", fmt.Errorf("%s: %w %s", name, ErrUnknownWorkspace, target)
+	}
+	if workspace.Private && public {
+		return "", fmt.Errorf("%s: %w %s can't be a dependency of a published package", name, ErrPrivateWorkspace, target)
+	}
+	if workspace.Version == "" {
+		return "", fmt.Errorf("%s: workspace %s has no version", name, target)
+	}
+
+	resolved := spec
+	switch spec {
+	case "", "*":
+		resolved = workspace.Version
+	case "^", "~":
+		resolved = spec + workspace.Version
+	default:
+		constraint, err := semver.NewConstraint(spec)
+		if err != nil {
+			return "", fmt.Errorf("%s: invalid range %s: %w", name, versionRange, err)
+		}
+		version, err := semver.NewVersion(workspace.Version)
+		if err != nil {
+			return "", fmt.Errorf("%s: invalid version %s for workspace %s: %w", name, workspace.Version, target, err)
+		}
+		if !constraint.Check(version) {
+			return "", fmt.Errorf("%s: workspace %s@%s does not satisfy %s", name, target, workspace.Version, versionRange)
+		}
+	}
+	if alias {
+		return "npm:" + target + "@" + resolved, nil
+	}
+	return resolved, nil
+}
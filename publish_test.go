@@ -0,0 +1,82 @@
+package packagemanager
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/software-t-rex/packageJson"
+	"gotest.tools/v3/assert"
+)
+
+func Test_PublishManifest(t *testing.T) {
+	workspaces := []*packageJson.PackageJSON{
+		{Name: "ui", Version: "1.4.0"},
+		{Name: "@acme/utils", Version: "2.0.1"},
+		{Name: "tsconfig", Version: "0.0.0", Private: true},
+	}
+	manifest := `{
+  "name": "web",
+  "version": "1.0.0",
+  "type": "module",
+  "exports": {".": "./index.js"},
+  "types": "index.d.ts",
+  "sideEffects": false,
+  "dependencies": {
+    "ui": "workspace:*",
+    "@acme/utils": "workspace:^",
+    "utils-alias": "workspace:@acme/utils@~",
+    "react": "^18.2.0"
+  },
+  "peerDependencies": {"ui": "workspace:^1.2.0"},
+  "devDependencies": {"tsconfig": "workspace:*"},
+  "optionalDependencies": {"ui": "workspace:"}
+}
+`
+
+	published, err := PublishManifest([]byte(manifest), workspaces)
+	assert.NilError(t, err)
+	// fields unknown to packageJson.PackageJSON and the formatting are kept
+	assert.Equal(t, string(published), `{
+  "name": "web",
+  "version": "1.0.0",
+  "type": "module",
+  "exports": {".": "./index.js"},
+  "types": "index.d.ts",
+  "sideEffects": false,
+  "dependencies": {
+    "ui": "1.4.0",
+    "@acme/utils": "^2.0.1",
+    "utils-alias": "npm:@acme/utils@~2.0.1",
+    "react": "^18.2.0"
+  },
+  "peerDependencies": {"ui": "^1.2.0"},
+  "devDependencies": {"tsconfig": "0.0.0"},
+  "optionalDependencies": {"ui": "1.4.0"}
+}
+`)
+
+	tests := []struct {
+		name         string
+		dependencies map[string]string
+		wantErr      error
+		wantMessage  string
+	}{
+		{name: "unknown", dependencies: map[string]string{"api": "workspace:*"}, wantErr: ErrUnknownWorkspace},
+		{name: "private", dependencies: map[string]string{"tsconfig": "workspace:*"}, wantErr: ErrPrivateWorkspace},
+		{name: "unsatisfied", dependencies: map[string]string{"ui": "workspace:^2.0.0"}, wantMessage: "does not satisfy"},
+		{name: "path", dependencies: map[string]string{"ui": "workspace:packages/ui"}, wantMessage: "not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest, err := json.Marshal(map[string]interface{}{"name": "web", "dependencies": tt.dependencies})
+			assert.NilError(t, err)
+			_, err = PublishManifest(manifest, workspaces)
+			if tt.wantErr != nil {
+				assert.Assert(t, errors.Is(err, tt.wantErr), "PublishManifest() error = %v", err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantMessage)
+			}
+		})
+	}
+}
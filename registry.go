@@ -0,0 +1,273 @@
+package packagemanager
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"sync"
+
+	"github.com/Masterminds/semver"
+	"github.com/software-t-rex/packageJson"
+)
+
+// Behavior implements the parts of a PackageManager that differ from one tool to another.
+type Behavior interface {
+	// Matches tests a manager and version tuple to see if it is the Package Manager.
+	Matches(manager string, version string) (bool, error)
+
+	// Detect if the project stored at the root of fsys is using the Package Manager.
+	// It may set packageManager.Version when it can be resolved during detection.
+	Detect(fsys fs.FS, packageManager *PackageManager) (bool, error)
+
+	// WorkspaceGlobs returns the list of workspace globs of the project stored at the root of fsys.
+	WorkspaceGlobs(fsys fs.FS) ([]string, error)
+
+	// WorkspaceIgnores returns the list of workspace ignore globs of the project stored at the root of fsys.
+	WorkspaceIgnores(pm PackageManager, fsys fs.FS) ([]string, error)
+
+	// CanPrune returns if we know how to produce a pruned workspace for the project stored at the root of fsys.
+	CanPrune(fsys fs.FS) (bool, error)
+
+	// PrunePatches prunes the given pkgJSON to only include references to the given patches.
+	// Missing sections are not an error, the returned summary lists the removed references.
+	PrunePatches(pkgJSON *packageJson.PackageJSON, patches []string) (*PruneSummary, error)
+
+	// ArgSeparator returns the argument separator for the given version, which may be nil.
+	// ok is false when the separator doesn't depend on the version, in which case
+	// the ArgSeparator of the PackageManager is used as is.
+	ArgSeparator(version *semver.Version) (separator []string, ok bool)
+}
+
+// LockfilePatchPruner is implemented by the Behavior of package managers recording patches in their lockfile.
+type LockfilePatchPruner interface {
+	// PruneLockfilePatches returns the lockfile contents only referencing the given patches.
+	PruneLockfilePatches(contents []byte, patches []string) ([]byte, error)
+}
+
+// WorkspaceConfigurationPatchPruner is implemented by the Behavior of package managers
+// declaring patches in their workspace configuration file.
+type WorkspaceConfigurationPatchPruner interface {
+	// PruneWorkspaceConfigurationPatches returns the workspace configuration contents only referencing the given patches.
+	PruneWorkspaceConfigurationPatches(contents []byte, patches []string) ([]byte, *PruneSummary, error)
+}
+
+// PatchLister is implemented by the Behavior of package managers supporting patches.
+type PatchLister interface {
+	// ListPatches returns the patch files referenced by the project stored at the root of fsys.
+	ListPatches(fsys fs.FS) ([]Patch, error)
+}
+
+// PnpmSettingsReader is implemented by the Behavior of package managers reading pnpm settings.
+type PnpmSettingsReader interface {
+	// ReadPnpmSettings returns the pnpm settings in effect for the project stored at the root of fsys.
+	ReadPnpmSettings(fsys fs.FS) (*PnpmWorkspaces, error)
+}
+
+// BehaviorFuncs implements Behavior with plain functions.
+// Nil functions report a Package Manager that matches nothing and supports nothing.
+type BehaviorFuncs struct {
+	MatchesFunc          func(manager string, version string) (bool, error)
+	DetectFunc           func(fsys fs.FS, packageManager *PackageManager) (bool, error)
+	WorkspaceGlobsFunc   func(fsys fs.FS) ([]string, error)
+	WorkspaceIgnoresFunc func(pm PackageManager, fsys fs.FS) ([]string, error)
+	CanPruneFunc         func(fsys fs.FS) (bool, error)
+	PrunePatchesFunc     func(pkgJSON *packageJson.PackageJSON, patches []string) (*PruneSummary, error)
+	ArgSeparatorFunc     func(version *semver.Version) []string
+
+	// PruneLockfilePatchesFunc implements LockfilePatchPruner, nil leaves lockfiles unchanged.
+	PruneLockfilePatchesFunc func(contents []byte, patches []string) ([]byte, error)
+
+	// PruneWorkspaceConfigurationPatchesFunc implements WorkspaceConfigurationPatchPruner,
+	// nil leaves workspace configurations unchanged.
+	PruneWorkspaceConfigurationPatchesFunc func(contents []byte, patches []string) ([]byte, *PruneSummary, error)
+
+	// ListPatchesFunc implements PatchLister, nil lists no patches.
+	ListPatchesFunc func(fsys fs.FS) ([]Patch, error)
+
+	// UnmarshalLockfileFunc implements LockfileUnmarshaler, nil reads no lockfile.
+	UnmarshalLockfileFunc func(contents []byte) (*Lockfile, error)
+
+	// MarshalLockfileFunc implements LockfileMarshaler, nil writes no lockfile.
+	MarshalLockfileFunc func(lockfile *Lockfile) ([]byte, error)
+
+	// ReadPnpmSettingsFunc implements PnpmSettingsReader, nil doesn't support pnpm settings.
+	ReadPnpmSettingsFunc func(fsys fs.FS) (*PnpmWorkspaces, error)
+}
+
+func (b BehaviorFuncs) Matches(manager string, version string) (bool, error) {
+	if b.MatchesFunc == nil {
+		return false, nil
+	}
+	return b.MatchesFunc(manager, version)
+}
+
+func (b BehaviorFuncs) Detect(fsys fs.FS, packageManager *PackageManager) (bool, error) {
+	if b.DetectFunc == nil {
+		return false, nil
+	}
+	return b.DetectFunc(fsys, packageManager)
+}
+
+func (b BehaviorFuncs) WorkspaceGlobs(fsys fs.FS) ([]string, error) {
+	if b.WorkspaceGlobsFunc == nil {
+		return nil, ErrNoWorkspaces
+	}
+	return b.WorkspaceGlobsFunc(fsys)
+}
+
+func (b BehaviorFuncs) WorkspaceIgnores(pm PackageManager, fsys fs.FS) ([]string, error) {
+	if b.WorkspaceIgnoresFunc == nil {
+		return nil, nil
+	}
+	return b.WorkspaceIgnoresFunc(pm, fsys)
+}
+
+func (b BehaviorFuncs) CanPrune(fsys fs.FS) (bool, error) {
+	if b.CanPruneFunc == nil {
+		return false, nil
+	}
+	return b.CanPruneFunc(fsys)
+}
+
+func (b BehaviorFuncs) PrunePatches(pkgJSON *packageJson.PackageJSON, patches []string) (*PruneSummary, error) {
+	if b.PrunePatchesFunc == nil {
+		return &PruneSummary{}, nil
+	}
+	return b.PrunePatchesFunc(pkgJSON, patches)
+}
+
+func (b BehaviorFuncs) ArgSeparator(version *semver.Version) ([]string, bool) {
+	if b.ArgSeparatorFunc == nil {
+		return nil, false
+	}
+	return b.ArgSeparatorFunc(version), true
+}
+
+func (b BehaviorFuncs) PruneLockfilePatches(contents []byte, patches []string) ([]byte, error) {
+	if b.PruneLockfilePatchesFunc == nil {
+		return contents, nil
+	}
+	return b.PruneLockfilePatchesFunc(contents, patches)
+}
+
+func (b BehaviorFuncs) PruneWorkspaceConfigurationPatches(contents []byte, patches []string) ([]byte, *PruneSummary, error) {
+	if b.PruneWorkspaceConfigurationPatchesFunc == nil {
+		return contents, &PruneSummary{}, nil
+	}
+	return b.PruneWorkspaceConfigurationPatchesFunc(contents, patches)
+}
+
+func (b BehaviorFuncs) ListPatches(fsys fs.FS) ([]Patch, error) {
+	if b.ListPatchesFunc == nil {
+		return nil, nil
+	}
+	return b.ListPatchesFunc(fsys)
+}
+
+func (b BehaviorFuncs) UnmarshalLockfile(contents []byte) (*Lockfile, error) {
+	if b.UnmarshalLockfileFunc == nil {
+		return nil, nil
+	}
+	return b.UnmarshalLockfileFunc(contents)
+}
+
+func (b BehaviorFuncs) MarshalLockfile(lockfile *Lockfile) ([]byte, error) {
+	if b.MarshalLockfileFunc == nil {
+		return nil, nil
+	}
+	return b.MarshalLockfileFunc(lockfile)
+}
+
+var (
+	registryMu sync.RWMutex
+
+	// built-ins are registered by default, they all have priority 0
+	packageManagers = []PackageManager{
+		nodejsYarn,
+		nodejsBerry,
+		nodejsNpm,
+		nodejsPnpm,
+	}
+)
+
+// Register adds a package manager to the ones used by GetPackageManagerFromString
+// and DetectPackageManager. Package managers are tried by descending Priority
+// then by registration order, built-ins having a priority of 0.
+// Registering a package manager with the Name of an already registered one replaces it
+// in place, allowing to override the built-ins.
+func Register(pm PackageManager) error {
+	if pm.Name == "" {
+		return fmt.Errorf("can't register a package manager without a name")
+	}
+	if pm.Behavior == nil {
+		return fmt.Errorf("can't register package manager %s without a behavior", pm.Name)
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registered := append([]PackageManager(nil), packageManagers...)
+	replaced := false
+	for i, packageManager := range registered {
+		if packageManager.Name == pm.Name {
+			registered[i] = pm
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		registered = append(registered, pm)
+	}
+	sort.SliceStable(registered, func(i, j int) bool {
+		return registered[i].Priority > registered[j].Priority
+	})
+	packageManagers = registered
+	return nil
+}
+
+// Unregister removes the package manager with the given name, built-ins included.
+// It returns false if no such package manager was registered.
+func Unregister(name string) bool {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for i, packageManager := range packageManagers {
+		if packageManager.Name == name {
+			packageManagers = append(packageManagers[:i:i], packageManagers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// RegisteredPackageManagers returns the registered package managers in detection order.
+func RegisteredPackageManagers() []PackageManager {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return append([]PackageManager(nil), packageManagers...)
+}
+
+// registeredSlugs returns the unique slugs of the registered package managers
+func registeredSlugs() []string {
+	var slugs []string
+	for _, packageManager := range RegisteredPackageManagers() {
+		if !contains(slugs, packageManager.Slug) {
+			slugs = append(slugs, packageManager.Slug)
+		}
+	}
+	return slugs
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (b BehaviorFuncs) ReadPnpmSettings(fsys fs.FS) (*PnpmWorkspaces, error) {
+	if b.ReadPnpmSettingsFunc == nil {
+		return nil, &UnsupportedConfigError{Reason: "pnpm settings are not supported"}
+	}
+	return b.ReadPnpmSettingsFunc(fsys)
+}
@@ -0,0 +1,71 @@
+package packagemanager
+
+import (
+	"io/fs"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+var nodejsCustom = PackageManager{
+	Name:         "nodejs-custom",
+	Slug:         "custom",
+	Command:      "custom",
+	Specfile:     "package.json",
+	Lockfile:     "custom.lock",
+	PackageDir:   "node_modules",
+	ArgSeparator: []string{"--"},
+	Priority:     10,
+
+	Behavior: BehaviorFuncs{
+		MatchesFunc: func(manager string, version string) (bool, error) {
+			return manager == "custom", nil
+		},
+		DetectFunc: func(fsys fs.FS, packageManager *PackageManager) (bool, error) {
+			return FileExistsFS(fsys, packageManager.Lockfile), nil
+		},
+	},
+}
+
+func Test_Register(t *testing.T) {
+	assert.NilError(t, Register(nodejsCustom))
+	t.Cleanup(func() { Unregister(nodejsCustom.Name) })
+
+	// higher priority comes first
+	registered := RegisteredPackageManagers()
+	assert.Equal(t, registered[0].Name, "nodejs-custom")
+	assert.Equal(t, len(registered), 5)
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"package.json":   "{}",
+		"pnpm-lock.yaml": "lockfileVersion: '6.0'\n",
+		"custom.lock":    "",
+	})
+	pm, err := DetectPackageManager(root)
+	assert.NilError(t, err)
+	assert.Equal(t, pm.Name, "nodejs-custom")
+
+	pm, err = GetPackageManagerFromString("custom@1.0.0")
+	assert.NilError(t, err)
+	assert.Equal(t, pm.Name, "nodejs-custom")
+	assert.Equal(t, pm.Version.String(), "1.0.0")
+
+	// re-registering replaces
+	lowPriority := nodejsCustom
+	lowPriority.Priority = -1
+	assert.NilError(t, Register(lowPriority))
+	registered = RegisteredPackageManagers()
+	assert.Equal(t, len(registered), 5)
+	assert.Equal(t, registered[4].Name, "nodejs-custom")
+	pm, err = DetectPackageManager(root)
+	assert.NilError(t, err)
+	assert.Equal(t, pm.Name, "nodejs-pnpm")
+
+	assert.Assert(t, Unregister("nodejs-custom"))
+	assert.Assert(t, !Unregister("nodejs-custom"))
+	_, err = GetPackageManagerFromString("custom@1.0.0")
+	assert.ErrorContains(t, err, "expected <yarn|npm|pnpm>")
+
+	assert.ErrorContains(t, Register(PackageManager{Name: "nodejs-nobehavior"}), "without a behavior")
+}
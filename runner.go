@@ -0,0 +1,160 @@
+package packagemanager
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCommandTimeout is the maximum duration of the package manager commands run by
+// an OSRunner without Timeout.
+const DefaultCommandTimeout = 30 * time.Second
+
+// DefaultCommandEnv returns the environment defaults of the package manager commands run
+// by an OSRunner without Env, making sure they never wait for user input.
+func DefaultCommandEnv() []string {
+	return []string{
+		// corepack asks before downloading a missing package manager
+		"COREPACK_ENABLE_DOWNLOAD_PROMPT=0",
+		// npm may check for updates and print a notice
+		"npm_config_update_notifier=false",
+	}
+}
+
+// commandWaitDelay bounds the time we wait for the outputs of a killed command to be closed,
+// which may never happen if it spawned children inheriting them
+const commandWaitDelay = time.Second
+
+// RunResult is the outcome of a command that ran to completion.
+type RunResult struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+}
+
+// Runner runs package manager commands.
+type Runner interface {
+	// Run runs argv in dir, with env added to the runner environment.
+	// A non-zero exit code is not an error, errors are reserved to commands
+	// that couldn't run to completion, in which case the context error is
+	// returned if the command was interrupted by ctx.
+	Run(ctx context.Context, dir string, argv []string, env []string) (RunResult, error)
+}
+
+// OSRunner runs commands on the system. It is the Runner used by package managers without one.
+type OSRunner struct {
+	// The maximum duration of the commands, on top of any deadline of the given context.
+	// Zero means DefaultCommandTimeout, a negative duration no timeout.
+	Timeout time.Duration
+
+	// The environment defaults of the commands, DefaultCommandEnv() when nil.
+	// Variables already set in the process environment take precedence.
+	Env []string
+}
+
+func (r OSRunner) Run(ctx context.Context, dir string, argv []string, env []string) (RunResult, error) {
+	if len(argv) == 0 {
+		return RunResult{}, fmt.Errorf("no command to run")
+	}
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = DefaultCommandTimeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = dir
+	defaults := r.Env
+	if defaults == nil {
+		defaults = DefaultCommandEnv()
+	}
+	cmd.Env = append(commandEnv(os.Environ(), defaults), env...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = commandWaitDelay
+	err := cmd.Run()
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		return RunResult{}, ctxErr
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return RunResult{}, err
+	}
+	return RunResult{Stdout: stdout.Bytes(), Stderr: stderr.Bytes(), ExitCode: cmd.ProcessState.ExitCode()}, nil
+}
+
+// commandEnv returns environ completed with defaults
+func commandEnv(environ []string, defaults []string) []string {
+	env := append([]string(nil), environ...)
+	for _, variable := range defaults {
+		name, _, _ := strings.Cut(variable, "=")
+		if !hasEnv(environ, name) {
+			env = append(env, variable)
+		}
+	}
+	return env
+}
+
+func hasEnv(environ []string, name string) bool {
+	for _, variable := range environ {
+		if strings.HasPrefix(variable, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// ScriptedCommand is the scripted outcome of a command run by a ScriptedRunner.
+type ScriptedCommand struct {
+	Result RunResult
+	Err    error
+}
+
+// RunnerCall records a command run by a ScriptedRunner.
+type RunnerCall struct {
+	Dir  string
+	Argv []string
+	Env  []string
+}
+
+// ScriptedRunner is a Runner replaying scripted outcomes, to test code running
+// package managers without installing them.
+type ScriptedRunner struct {
+	// Script maps space separated argv ("pnpm --version") to their outcome.
+	// Commands missing from the script fail.
+	Script map[string]ScriptedCommand
+
+	mu    sync.Mutex
+	calls []RunnerCall
+}
+
+func (r *ScriptedRunner) Run(ctx context.Context, dir string, argv []string, env []string) (RunResult, error) {
+	r.mu.Lock()
+	r.calls = append(r.calls, RunnerCall{Dir: dir, Argv: argv, Env: env})
+	r.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return RunResult{}, err
+	}
+	command, ok := r.Script[strings.Join(argv, " ")]
+	if !ok {
+		return RunResult{}, fmt.Errorf("unscripted command %q", strings.Join(argv, " "))
+	}
+	return command.Result, command.Err
+}
+
+// Calls returns the commands run so far.
+func (r *ScriptedRunner) Calls() []RunnerCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RunnerCall(nil), r.calls...)
+}
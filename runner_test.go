@@ -0,0 +1,117 @@
+package packagemanager
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+// scriptPackageManager returns a package manager whose command is a shell script
+func scriptPackageManager(t *testing.T, script string) PackageManager {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts are not supported on windows")
+	}
+	command := filepath.Join(t.TempDir(), "pm")
+	assert.NilError(t, os.WriteFile(command, []byte("#!/bin/sh\n"+script), 0o755))
+	pm := nodejsNpm
+	pm.Command = command
+	return pm
+}
+
+func Test_GetVersionContext(t *testing.T) {
+	t.Setenv("COREPACK_ENABLE_DOWNLOAD_PROMPT", "")
+	os.Unsetenv("COREPACK_ENABLE_DOWNLOAD_PROMPT")
+
+	pm := scriptPackageManager(t, "echo \"1.2.3+$COREPACK_ENABLE_DOWNLOAD_PROMPT\"\n")
+	version, err := pm.GetVersionContext(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, version, "1.2.3+0")
+	version, err = pm.GetStandardVersion()
+	assert.NilError(t, err)
+	assert.Equal(t, version, "1.2.3")
+
+	// environment takes precedence over defaults
+	t.Setenv("COREPACK_ENABLE_DOWNLOAD_PROMPT", "1")
+	version, err = pm.GetVersion()
+	assert.NilError(t, err)
+	assert.Equal(t, version, "1.2.3+1")
+}
+
+func Test_GetVersionContext_Timeout(t *testing.T) {
+	pm := scriptPackageManager(t, "sleep 10\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := pm.GetVersionContext(ctx)
+	assert.Assert(t, errors.Is(err, context.DeadlineExceeded), "GetVersionContext() error = %v", err)
+	assert.Assert(t, time.Since(start) < 5*time.Second)
+
+	pm.Runner = OSRunner{Timeout: 100 * time.Millisecond}
+	start = time.Now()
+	_, err = pm.GetVersion()
+	assert.Assert(t, errors.Is(err, context.DeadlineExceeded), "GetVersion() error = %v", err)
+	assert.Assert(t, time.Since(start) < 5*time.Second)
+}
+
+func Test_OSRunner(t *testing.T) {
+	pm := scriptPackageManager(t, "echo out\necho err >&2\necho \"$EXTRA\"\nexit 3\n")
+	result, err := OSRunner{}.Run(context.Background(), t.TempDir(), []string{pm.Command}, []string{"EXTRA=extra"})
+	assert.NilError(t, err)
+	assert.Equal(t, result.ExitCode, 3)
+	assert.Equal(t, string(result.Stdout), "out\nextra\n")
+	assert.Equal(t, string(result.Stderr), "err\n")
+
+	_, err = pm.GetVersion()
+	assert.ErrorContains(t, err, "exit code 3: err")
+
+	_, err = OSRunner{}.Run(context.Background(), "", []string{filepath.Join(t.TempDir(), "missing")}, nil)
+	assert.Assert(t, errors.Is(err, os.ErrNotExist), "Run() error = %v", err)
+
+	t.Setenv("COREPACK_ENABLE_DOWNLOAD_PROMPT", "")
+	os.Unsetenv("COREPACK_ENABLE_DOWNLOAD_PROMPT")
+	pm = scriptPackageManager(t, "echo \"$COREPACK_ENABLE_DOWNLOAD_PROMPT-$CUSTOM\"\n")
+	result, err = OSRunner{Env: []string{"CUSTOM=custom"}}.Run(context.Background(), "", []string{pm.Command}, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, string(result.Stdout), "-custom\n")
+}
+
+func Test_ScriptedRunner(t *testing.T) {
+	runner := &ScriptedRunner{Script: map[string]ScriptedCommand{
+		"yarn --version": {Result: RunResult{Stdout: []byte("1.22.19\n")}},
+	}}
+	yarn := nodejsYarn
+	yarn.Runner = runner
+	assert.NilError(t, Register(yarn))
+	t.Cleanup(func() { assert.NilError(t, Register(nodejsYarn)) })
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"package.json": "{}",
+		"yarn.lock":    "# yarn lockfile v1\n",
+	})
+	pm, err := DetectPackageManager(root)
+	assert.NilError(t, err)
+	assert.Equal(t, pm.Name, "nodejs-yarn")
+	assert.Equal(t, pm.Version.String(), "1.22.19")
+	assert.DeepEqual(t, runner.Calls(), []RunnerCall{{Dir: root, Argv: []string{"yarn", "--version"}}})
+
+	// an installed version inconsistent with the project is ignored
+	runner.Script["yarn --version"] = ScriptedCommand{Result: RunResult{Stdout: []byte("3.2.0\n")}}
+	pm, err = DetectPackageManager(root)
+	assert.NilError(t, err)
+	assert.Equal(t, pm.Name, "nodejs-yarn")
+	assert.Assert(t, pm.Version == nil)
+
+	// the package manager runner takes precedence
+	pm.Runner = &ScriptedRunner{}
+	_, err = pm.GetVersion()
+	assert.ErrorContains(t, err, `unscripted command "yarn --version"`)
+}
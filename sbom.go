@@ -0,0 +1,434 @@
+package packagemanager
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/software-t-rex/packageJson"
+)
+
+// sbomTool is the tool name recorded in the generated SBOMs
+const sbomTool = "js-packagemanager"
+
+// SBOM holds what is needed to generate the software bill of materials of a workspace.
+type SBOM struct {
+	Lockfile *Lockfile
+	// The directory of the workspace the SBOM describes, relative to the project root ("." for the root).
+	Workspace string
+	// The package.json of the project workspaces by directory, the described workspace included.
+	Manifests map[string]*packageJson.PackageJSON
+	// The SPDX license expression of the packages, by key in Lockfile.Packages. Optional.
+	Licenses map[string]string
+	// When the SBOM is created, the current time when zero.
+	Created time.Time
+}
+
+// NewSBOM returns the SBOM of the workspace at dir ("." for the root) of the project in projectDirectory.
+// Package licenses are read from the installed packages when available.
+func (pm PackageManager) NewSBOM(projectDirectory string, dir string) (*SBOM, error) {
+	return pm.NewSBOMFS(os.DirFS(projectDirectory), dir)
+}
+
+// NewSBOMFS is NewSBOM for the project stored at the root of fsys.
+func (pm PackageManager) NewSBOMFS(fsys fs.FS, dir string) (*SBOM, error) {
+	lockfile, err := pm.ReadLockfileFS(fsys)
+	if err != nil {
+		return nil, err
+	}
+	report, err := pm.lockfileLicenses(fsys, lockfile, dir, LicensePolicy{})
+	if err != nil {
+		return nil, err
+	}
+	sbom := &SBOM{Lockfile: lockfile, Workspace: path.Clean(dir), Manifests: map[string]*packageJson.PackageJSON{}, Licenses: map[string]string{}}
+	manifests := []string{"package.json"}
+	workspaces, err := pm.GetWorkspacesFS(fsys)
+	if err != nil && !errors.Is(err, ErrNoWorkspaces) {
+		return nil, err
+	}
+	for _, manifest := range append(manifests, workspaces...) {
+		pkg, err := readPackageJSON(fsys, manifest)
+		if err != nil {
+			return nil, err
+		}
+		sbom.Manifests[path.Dir(manifest)] = pkg
+	}
+	for _, license := range report.Packages {
+		if license.License != "" {
+			sbom.Licenses[license.Package] = license.License
+		}
+	}
+	return sbom, nil
+}
+
+// PackageURL returns the purl of an npm package (pkg:npm/%40scope/name@1.0.0).
+func PackageURL(name string, version string) string {
+	purl := "pkg:npm/"
+	if scope, rest, ok := strings.Cut(name, "/"); ok && strings.HasPrefix(scope, "@") {
+		purl += "%40" + url.PathEscape(scope[1:]) + "/"
+		name = rest
+	}
+	purl += url.PathEscape(name)
+	if version != "" {
+		purl += "@" + url.PathEscape(version)
+	}
+	return purl
+}
+
+// sbomHash is a hash of an integrity
+type sbomHash struct {
+	// the algorithm as named by the integrity (sha512)
+	algorithm string
+	hex       string
+}
+
+// integrityHashes decodes the hashes of a subresource integrity ("sha512-... sha1-...")
+func integrityHashes(integrity string) []sbomHash {
+	var hashes []sbomHash
+	for _, field := range strings.Fields(integrity) {
+		algorithm, digest, ok := strings.Cut(field, "-")
+		if !ok {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(digest)
+		if err != nil {
+			continue
+		}
+		hashes = append(hashes, sbomHash{algorithm: algorithm, hex: hex.EncodeToString(decoded)})
+	}
+	return hashes
+}
+
+// sbomNode is a component of the SBOM: a workspace or a package
+type sbomNode struct {
+	ref         string
+	name        string
+	version     string
+	purl        string
+	pkg         *LockfilePackage
+	license     string
+	dependsOn   []string
+	isWorkspace bool
+}
+
+// nodes returns the described workspace followed by the linked workspaces and the packages, sorted
+func (s SBOM) nodes() ([]*sbomNode, error) {
+	if s.Lockfile == nil {
+		return nil, fmt.Errorf("no lockfile")
+	}
+	workspace := path.Clean(s.Workspace)
+	if _, ok := s.Lockfile.Importers[workspace]; !ok {
+		return nil, fmt.Errorf("%s: %w", workspace, ErrUnknownWorkspace)
+	}
+	refs := map[string]string{}
+	var nodes []*sbomNode
+	workspaces := []string{workspace}
+	for _, dir := range s.Lockfile.linkedImporters(workspace) {
+		if dir != workspace {
+			workspaces = append(workspaces, dir)
+		}
+	}
+	for _, dir := range workspaces {
+		node := &sbomNode{ref: "workspace:" + dir, name: dir, isWorkspace: true}
+		if manifest, ok := s.Manifests[dir]; ok && manifest.Name != "" {
+			node.name, node.version = manifest.Name, manifest.Version
+			node.purl = PackageURL(manifest.Name, manifest.Version)
+		}
+		refs[node.ref] = node.ref
+		nodes = append(nodes, node)
+	}
+	keys := s.Lockfile.closure(workspace)
+	for _, key := range keys {
+		pkg, ok := s.Lockfile.Packages[key]
+		if !ok {
+			continue
+		}
+		node := &sbomNode{ref: PackageURL(pkg.Name, pkg.Version), name: pkg.Name, version: pkg.Version, pkg: pkg, license: s.Licenses[key]}
+		node.purl = node.ref
+		if key != packageKey(pkg.Name, pkg.Version) {
+			// not a registry package, its purl may be shared with the registry version
+			node.ref = key
+		}
+		refs[key] = node.ref
+		nodes = append(nodes, node)
+	}
+
+	for _, node := range nodes {
+		if node.isWorkspace {
+			importer := s.Lockfile.Importers[strings.TrimPrefix(node.ref, "workspace:")]
+			for _, name := range sortedKeys(importer.Dependencies) {
+				dependency := importer.Dependencies[name]
+				if dependency.Link != "" {
+					node.dependsOn = appendUnique(node.dependsOn, refs["workspace:"+path.Clean(dependency.Link)])
+				} else if ref, ok := refs[dependency.Package]; ok {
+					node.dependsOn = appendUnique(node.dependsOn, ref)
+				}
+			}
+			continue
+		}
+		for _, dependencies := range []map[string]string{node.pkg.Dependencies, node.pkg.OptionalDependencies} {
+			for _, name := range sortedKeys(dependencies) {
+				if ref, ok := refs[dependencies[name]]; ok {
+					node.dependsOn = appendUnique(node.dependsOn, ref)
+				}
+			}
+		}
+	}
+	return nodes, nil
+}
+
+func appendUnique(list []string, value string) []string {
+	if value == "" || contains(list, value) {
+		return list
+	}
+	return append(list, value)
+}
+
+func (s SBOM) created() time.Time {
+	if s.Created.IsZero() {
+		return time.Now().UTC()
+	}
+	return s.Created.UTC()
+}
+
+type cdxBOM struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies"`
+}
+
+type cdxMetadata struct {
+	Timestamp string `json:"timestamp"`
+	Tools     struct {
+		Components []cdxComponent `json:"components"`
+	} `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxComponent struct {
+	Type               string                 `json:"type"`
+	BOMRef             string                 `json:"bom-ref,omitempty"`
+	Group              string                 `json:"group,omitempty"`
+	Name               string                 `json:"name"`
+	Version            string                 `json:"version,omitempty"`
+	Purl               string                 `json:"purl,omitempty"`
+	Hashes             []cdxHash              `json:"hashes,omitempty"`
+	Licenses           []cdxLicense           `json:"licenses,omitempty"`
+	ExternalReferences []cdxExternalReference `json:"externalReferences,omitempty"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+// cdxLicense is either an SPDX expression or a license name
+type cdxLicense struct {
+	Expression string          `json:"expression,omitempty"`
+	License    *cdxLicenseName `json:"license,omitempty"`
+}
+
+type cdxLicenseName struct {
+	Name string `json:"name"`
+}
+
+type cdxExternalReference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+// cdxHashAlgorithms are the CycloneDX names of the integrity algorithms
+var cdxHashAlgorithms = map[string]string{"sha1": "SHA-1", "sha256": "SHA-256", "sha384": "SHA-384", "sha512": "SHA-512"}
+
+// CycloneDX returns the SBOM in the CycloneDX 1.5 json format. Packages are identified by their purl,
+// their integrity is recorded as hashes and their dependencies as dependency relationships.
+// Licenses that are not valid SPDX expressions are recorded by name.
+func (s SBOM) CycloneDX() ([]byte, error) {
+	nodes, err := s.nodes()
+	if err != nil {
+		return nil, err
+	}
+	bom := cdxBOM{BOMFormat: "CycloneDX", SpecVersion: "1.5", Version: 1, Components: []cdxComponent{}, Dependencies: []cdxDependency{}}
+	bom.Metadata.Timestamp = s.created().Format(time.RFC3339)
+	bom.Metadata.Tools.Components = []cdxComponent{{Type: "application", Name: sbomTool}}
+	for i, node := range nodes {
+		component := cdxComponent{Type: "library", BOMRef: node.ref, Name: node.name, Version: node.version, Purl: node.purl}
+		if scope, name, ok := strings.Cut(node.name, "/"); ok && strings.HasPrefix(scope, "@") {
+			component.Group, component.Name = scope, name
+		}
+		if isSPDXExpression(node.license) {
+			component.Licenses = []cdxLicense{{Expression: node.license}}
+		} else if node.license != "" {
+			component.Licenses = []cdxLicense{{License: &cdxLicenseName{Name: node.license}}}
+		}
+		if node.pkg != nil {
+			for _, hash := range integrityHashes(node.pkg.Integrity) {
+				if alg, ok := cdxHashAlgorithms[hash.algorithm]; ok {
+					component.Hashes = append(component.Hashes, cdxHash{Alg: alg, Content: hash.hex})
+				}
+			}
+			if strings.HasPrefix(node.pkg.Resolved, "https://") || strings.HasPrefix(node.pkg.Resolved, "http://") {
+				component.ExternalReferences = []cdxExternalReference{{Type: "distribution", URL: node.pkg.Resolved}}
+			}
+		}
+		if i == 0 {
+			component.Type = "application"
+			bom.Metadata.Component = component
+		} else {
+			bom.Components = append(bom.Components, component)
+		}
+		bom.Dependencies = append(bom.Dependencies, cdxDependency{Ref: node.ref, DependsOn: append([]string{}, node.dependsOn...)})
+	}
+	return marshalIndentJSON(bom)
+}
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	Checksums        []spdxChecksum    `json:"checksums,omitempty"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// spdxNoAssertion is the SPDX value of unknown fields
+const spdxNoAssertion = "NOASSERTION"
+
+var spdxIDInvalidChars = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// SPDX returns the SBOM in the SPDX 2.3 json format. Packages are identified by their purl,
+// their integrity is recorded as checksums and their dependencies as DEPENDS_ON relationships.
+// Licenses that are not valid SPDX expressions are declared as NOASSERTION.
+func (s SBOM) SPDX() ([]byte, error) {
+	nodes, err := s.nodes()
+	if err != nil {
+		return nil, err
+	}
+	created := s.created().Format(time.RFC3339)
+	name := nodes[0].name
+	namespace := sha256.Sum256([]byte(name + "@" + nodes[0].version + " " + created))
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              name,
+		DocumentNamespace: "https://spdx.org/spdxdocs/" + url.PathEscape(name) + "-" + hex.EncodeToString(namespace[:8]),
+		CreationInfo:      spdxCreationInfo{Created: created, Creators: []string{"Tool: " + sbomTool}},
+		Packages:          []spdxPackage{},
+		Relationships:     []spdxRelationship{},
+	}
+
+	ids := map[string]string{}
+	used := map[string]bool{}
+	for _, node := range nodes {
+		id := "SPDXRef-Package-" + strings.Trim(spdxIDInvalidChars.ReplaceAllString(node.ref, "-"), "-")
+		for base, i := id, 2; used[id]; i++ {
+			id = fmt.Sprintf("%s-%d", base, i)
+		}
+		used[id] = true
+		ids[node.ref] = id
+
+		pkg := spdxPackage{
+			Name:             node.name,
+			SPDXID:           id,
+			VersionInfo:      node.version,
+			DownloadLocation: spdxNoAssertion,
+			LicenseConcluded: spdxNoAssertion,
+			LicenseDeclared:  spdxNoAssertion,
+			CopyrightText:    spdxNoAssertion,
+		}
+		if isSPDXExpression(node.license) {
+			pkg.LicenseDeclared = node.license
+		}
+		if node.purl != "" {
+			pkg.ExternalRefs = []spdxExternalRef{{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: node.purl}}
+		}
+		if node.pkg != nil {
+			if strings.HasPrefix(node.pkg.Resolved, "https://") || strings.HasPrefix(node.pkg.Resolved, "http://") {
+				pkg.DownloadLocation = node.pkg.Resolved
+			}
+			for _, hash := range integrityHashes(node.pkg.Integrity) {
+				if _, ok := cdxHashAlgorithms[hash.algorithm]; ok {
+					pkg.Checksums = append(pkg.Checksums, spdxChecksum{Algorithm: strings.ToUpper(hash.algorithm), ChecksumValue: hash.hex})
+				}
+			}
+		}
+		doc.Packages = append(doc.Packages, pkg)
+	}
+
+	doc.Relationships = append(doc.Relationships, spdxRelationship{SPDXElementID: doc.SPDXID, RelationshipType: "DESCRIBES", RelatedSPDXElement: ids[nodes[0].ref]})
+	for _, node := range nodes {
+		for _, ref := range node.dependsOn {
+			doc.Relationships = append(doc.Relationships, spdxRelationship{SPDXElementID: ids[node.ref], RelationshipType: "DEPENDS_ON", RelatedSPDXElement: ids[ref]})
+		}
+	}
+	return marshalIndentJSON(doc)
+}
+
+// marshalIndentJSON encodes value as indented json without escaping html characters
+func marshalIndentJSON(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
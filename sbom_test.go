@@ -0,0 +1,120 @@
+package packagemanager
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/software-t-rex/packageJson"
+	"gotest.tools/v3/assert"
+)
+
+func Test_PackageURL(t *testing.T) {
+	assert.Equal(t, PackageURL("@scope/name", "1.0.0"), "pkg:npm/%40scope/name@1.0.0")
+	assert.Equal(t, PackageURL("lodash", "4.17.21"), "pkg:npm/lodash@4.17.21")
+	assert.Equal(t, PackageURL("private-app", ""), "pkg:npm/private-app")
+}
+
+func testSBOM(t *testing.T) SBOM {
+	contents, err := os.ReadFile("testdata/lockfiles/npm-v3.json")
+	assert.NilError(t, err)
+	// sha512 of an empty string
+	contents = []byte(strings.ReplaceAll(string(contents), "sha512-lodash-4.17.21", "sha512-z4PhNX7vuL3xVChQ1m2AB9Yg5AULVxXcg/SpIdNs6c5H0NE8XYXysP+DGNKHfuwvY7kxvUdBeoGlODJ6+SfaPg=="))
+	lockfile, err := nodejsNpm.UnmarshalLockfile(contents)
+	assert.NilError(t, err)
+	lockfile.Importers["."].Dependencies["ui"] = LockfileDependency{Field: "dependencies", Specifier: "*", Link: "packages/ui"}
+	return SBOM{
+		Lockfile:  lockfile,
+		Workspace: ".",
+		Manifests: map[string]*packageJson.PackageJSON{
+			".":           {Name: "root", Version: "1.0.0"},
+			"packages/ui": {Name: "@acme/ui", Version: "1.0.0"},
+		},
+		Licenses: map[string]string{"lodash@4.17.21": "MIT", "loose-envify@1.4.0": "LicenseRef-Acme OR MIT", "typescript@5.1.6": "Commercial"},
+		Created:  time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+}
+
+func Test_SBOM_CycloneDX(t *testing.T) {
+	content, err := testSBOM(t).CycloneDX()
+	assert.NilError(t, err)
+	var bom cdxBOM
+	assert.NilError(t, json.Unmarshal(content, &bom))
+	assert.Equal(t, bom.SpecVersion, "1.5")
+	assert.Equal(t, bom.Metadata.Timestamp, "2024-01-02T03:04:05Z")
+	assert.DeepEqual(t, bom.Metadata.Component, cdxComponent{Type: "application", BOMRef: "workspace:.", Name: "root", Version: "1.0.0", Purl: "pkg:npm/root@1.0.0"})
+
+	var names []string
+	for _, component := range bom.Components {
+		names = append(names, component.Group+"/"+component.Name)
+	}
+	// typescript is a devDependency of the root, js-tokens... come from the linked ui workspace
+	assert.DeepEqual(t, names, []string{"@acme/ui", "/js-tokens", "/lodash", "/loose-envify", "/react", "/typescript"})
+	assert.DeepEqual(t, bom.Components[0].Purl, "pkg:npm/%40acme/ui@1.0.0")
+	assert.DeepEqual(t, bom.Components[2], cdxComponent{
+		Type: "library", BOMRef: "pkg:npm/lodash@4.17.21", Name: "lodash", Version: "4.17.21", Purl: "pkg:npm/lodash@4.17.21",
+		Hashes:             []cdxHash{{Alg: "SHA-512", Content: "cf83e1357eefb8bdf1542850d66d8007d620e4050b5715dc83f4a921d36ce9ce47d0d13c5d85f2b0ff8318d2877eec2f63b931bd47417a81a538327af927da3e"}},
+		Licenses:           []cdxLicense{{Expression: "MIT"}},
+		ExternalReferences: []cdxExternalReference{{Type: "distribution", URL: "https://registry.npmjs.org/lodash/-/lodash-4.17.21.tgz"}},
+	})
+	// licenses that are not SPDX expressions are recorded by name
+	assert.DeepEqual(t, bom.Components[3].Licenses, []cdxLicense{{Expression: "LicenseRef-Acme OR MIT"}})
+	assert.DeepEqual(t, bom.Components[5].Licenses, []cdxLicense{{License: &cdxLicenseName{Name: "Commercial"}}})
+	assert.DeepEqual(t, bom.Dependencies[0], cdxDependency{Ref: "workspace:.", DependsOn: []string{"pkg:npm/lodash@4.17.21", "pkg:npm/typescript@5.1.6", "workspace:packages/ui"}})
+	assert.DeepEqual(t, bom.Dependencies[len(bom.Dependencies)-2], cdxDependency{Ref: "pkg:npm/react@18.2.0", DependsOn: []string{"pkg:npm/loose-envify@1.4.0"}})
+
+	t.Run("per workspace", func(t *testing.T) {
+		sbom := testSBOM(t)
+		sbom.Workspace = "packages/ui"
+		content, err := sbom.CycloneDX()
+		assert.NilError(t, err)
+		var bom cdxBOM
+		assert.NilError(t, json.Unmarshal(content, &bom))
+		assert.Equal(t, bom.Metadata.Component.Purl, "pkg:npm/%40acme/ui@1.0.0")
+		assert.Equal(t, len(bom.Components), 3)
+	})
+}
+
+func Test_SBOM_SPDX(t *testing.T) {
+	content, err := testSBOM(t).SPDX()
+	assert.NilError(t, err)
+	var doc spdxDocument
+	assert.NilError(t, json.Unmarshal(content, &doc))
+	assert.Equal(t, doc.SPDXVersion, "SPDX-2.3")
+	assert.Equal(t, doc.Name, "root")
+	assert.Equal(t, doc.CreationInfo.Created, "2024-01-02T03:04:05Z")
+	assert.Assert(t, strings.HasPrefix(doc.DocumentNamespace, "https://spdx.org/spdxdocs/root-"))
+	assert.Equal(t, len(doc.Packages), 7)
+	assert.DeepEqual(t, doc.Packages[3], spdxPackage{
+		Name: "lodash", SPDXID: "SPDXRef-Package-pkg-npm-lodash-4.17.21", VersionInfo: "4.17.21",
+		DownloadLocation: "https://registry.npmjs.org/lodash/-/lodash-4.17.21.tgz",
+		Checksums:        []spdxChecksum{{Algorithm: "SHA512", ChecksumValue: "cf83e1357eefb8bdf1542850d66d8007d620e4050b5715dc83f4a921d36ce9ce47d0d13c5d85f2b0ff8318d2877eec2f63b931bd47417a81a538327af927da3e"}},
+		LicenseConcluded: "NOASSERTION", LicenseDeclared: "MIT", CopyrightText: "NOASSERTION",
+		ExternalRefs: []spdxExternalRef{{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: "pkg:npm/lodash@4.17.21"}},
+	})
+	assert.Equal(t, doc.Packages[4].LicenseDeclared, "LicenseRef-Acme OR MIT")
+	assert.Equal(t, doc.Packages[6].LicenseDeclared, "NOASSERTION")
+	assert.DeepEqual(t, doc.Relationships[:2], []spdxRelationship{
+		{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: "SPDXRef-Package-workspace-."},
+		{SPDXElementID: "SPDXRef-Package-workspace-.", RelationshipType: "DEPENDS_ON", RelatedSPDXElement: "SPDXRef-Package-pkg-npm-lodash-4.17.21"},
+	})
+	assert.Equal(t, len(doc.Relationships), 1+3+1+2)
+}
+
+func Test_NewSBOMFS(t *testing.T) {
+	lockfile, err := os.ReadFile("testdata/lockfiles/pnpm-v9.yaml")
+	assert.NilError(t, err)
+	sbom, err := nodejsPnpm.NewSBOMFS(fstest.MapFS{
+		"pnpm-lock.yaml":                   {Data: lockfile},
+		"pnpm-workspace.yaml":              {Data: []byte("packages:\n  - packages/*\n")},
+		"package.json":                     {Data: []byte(`{"name": "root"}`)},
+		"packages/ui/package.json":         {Data: []byte(`{"name": "ui", "version": "1.0.0"}`)},
+		"node_modules/lodash/package.json": {Data: []byte(`{"name": "lodash", "version": "4.17.21", "license": "MIT"}`)},
+	}, ".")
+	assert.NilError(t, err)
+	assert.Equal(t, sbom.Manifests["packages/ui"].Name, "ui")
+	assert.DeepEqual(t, sbom.Licenses, map[string]string{"lodash@4.17.21": "MIT"})
+}
@@ -0,0 +1,235 @@
+package packagemanager
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// spdxIdentifiers are the SPDX license identifiers commonly found on the npm registry,
+// by lower case identifier, used to fix their case.
+var spdxIdentifiers = func() map[string]string {
+	identifiers := map[string]string{}
+	for _, id := range []string{
+		"0BSD", "AFL-2.1", "AFL-3.0", "AGPL-3.0-only", "AGPL-3.0-or-later", "Apache-2.0", "Artistic-2.0",
+		"BlueOak-1.0.0", "BSD-2-Clause", "BSD-3-Clause", "BSL-1.0", "CC-BY-3.0", "CC-BY-4.0", "CC-BY-SA-4.0",
+		"CC0-1.0", "EPL-1.0", "EPL-2.0", "GPL-2.0-only", "GPL-2.0-or-later", "GPL-3.0-only", "GPL-3.0-or-later",
+		"ISC", "LGPL-2.1-only", "LGPL-2.1-or-later", "LGPL-3.0-only", "LGPL-3.0-or-later", "MIT", "MIT-0",
+		"MPL-1.1", "MPL-2.0", "OFL-1.1", "Python-2.0", "Unicode-DFS-2016", "Unlicense", "WTFPL", "Zlib",
+	} {
+		identifiers[strings.ToLower(id)] = id
+	}
+	return identifiers
+}()
+
+// spdxAliases are the non SPDX license names commonly found in package.json files
+var spdxAliases = map[string]string{
+	"apache 2.0":         "Apache-2.0",
+	"apache 2":           "Apache-2.0",
+	"apache-2":           "Apache-2.0",
+	"apache2":            "Apache-2.0",
+	"apache license 2.0": "Apache-2.0",
+	"bsd":                "BSD-2-Clause",
+	"bsd-2":              "BSD-2-Clause",
+	"bsd-3":              "BSD-3-Clause",
+	"isc license":        "ISC",
+	"mit license":        "MIT",
+	"mit/x11":            "MIT",
+	"mpl 2.0":            "MPL-2.0",
+	"public domain":      "Unlicense",
+	// deprecated SPDX identifiers
+	"gpl-2.0":  "GPL-2.0-only",
+	"gpl-2.0+": "GPL-2.0-or-later",
+	"gpl-3.0":  "GPL-3.0-only",
+	"gpl-3.0+": "GPL-3.0-or-later",
+	"lgpl-2.1": "LGPL-2.1-only",
+	"lgpl-3.0": "LGPL-3.0-only",
+	"agpl-3.0": "AGPL-3.0-only",
+}
+
+// spdxLicenseTexts recognize the license of a LICENSE file, the first matching entry wins
+var spdxLicenseTexts = []struct {
+	id      string
+	pattern *regexp.Regexp
+}{
+	{"Apache-2.0", regexp.MustCompile(`(?is)apache license.{0,40}version 2\.0`)},
+	{"MPL-2.0", regexp.MustCompile(`(?i)mozilla public license,? version 2\.0`)},
+	{"AGPL-3.0-only", regexp.MustCompile(`(?i)gnu affero general public license\s+version 3`)},
+	{"LGPL-3.0-only", regexp.MustCompile(`(?i)gnu lesser general public license\s+version 3`)},
+	{"GPL-3.0-only", regexp.MustCompile(`(?i)gnu general public license\s+version 3`)},
+	{"GPL-2.0-only", regexp.MustCompile(`(?i)gnu general public license\s+version 2`)},
+	{"BSD-3-Clause", regexp.MustCompile(`(?is)redistribution and use in source and binary forms.*neither the name`)},
+	{"BSD-2-Clause", regexp.MustCompile(`(?i)redistribution and use in source and binary forms`)},
+	{"ISC", regexp.MustCompile(`(?i)permission to use, copy, modify, and/or distribute this software for any`)},
+	{"MIT", regexp.MustCompile(`(?i)permission is hereby granted, free of charge`)},
+	{"Unlicense", regexp.MustCompile(`(?i)this is free and unencumbered software released into the public domain`)},
+}
+
+// NormalizeLicense converts a license as written in a package.json to an SPDX expression,
+// fixing the case of known identifiers and replacing common aliases ("Apache 2.0", "MIT License").
+// Unknown identifiers are kept as is, an empty string is returned for an empty license.
+func NormalizeLicense(license string) string {
+	license = strings.TrimSpace(license)
+	if id, ok := normalizeLicenseID(license); ok {
+		return id
+	}
+	tokens := spdxTokens(license)
+	for i, token := range tokens {
+		switch strings.ToUpper(token) {
+		case "AND", "OR", "WITH":
+			tokens[i] = strings.ToUpper(token)
+		case "(", ")":
+		default:
+			if id, ok := normalizeLicenseID(token); ok {
+				tokens[i] = id
+			}
+		}
+	}
+	expression := strings.Join(tokens, " ")
+	expression = strings.ReplaceAll(strings.ReplaceAll(expression, "( ", "("), " )", ")")
+	if strings.HasPrefix(expression, "(") && strings.HasSuffix(expression, ")") && strings.Count(expression, "(") == 1 {
+		expression = expression[1 : len(expression)-1]
+	}
+	return expression
+}
+
+// normalizeLicenseID returns the SPDX identifier of a single license name
+func normalizeLicenseID(name string) (string, bool) {
+	lower := strings.ToLower(name)
+	if id, ok := spdxIdentifiers[lower]; ok {
+		return id, true
+	}
+	if id, ok := spdxAliases[lower]; ok {
+		return id, true
+	}
+	return "", false
+}
+
+// detectLicenseText returns the SPDX identifier of a license text, empty if not recognized
+func detectLicenseText(text string) string {
+	for _, license := range spdxLicenseTexts {
+		if license.pattern.MatchString(text) {
+			return license.id
+		}
+	}
+	return ""
+}
+
+func spdxTokens(expression string) []string {
+	expression = strings.ReplaceAll(strings.ReplaceAll(expression, "(", " ( "), ")", " ) ")
+	return strings.Fields(expression)
+}
+
+// spdxExpression is a parsed SPDX expression: a license identifier or a combination of expressions
+type spdxExpression struct {
+	// the license identifier, empty for combinations
+	id string
+	// AND or OR for combinations
+	operator string
+	operands []*spdxExpression
+}
+
+// parseSPDXExpression parses an SPDX expression. License exceptions (WITH) are ignored
+// as policies are about licenses.
+func parseSPDXExpression(expression string) (*spdxExpression, error) {
+	tokens := spdxTokens(expression)
+	pos := 0
+	var parseOr, parseAnd, parsePrimary func() (*spdxExpression, error)
+	parseBinary := func(operator string, operand func() (*spdxExpression, error)) (*spdxExpression, error) {
+		first, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		result := &spdxExpression{operator: operator, operands: []*spdxExpression{first}}
+		for pos < len(tokens) && strings.ToUpper(tokens[pos]) == operator {
+			pos++
+			next, err := operand()
+			if err != nil {
+				return nil, err
+			}
+			result.operands = append(result.operands, next)
+		}
+		if len(result.operands) == 1 {
+			return first, nil
+		}
+		return result, nil
+	}
+	parseOr = func() (*spdxExpression, error) { return parseBinary("OR", parseAnd) }
+	parseAnd = func() (*spdxExpression, error) { return parseBinary("AND", parsePrimary) }
+	parsePrimary = func() (*spdxExpression, error) {
+		if pos >= len(tokens) {
+			return nil, fmt.Errorf("unexpected end of license expression %q", expression)
+		}
+		token := tokens[pos]
+		pos++
+		switch strings.ToUpper(token) {
+		case "(":
+			inner, err := parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if pos >= len(tokens) || tokens[pos] != ")" {
+				return nil, fmt.Errorf("missing closing parenthesis in license expression %q", expression)
+			}
+			pos++
+			return inner, nil
+		case ")", "AND", "OR", "WITH":
+			return nil, fmt.Errorf("unexpected %q in license expression %q", token, expression)
+		}
+		if pos+1 < len(tokens) && strings.ToUpper(tokens[pos]) == "WITH" {
+			pos += 2
+		}
+		return &spdxExpression{id: token}, nil
+	}
+	result, err := parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if pos < len(tokens) {
+		return nil, fmt.Errorf("unexpected %q in license expression %q", tokens[pos], expression)
+	}
+	return result, nil
+}
+
+// isSPDXExpression tells if license is a valid SPDX expression: every license of it is
+// an SPDX identifier, in its canonical case, or a LicenseRef- custom license.
+func isSPDXExpression(license string) bool {
+	expression, err := parseSPDXExpression(license)
+	if err != nil {
+		return false
+	}
+	return expression.all(func(id string) bool {
+		return spdxIdentifiers[strings.ToLower(id)] == id || strings.HasPrefix(id, "LicenseRef-")
+	})
+}
+
+// all tells if accept returns true for every license of the expression
+func (e *spdxExpression) all(accept func(id string) bool) bool {
+	if e.id != "" {
+		return accept(e.id)
+	}
+	for _, operand := range e.operands {
+		if !operand.all(accept) {
+			return false
+		}
+	}
+	return true
+}
+
+// satisfies tells if the expression holds when the licenses for which accept returns true are
+// the only ones accepted: one operand of OR expressions must hold, all operands of AND expressions must.
+func (e *spdxExpression) satisfies(accept func(id string) bool) bool {
+	if e.id != "" {
+		return accept(e.id)
+	}
+	for _, operand := range e.operands {
+		holds := operand.satisfies(accept)
+		if e.operator == "OR" && holds {
+			return true
+		}
+		if e.operator == "AND" && !holds {
+			return false
+		}
+	}
+	return e.operator == "AND"
+}
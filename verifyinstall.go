@@ -0,0 +1,341 @@
+package packagemanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// InstallIssueKind tells how an installed package differs from the lockfile.
+type InstallIssueKind string
+
+const (
+	// InstallMissing is a locked package that is not installed. Optional packages are not reported.
+	InstallMissing InstallIssueKind = "missing"
+	// InstallExtra is an installed package that the lockfile doesn't record.
+	InstallExtra InstallIssueKind = "extra"
+	// InstallMismatch is an installed package whose version or integrity is not the locked one.
+	InstallMismatch InstallIssueKind = "mismatch"
+)
+
+// InstallIssue is an installed package that doesn't match the lockfile.
+type InstallIssue struct {
+	Kind InstallIssueKind
+	Name string
+	// The directory of the installed package relative to the project root,
+	// empty for missing packages when the lockfile doesn't record where they go.
+	Dir string
+	// The key of the locked package in Lockfile.Packages, empty for extra packages and for
+	// versions missing from the lockfile.
+	Package string
+	// The locked version, the comma separated locked versions when the installed one is not locked.
+	Locked string
+	// The installed version, empty for missing packages.
+	Installed string
+	// Why the installed package doesn't match, for mismatches.
+	Reason string
+}
+
+// installedPackage is a package found in PackageDir
+type installedPackage struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Integrity string `json:"_integrity"`
+}
+
+// installState is the metadata a package manager writes in PackageDir about the install
+type installState struct {
+	// The metadata file, relative to the project root.
+	file string
+	// The package key expected at each install location, nil when the file doesn't record the layout.
+	locations map[string]string
+	// What the file records about the installed packages, by install location when byDir is set,
+	// by package key otherwise.
+	packages map[string]*LockfilePackage
+	byDir    bool
+}
+
+// VerifyInstall compares the packages installed in the PackageDir of the project in projectDirectory
+// and of its workspaces with the lockfile, to tell if node_modules can be reused without installing.
+// See VerifyInstallFS.
+func (pm PackageManager) VerifyInstall(projectDirectory string) ([]InstallIssue, error) {
+	return pm.VerifyInstallFS(os.DirFS(projectDirectory))
+}
+
+// VerifyInstallFS compares the packages installed in the project stored at the root of fsys with the lockfile.
+// It reports the missing, extra and mismatched packages sorted by name and directory, none when the install
+// is up to date. Besides the installed package.json files, the metadata written by the package manager are
+// checked: node_modules/.package-lock.json (npm), node_modules/.pnpm/lock.yaml (pnpm),
+// node_modules/.yarn-integrity (yarn classic) and node_modules/.yarn-state.yml (berry).
+// Symbolic links, used for workspaces and by pnpm, are not followed.
+// It returns an UnsupportedConfigError for berry Plug'n'Play installs, which have no PackageDir.
+func (pm PackageManager) VerifyInstallFS(fsys fs.FS) ([]InstallIssue, error) {
+	lockfile, err := pm.ReadLockfileFS(fsys)
+	if err != nil {
+		return nil, err
+	}
+	if lockfile == nil {
+		return nil, &UnsupportedConfigError{Manager: pm.Name, Reason: "reading the lockfile is not supported"}
+	}
+	if pm.Name == nodejsBerry.Name {
+		if nmLinker, err := isNMLinker(fsys); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		} else if !nmLinker {
+			return nil, &UnsupportedConfigError{Manager: pm.Name, Reason: "Plug'n'Play installs have no " + pm.PackageDir}
+		}
+	}
+	state, err := pm.readInstallState(fsys, lockfile)
+	if err != nil {
+		return nil, err
+	}
+
+	roots := []string{"."}
+	workspaces, err := pm.GetWorkspacesFS(fsys)
+	if err != nil && !errors.Is(err, ErrNoWorkspaces) {
+		return nil, err
+	}
+	for _, workspace := range workspaces {
+		roots = append(roots, path.Dir(workspace))
+	}
+	installed := map[string]*installedPackage{}
+	for _, root := range roots {
+		if err := pm.walkInstalledPackages(fsys, path.Join(root, pm.PackageDir), installed); err != nil {
+			return nil, err
+		}
+	}
+
+	versionsByName := map[string][]string{}
+	for _, key := range sortedKeys(lockfile.Packages) {
+		pkg := lockfile.Packages[key]
+		versionsByName[pkg.Name] = append(versionsByName[pkg.Name], pkg.Version)
+	}
+	var issues []InstallIssue
+	seen := map[string]bool{}
+	for _, dir := range sortedKeys(installed) {
+		pkg := installed[dir]
+		key, expected := state.locations[dir]
+		if !expected {
+			if state.locations != nil {
+				issues = append(issues, InstallIssue{Kind: InstallExtra, Name: pkg.Name, Dir: dir, Installed: pkg.Version})
+				continue
+			}
+			key = packageKey(pkg.Name, pkg.Version)
+		}
+		locked, ok := lockfile.Packages[key]
+		switch {
+		case !ok && len(versionsByName[pkg.Name]) > 0:
+			issues = append(issues, InstallIssue{Kind: InstallMismatch, Name: pkg.Name, Dir: dir, Locked: strings.Join(versionsByName[pkg.Name], ", "), Installed: pkg.Version, Reason: "version not in the lockfile"})
+		case !ok:
+			issues = append(issues, InstallIssue{Kind: InstallExtra, Name: pkg.Name, Dir: dir, Installed: pkg.Version})
+		default:
+			seen[key] = true
+			if reason := state.mismatch(dir, key, locked, pkg); reason != "" {
+				issues = append(issues, InstallIssue{Kind: InstallMismatch, Name: pkg.Name, Dir: dir, Package: key, Locked: locked.Version, Installed: pkg.Version, Reason: reason})
+			}
+		}
+	}
+
+	for _, dir := range sortedKeys(state.locations) {
+		key := state.locations[dir]
+		seen[key] = true
+		if locked, ok := lockfile.Packages[key]; ok && installed[dir] == nil && !locked.Optional {
+			issues = append(issues, InstallIssue{Kind: InstallMissing, Name: locked.Name, Dir: dir, Package: key, Locked: locked.Version})
+		}
+	}
+	for _, key := range sortedKeys(lockfile.Packages) {
+		if locked := lockfile.Packages[key]; !seen[key] && !locked.Optional {
+			issues = append(issues, InstallIssue{Kind: InstallMissing, Name: locked.Name, Package: key, Locked: locked.Version})
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		a, b := issues[i], issues[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Dir < b.Dir
+	})
+	return issues, nil
+}
+
+// mismatch returns why the package installed at dir doesn't match the locked package with the given key,
+// empty if it matches
+func (s installState) mismatch(dir string, key string, locked *LockfilePackage, installed *installedPackage) string {
+	if installed.Name != locked.Name || installed.Version != locked.Version {
+		return fmt.Sprintf("%s@%s is locked", locked.Name, locked.Version)
+	}
+	if installed.Integrity != "" && locked.Integrity != "" && installed.Integrity != locked.Integrity {
+		return fmt.Sprintf("installed with integrity %s", installed.Integrity)
+	}
+	recordKey := key
+	if s.byDir {
+		recordKey = dir
+	}
+	recorded, ok := s.packages[recordKey]
+	switch {
+	case !ok:
+		if s.packages != nil {
+			return s.file + " doesn't record it"
+		}
+	case recorded.Version != "" && recorded.Version != locked.Version:
+		return fmt.Sprintf("%s records version %s", s.file, recorded.Version)
+	case recorded.Integrity != "" && locked.Integrity != "" && recorded.Integrity != locked.Integrity:
+		return fmt.Sprintf("%s records integrity %s", s.file, recorded.Integrity)
+	case recorded.Resolved != "" && locked.Resolved != "" && recorded.Resolved != locked.Resolved:
+		return fmt.Sprintf("%s records %s", s.file, recorded.Resolved)
+	}
+	return ""
+}
+
+// readInstallState reads the metadata the package manager wrote in PackageDir, if any
+func (pm PackageManager) readInstallState(fsys fs.FS, lockfile *Lockfile) (installState, error) {
+	state := installState{}
+	read := func(file string) ([]byte, error) {
+		state.file = path.Join(pm.PackageDir, file)
+		content, err := fs.ReadFile(fsys, state.file)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return content, err
+	}
+
+	switch pm.Name {
+	case nodejsNpm.Name:
+		// the lockfile records the layout
+		state.locations = map[string]string{}
+		for _, key := range sortedKeys(lockfile.Packages) {
+			for _, location := range lockfile.Packages[key].Paths {
+				state.locations[location] = key
+			}
+		}
+		// the hidden lockfile records the installed packages by location
+		content, err := read(".package-lock.json")
+		if content == nil || err != nil {
+			return state, err
+		}
+		var hidden struct {
+			Packages map[string]struct {
+				Version   string `json:"version"`
+				Integrity string `json:"integrity"`
+				Link      bool   `json:"link"`
+			} `json:"packages"`
+		}
+		if err := json.Unmarshal(content, &hidden); err != nil {
+			return state, &ParseError{File: state.file, Line: jsonErrorLine(content, err), Err: err}
+		}
+		state.packages, state.byDir = map[string]*LockfilePackage{}, true
+		for location, entry := range hidden.Packages {
+			if !entry.Link {
+				state.packages[location] = &LockfilePackage{Version: entry.Version, Integrity: entry.Integrity}
+			}
+		}
+
+	case nodejsPnpm.Name:
+		// a copy of the lockfile as installed
+		content, err := read(path.Join(".pnpm", "lock.yaml"))
+		if content == nil || err != nil {
+			return state, err
+		}
+		installed, err := unmarshalPnpmLockfile(content)
+		if err != nil {
+			return state, &ParseError{File: state.file, Err: err}
+		}
+		state.packages = installed.Packages
+
+	case nodejsYarn.Name:
+		// the resolved url of every lockfile entry at install time
+		content, err := read(".yarn-integrity")
+		if content == nil || err != nil {
+			return state, err
+		}
+		var integrity struct {
+			LockfileEntries map[string]string `json:"lockfileEntries"`
+		}
+		if err := json.Unmarshal(content, &integrity); err != nil {
+			return state, &ParseError{File: state.file, Line: jsonErrorLine(content, err), Err: err}
+		}
+		state.packages = map[string]*LockfilePackage{}
+		for descriptor, resolved := range integrity.LockfileEntries {
+			if key, ok := lockfile.Descriptors[descriptor]; ok {
+				state.packages[key] = &LockfilePackage{Resolved: resolved}
+			}
+		}
+
+	case nodejsBerry.Name:
+		// the install locations of every locator
+		content, err := read(".yarn-state.yml")
+		if content == nil || err != nil {
+			return state, err
+		}
+		var yarnState map[string]struct {
+			Locations []string `yaml:"locations"`
+		}
+		if err := yaml.Unmarshal(content, &yarnState); err != nil {
+			return state, newYamlParseError(state.file, err)
+		}
+		state.locations = map[string]string{}
+		for _, locator := range sortedKeys(yarnState) {
+			name, reference := splitDescriptor(locator)
+			key := packageKey(name, strings.TrimPrefix(reference, "npm:"))
+			for _, location := range yarnState[locator].Locations {
+				state.locations[location] = key
+			}
+		}
+	}
+	return state, nil
+}
+
+// walkInstalledPackages adds the packages installed in the packages directory dir to installed, by directory.
+// Nested packages directories and the pnpm virtual store are walked too.
+func (pm PackageManager) walkInstalledPackages(fsys fs.FS, dir string, installed map[string]*installedPackage) error {
+	err := fs.WalkDir(fsys, dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || name == dir {
+			return nil
+		}
+		parent := path.Dir(name)
+		isPackagesDir := func(dir string) bool { return path.Base(dir) == pm.PackageDir }
+		switch {
+		case d.Name() == pm.PackageDir:
+			return nil
+		case path.Base(parent) == ".pnpm" && isPackagesDir(path.Dir(parent)):
+			// a virtual store entry
+			return nil
+		case isPackagesDir(parent) && d.Name() == ".pnpm":
+			return nil
+		case isPackagesDir(parent) && strings.HasPrefix(d.Name(), "@"):
+			return nil
+		case isPackagesDir(parent) && !strings.HasPrefix(d.Name(), "."):
+		case strings.HasPrefix(path.Base(parent), "@") && isPackagesDir(path.Dir(parent)):
+		default:
+			return fs.SkipDir
+		}
+
+		manifest := path.Join(name, "package.json")
+		content, err := fs.ReadFile(fsys, manifest)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		pkg := &installedPackage{}
+		if err := json.Unmarshal(content, pkg); err != nil {
+			return &ParseError{File: manifest, Line: jsonErrorLine(content, err), Err: err}
+		}
+		installed[name] = pkg
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+package packagemanager
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/v3/assert"
+)
+
+func installedManifest(name string, version string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(`{"name": "` + name + `", "version": "` + version + `"}`)}
+}
+
+func Test_VerifyInstall(t *testing.T) {
+	manifests := fstest.MapFS{
+		"package.json":             {Data: []byte(`{"name": "root", "workspaces": ["packages/*"], "dependencies": {"lodash": "^4.17.20"}, "devDependencies": {"typescript": "^5.0.0"}}`)},
+		"packages/ui/package.json": {Data: []byte(`{"name": "ui", "dependencies": {"react": "^18.2.0"}}`)},
+	}
+	project := func(files fstest.MapFS) fstest.MapFS {
+		for name, file := range manifests {
+			files[name] = file
+		}
+		return files
+	}
+
+	t.Run("npm", func(t *testing.T) {
+		lockfile, err := os.ReadFile("testdata/lockfiles/npm-v3.json")
+		assert.NilError(t, err)
+		fsys := project(fstest.MapFS{
+			"package-lock.json":                                             {Data: lockfile},
+			"node_modules/.package-lock.json":                               {Data: []byte(`{"packages": {"node_modules/lodash": {"version": "4.17.21", "integrity": "sha512-other"}}}`)},
+			"node_modules/.bin/loose-envify":                                {Data: []byte("#!/usr/bin/env node")},
+			"node_modules/js-tokens/package.json":                           installedManifest("js-tokens", "4.0.0"),
+			"node_modules/lodash/package.json":                              installedManifest("lodash", "4.17.21"),
+			"node_modules/lodash/fp/package.json":                           installedManifest("lodash-fp", "1.0.0"),
+			"node_modules/react/package.json":                               installedManifest("react", "18.3.1"),
+			"node_modules/@types/node/package.json":                         installedManifest("@types/node", "20.0.0"),
+			"node_modules/loose-envify/node_modules/js-tokens/package.json": installedManifest("js-tokens", "4.0.0"),
+		})
+		issues, err := nodejsNpm.VerifyInstallFS(fsys)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, issues, []InstallIssue{
+			{Kind: InstallExtra, Name: "@types/node", Dir: "node_modules/@types/node", Installed: "20.0.0"},
+			{Kind: InstallMismatch, Name: "js-tokens", Dir: "node_modules/js-tokens", Package: "js-tokens@4.0.0", Locked: "4.0.0", Installed: "4.0.0", Reason: "node_modules/.package-lock.json doesn't record it"},
+			{Kind: InstallExtra, Name: "js-tokens", Dir: "node_modules/loose-envify/node_modules/js-tokens", Installed: "4.0.0"},
+			{Kind: InstallMismatch, Name: "lodash", Dir: "node_modules/lodash", Package: "lodash@4.17.21", Locked: "4.17.21", Installed: "4.17.21", Reason: "node_modules/.package-lock.json records integrity sha512-other"},
+			{Kind: InstallMissing, Name: "loose-envify", Dir: "node_modules/loose-envify", Package: "loose-envify@1.4.0", Locked: "1.4.0"},
+			{Kind: InstallMismatch, Name: "react", Dir: "node_modules/react", Package: "react@18.2.0", Locked: "18.2.0", Installed: "18.3.1", Reason: "react@18.2.0 is locked"},
+			{Kind: InstallMissing, Name: "typescript", Dir: "node_modules/typescript", Package: "typescript@5.1.6", Locked: "5.1.6"},
+		})
+	})
+
+	t.Run("pnpm", func(t *testing.T) {
+		lockfile, err := os.ReadFile("testdata/lockfiles/pnpm-v9.yaml")
+		assert.NilError(t, err)
+		store := "node_modules/.pnpm/"
+		fsys := project(fstest.MapFS{
+			"pnpm-lock.yaml":      {Data: lockfile},
+			"pnpm-workspace.yaml": {Data: []byte("packages:\n  - packages/*\n")},
+			store + "lock.yaml":   {Data: lockfile},
+			store + "js-tokens@4.0.0/node_modules/js-tokens/package.json":       installedManifest("js-tokens", "4.0.0"),
+			store + "lodash@4.17.21/node_modules/lodash/package.json":           installedManifest("lodash", "4.17.21"),
+			store + "loose-envify@1.4.0/node_modules/loose-envify/package.json": installedManifest("loose-envify", "1.4.0"),
+			store + "react@18.2.0/node_modules/react/package.json":              installedManifest("react", "18.2.0"),
+			store + "typescript@5.1.6/node_modules/typescript/package.json":     installedManifest("typescript", "5.1.6"),
+		})
+		issues, err := nodejsPnpm.VerifyInstallFS(fsys)
+		assert.NilError(t, err)
+		assert.Equal(t, len(issues), 0)
+
+		delete(fsys, store+"typescript@5.1.6/node_modules/typescript/package.json")
+		fsys[store+"typescript@5.0.4/node_modules/typescript/package.json"] = installedManifest("typescript", "5.0.4")
+		issues, err = nodejsPnpm.VerifyInstallFS(fsys)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, issues, []InstallIssue{
+			{Kind: InstallMissing, Name: "typescript", Package: "typescript@5.1.6", Locked: "5.1.6"},
+			{Kind: InstallMismatch, Name: "typescript", Dir: store + "typescript@5.0.4/node_modules/typescript", Locked: "5.1.6", Installed: "5.0.4", Reason: "version not in the lockfile"},
+		})
+	})
+
+	t.Run("yarn", func(t *testing.T) {
+		lockfile, err := os.ReadFile("testdata/lockfiles/yarn-v1.lock")
+		assert.NilError(t, err)
+		fsys := project(fstest.MapFS{
+			"yarn.lock":                        {Data: lockfile},
+			"node_modules/.yarn-integrity":     {Data: []byte(`{"lockfileEntries": {"lodash@^4.17.20": "https://registry.yarnpkg.com/lodash/-/lodash-4.17.20.tgz"}}`)},
+			"node_modules/lodash/package.json": installedManifest("lodash", "4.17.21"),
+		})
+		issues, err := nodejsYarn.VerifyInstallFS(fsys)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, issues, []InstallIssue{
+			{Kind: InstallMissing, Name: "js-tokens", Package: "js-tokens@4.0.0", Locked: "4.0.0"},
+			{Kind: InstallMismatch, Name: "lodash", Dir: "node_modules/lodash", Package: "lodash@4.17.21", Locked: "4.17.21", Installed: "4.17.21", Reason: "node_modules/.yarn-integrity records https://registry.yarnpkg.com/lodash/-/lodash-4.17.20.tgz"},
+			{Kind: InstallMissing, Name: "loose-envify", Package: "loose-envify@1.4.0", Locked: "1.4.0"},
+			{Kind: InstallMissing, Name: "react", Package: "react@18.2.0", Locked: "18.2.0"},
+			{Kind: InstallMissing, Name: "typescript", Package: "typescript@5.1.6", Locked: "5.1.6"},
+		})
+	})
+
+	t.Run("berry Plug'n'Play", func(t *testing.T) {
+		lockfile, err := os.ReadFile("testdata/lockfiles/berry.lock")
+		assert.NilError(t, err)
+		_, err = nodejsBerry.VerifyInstallFS(project(fstest.MapFS{"yarn.lock": {Data: lockfile}}))
+		var unsupported *UnsupportedConfigError
+		assert.Assert(t, errors.As(err, &unsupported))
+	})
+}
@@ -0,0 +1,100 @@
+package packagemanager
+
+import (
+	"strings"
+)
+
+// DependencyPath is a chain of dependencies leading a workspace to install a package.
+type DependencyPath struct {
+	// The directory of the workspace the path starts from, relative to the project root.
+	Workspace string
+	// The packages along the path, from the direct dependency of the workspace to the queried package.
+	Packages []*LockfilePackage
+}
+
+// String returns the path as "apps/web > next > postcss@8.4.14".
+func (p DependencyPath) String() string {
+	steps := []string{p.Workspace}
+	for i, pkg := range p.Packages {
+		if i == len(p.Packages)-1 {
+			steps = append(steps, packageKey(pkg.Name, pkg.Version))
+		} else {
+			steps = append(steps, pkg.Name)
+		}
+	}
+	return strings.Join(steps, " > ")
+}
+
+// Why returns every dependency path from the workspaces recorded in the lockfile to the
+// versions of packageName it resolves, like npm explain, yarn why or pnpm why do, without
+// running the package manager. Paths stop at the first occurrence of packageName, cyclic
+// dependencies are not followed and identical paths are only returned once.
+// Each workspace is explained on its own: links to sibling workspaces are not followed.
+func Why(lockfile *Lockfile, packageName string) []DependencyPath {
+	// the packages that are packageName or lead to it
+	leading := map[string]bool{}
+	parents := map[string][]string{}
+	var queue []string
+	for _, key := range sortedKeys(lockfile.Packages) {
+		pkg := lockfile.Packages[key]
+		if pkg.Name == packageName {
+			queue = append(queue, key)
+		}
+		for _, dependencies := range []map[string]string{pkg.Dependencies, pkg.OptionalDependencies} {
+			for _, dependency := range dependencies {
+				parents[dependency] = append(parents[dependency], key)
+			}
+		}
+	}
+	for len(queue) > 0 {
+		key := queue[0]
+		queue = queue[1:]
+		if leading[key] {
+			continue
+		}
+		leading[key] = true
+		queue = append(queue, parents[key]...)
+	}
+
+	var paths []DependencyPath
+	seen := map[string]bool{}
+	var walk func(workspace string, keys []string)
+	walk = func(workspace string, keys []string) {
+		key := keys[len(keys)-1]
+		pkg := lockfile.Packages[key]
+		if pkg.Name == packageName {
+			id := workspace + " " + strings.Join(keys, " ")
+			if !seen[id] {
+				seen[id] = true
+				path := DependencyPath{Workspace: workspace}
+				for _, key := range keys {
+					path.Packages = append(path.Packages, lockfile.Packages[key])
+				}
+				paths = append(paths, path)
+			}
+			return
+		}
+		children := map[string]string{}
+		for name, dependency := range pkg.OptionalDependencies {
+			children[name] = dependency
+		}
+		for name, dependency := range pkg.Dependencies {
+			children[name] = dependency
+		}
+		for _, name := range sortedKeys(children) {
+			child := children[name]
+			if leading[child] && !contains(keys, child) {
+				walk(workspace, append(keys[:len(keys):len(keys)], child))
+			}
+		}
+	}
+	for _, dir := range sortedKeys(lockfile.Importers) {
+		importer := lockfile.Importers[dir]
+		for _, name := range sortedKeys(importer.Dependencies) {
+			if key := importer.Dependencies[name].Package; leading[key] {
+				walk(dir, []string{key})
+			}
+		}
+	}
+	return paths
+}
@@ -0,0 +1,61 @@
+package packagemanager
+
+import (
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/v3/assert"
+)
+
+func pathStrings(paths []DependencyPath) []string {
+	var got []string
+	for _, path := range paths {
+		got = append(got, path.String())
+	}
+	return got
+}
+
+func Test_Why(t *testing.T) {
+	lockfile := readLockfileFixture(t, nodejsPnpm, "pnpm-v9.yaml")
+	assert.DeepEqual(t, pathStrings(Why(lockfile, "js-tokens")), []string{"packages/ui > react > loose-envify > js-tokens@4.0.0"})
+	assert.DeepEqual(t, pathStrings(Why(lockfile, "lodash")), []string{". > lodash@4.17.21"})
+	assert.Equal(t, len(Why(lockfile, "left-pad")), 0)
+
+	t.Run("diamonds, cycles and aliases", func(t *testing.T) {
+		lockfile := newLockfile("")
+		add := func(name string, version string, dependencies map[string]string) {
+			lockfile.Packages[packageKey(name, version)] = &LockfilePackage{Name: name, Version: version, Dependencies: dependencies}
+		}
+		add("next", "13.4.0", map[string]string{"postcss": "postcss@8.4.14", "styled-jsx": "styled-jsx@5.1.1"})
+		add("styled-jsx", "5.1.1", map[string]string{"next": "next@13.4.0", "postcss": "postcss@8.4.31"})
+		add("postcss", "8.4.14", nil)
+		add("postcss", "8.4.31", map[string]string{"nanoid": "nanoid@3.3.6"})
+		add("nanoid", "3.3.6", nil)
+		lockfile.importer("apps/web").Dependencies = map[string]LockfileDependency{
+			"next":      {Package: "next@13.4.0"},
+			"next-13":   {Package: "next@13.4.0"},
+			"next-docs": {Link: "apps/docs"},
+		}
+		assert.DeepEqual(t, pathStrings(Why(lockfile, "postcss")), []string{
+			"apps/web > next > postcss@8.4.14",
+			"apps/web > next > styled-jsx > postcss@8.4.31",
+		})
+		paths := Why(lockfile, "nanoid")
+		assert.DeepEqual(t, pathStrings(paths), []string{"apps/web > next > styled-jsx > postcss > nanoid@3.3.6"})
+		assert.Equal(t, paths[0].Packages[2], lockfile.Packages["postcss@8.4.31"])
+	})
+
+	t.Run("yarn classic", func(t *testing.T) {
+		contents, err := os.ReadFile("testdata/lockfiles/yarn-v1.lock")
+		assert.NilError(t, err)
+		lockfile, err := nodejsYarn.ReadLockfileFS(fstest.MapFS{
+			"yarn.lock":                {Data: contents},
+			"package.json":             {Data: []byte(`{"workspaces": ["packages/*"], "dependencies": {"lodash": "^4.17.20", "ui": "*"}}`)},
+			"packages/ui/package.json": {Data: []byte(`{"name": "ui", "dependencies": {"react": "^18.2.0"}}`)},
+		})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, lockfile.Importers["."].Dependencies["ui"], LockfileDependency{Field: "dependencies", Specifier: "*", Link: "packages/ui"})
+		assert.DeepEqual(t, pathStrings(Why(lockfile, "js-tokens")), []string{"packages/ui > react > loose-envify > js-tokens@4.0.0"})
+	})
+}
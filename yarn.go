@@ -2,14 +2,25 @@ package packagemanager
 
 import (
 	"fmt"
-	"os/exec"
-	"path/filepath"
-	"strings"
+	"io/fs"
+	"path"
+	"regexp"
 
 	"github.com/Masterminds/semver"
-	"github.com/software-t-rex/packageJson"
 )
 
+var berryLockfileRegex = regexp.MustCompile(`(?m)^__metadata:`)
+
+// isBerryLockfile tells if the yarn.lock at lockfilePath was written by yarn berry.
+// Berry lockfiles always contain a __metadata entry, yarn classic ones don't.
+func isBerryLockfile(fsys fs.FS, lockfilePath string) (bool, error) {
+	bytes, err := fs.ReadFile(fsys, lockfilePath)
+	if err != nil {
+		return false, err
+	}
+	return berryLockfileRegex.Match(bytes), nil
+}
+
 var nodejsYarn = PackageManager{
 	Name:         "nodejs-yarn",
 	Slug:         "yarn",
@@ -19,83 +30,77 @@ var nodejsYarn = PackageManager{
 	PackageDir:   "node_modules",
 	ArgSeparator: []string{"--"},
 
-	getWorkspaceGlobs: func(rootpath string) ([]string, error) {
-		pkg, err := packageJson.Read(filepath.Join(rootpath, "package.json"))
-		if err != nil {
-			return nil, fmt.Errorf("package.json: %w", err)
-		}
-		if len(pkg.Workspaces) == 0 {
-			return nil, fmt.Errorf("package.json: no workspaces found. packagemanager requires Yarn workspaces to be defined in the root package.json")
-		}
-		return pkg.Workspaces, nil
-	},
-
-	getWorkspaceIgnores: func(pm PackageManager, rootpath string) ([]string, error) {
-		// function: https://github.com/yarnpkg/yarn/blob/3119382885ea373d3c13d6a846de743eca8c914b/src/config.js#L799
-
-		// Yarn is unique in ignore patterns handling.
-		// The only time it does globbing is for package.json or yarn.json and it scopes the search to each workspace.
-		// For example: `apps/*/node_modules/**/+(package.json|yarn.json)`
-		// The `extglob` `+(package.json|yarn.json)` (from micromatch) after node_modules/** is redundant.
-
-		globs, err := pm.getWorkspaceGlobs(rootpath)
-		if err != nil {
-			return nil, err
-		}
-
-		ignores := make([]string, len(globs))
-
-		for i, glob := range globs {
-			ignores[i] = filepath.Join(glob, "/node_modules/**")
-		}
-
-		return ignores, nil
+	Behavior: BehaviorFuncs{
+		WorkspaceGlobsFunc: func(fsys fs.FS) ([]string, error) {
+			return readPackageJSONWorkspaces(fsys, "Yarn")
+		},
+
+		WorkspaceIgnoresFunc: func(pm PackageManager, fsys fs.FS) ([]string, error) {
+			// function: https://github.com/yarnpkg/yarn/blob/3119382885ea373d3c13d6a846de743eca8c914b/src/config.js#L799
+
+			// Yarn is unique in ignore patterns handling.
+			// The only time it does globbing is for package.json or yarn.json and it scopes the search to each workspace.
+			// For example: `apps/*/node_modules/**/+(package.json|yarn.json)`
+			// The `extglob` `+(package.json|yarn.json)` (from micromatch) after node_modules/** is redundant.
+
+			globs, err := pm.Behavior.WorkspaceGlobs(fsys)
+			if err != nil {
+				return nil, err
+			}
+
+			ignores := make([]string, len(globs))
+
+			for i, glob := range globs {
+				ignores[i] = path.Join(glob, "/node_modules/**")
+			}
+
+			return ignores, nil
+		},
+
+		CanPruneFunc: func(fsys fs.FS) (bool, error) {
+			return true, nil
+		},
+
+		// Versions older than 2.0 are yarn, after that they become berry
+		MatchesFunc: func(manager string, version string) (bool, error) {
+			if manager != "yarn" {
+				return false, nil
+			}
+
+			v, err := semver.NewVersion(version)
+			if err != nil {
+				return false, fmt.Errorf("could not parse yarn version: %w", err)
+			}
+			c, err := semver.NewConstraint("<2.0.0-0")
+			if err != nil {
+				return false, fmt.Errorf("could not create constraint: %w", err)
+			}
+
+			return c.Check(v), nil
+		},
+
+		// Detect for yarn needs to tell yarn classic from berry, which share the same lockfile name.
+		// The lockfile format doesn't tell which 1.x version wrote it so the version is left unresolved.
+		DetectFunc: func(fsys fs.FS, packageManager *PackageManager) (bool, error) {
+			specfileExists := FileExistsFS(fsys, packageManager.Specfile)
+			lockfileExists := FileExistsFS(fsys, packageManager.Lockfile)
+
+			// Short-circuit, definitely not Yarn.
+			if !specfileExists || !lockfileExists {
+				return false, nil
+			}
+
+			isBerry, err := isBerryLockfile(fsys, packageManager.Lockfile)
+			if err != nil {
+				return false, fmt.Errorf("could not detect yarn lockfile format: %w", err)
+			}
+
+			return !isBerry, nil
+		},
+
+		UnmarshalLockfileFunc: unmarshalYarnLockfile,
+		MarshalLockfileFunc:   marshalYarnLockfile,
+
+		ListPatchesFunc: patchPackageListPatches,
 	},
-
-	canPrune: func(cwd string) (bool, error) {
-		return true, nil
-	},
-
-	// Versions older than 2.0 are yarn, after that they become berry
-	Matches: func(manager string, version string) (bool, error) {
-		if manager != "yarn" {
-			return false, nil
-		}
-
-		v, err := semver.NewVersion(version)
-		if err != nil {
-			return false, fmt.Errorf("could not parse yarn version: %w", err)
-		}
-		c, err := semver.NewConstraint("<2.0.0-0")
-		if err != nil {
-			return false, fmt.Errorf("could not create constraint: %w", err)
-		}
-
-		return c.Check(v), nil
-	},
-
-	// Detect for yarn needs to identify which version of yarn is running on the system.
-	detect: func(projectDirectory string, packageManager *PackageManager) (bool, error) {
-		specfileExists := FileExists(filepath.Join(projectDirectory, packageManager.Specfile))
-		lockfileExists := FileExists(filepath.Join(projectDirectory, packageManager.Lockfile))
-
-		// Short-circuit, definitely not Yarn.
-		if !specfileExists || !lockfileExists {
-			return false, nil
-		}
-
-		cmd := exec.Command("yarn", "--version")
-		cmd.Dir = projectDirectory
-		out, err := cmd.Output()
-		if err != nil {
-			return false, fmt.Errorf("could not detect yarn version: %w", err)
-		}
-
-		return packageManager.Matches(packageManager.Slug, strings.TrimSpace(string(out)))
-	},
-
-	// @FIXME unsuported lockfile
-	// UnmarshalLockfile: func(contents []byte) (lockfile.Lockfile, error) {
-	// 	return lockfile.DecodeNpmLockfile(contents)
-	// },
 }
@@ -0,0 +1,236 @@
+package packagemanager
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// unmarshalYarnLockfile reads a yarn classic lockfile (# yarn lockfile v1)
+func unmarshalYarnLockfile(contents []byte) (*Lockfile, error) {
+	type rawEntry struct {
+		descriptors []string
+		fields      map[string]string
+		sections    map[string]map[string]string
+	}
+	var entries []*rawEntry
+	var current *rawEntry
+	section := ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	scanner.Buffer(nil, 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		content := strings.TrimLeft(line, " ")
+		if content == "" || strings.HasPrefix(content, "#") {
+			continue
+		}
+		invalid := func(reason string) error {
+			return &ParseError{File: "yarn.lock", Line: lineNumber, Err: fmt.Errorf("%s: %q", reason, line)}
+		}
+		switch indent := len(line) - len(content); {
+		case indent == 0:
+			if !strings.HasSuffix(content, ":") {
+				return nil, invalid("expected an entry key")
+			}
+			current = &rawEntry{fields: map[string]string{}, sections: map[string]map[string]string{}}
+			for _, descriptor := range strings.Split(strings.TrimSuffix(content, ":"), ", ") {
+				current.descriptors = append(current.descriptors, unquoteYarnString(strings.TrimSpace(descriptor)))
+			}
+			entries = append(entries, current)
+		case current == nil:
+			return nil, invalid("unexpected indentation")
+		case indent == 2 && strings.HasSuffix(content, ":"):
+			section = unquoteYarnString(strings.TrimSuffix(content, ":"))
+			current.sections[section] = map[string]string{}
+		case indent == 2:
+			key, value, ok := splitYarnField(content)
+			if !ok {
+				return nil, invalid("expected a field")
+			}
+			current.fields[key] = value
+			section = ""
+		case indent == 4 && section != "":
+			key, value, ok := splitYarnField(content)
+			if !ok {
+				return nil, invalid("expected a dependency")
+			}
+			current.sections[section][key] = value
+		default:
+			return nil, invalid("unexpected indentation")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	lockfile := newLockfile("1")
+	for _, entry := range entries {
+		name, versionRange := splitDescriptor(entry.descriptors[0])
+		// aliases are written alias@npm:name@range
+		if alias, ok := strings.CutPrefix(versionRange, "npm:"); ok && strings.Contains(alias[1:], "@") {
+			name, _ = splitDescriptor(alias)
+		}
+		key := packageKey(name, entry.fields["version"])
+		for _, descriptor := range entry.descriptors {
+			lockfile.Descriptors[descriptor] = key
+		}
+		if _, ok := lockfile.Packages[key]; ok {
+			continue
+		}
+		lockfile.Packages[key] = &LockfilePackage{
+			Name:      name,
+			Version:   entry.fields["version"],
+			Resolved:  entry.fields["resolved"],
+			Integrity: entry.fields["integrity"],
+		}
+	}
+	for _, entry := range entries {
+		pkg := lockfile.Packages[lockfile.Descriptors[entry.descriptors[0]]]
+		for name, versionRange := range entry.sections["dependencies"] {
+			if key, ok := lockfile.Descriptors[name+"@"+versionRange]; ok {
+				mergeDependencyKeys(&pkg.Dependencies, map[string]string{name: key})
+				mergeDependencyKeys(&pkg.DependencyRanges, map[string]string{name: versionRange})
+			}
+		}
+		for name, versionRange := range entry.sections["optionalDependencies"] {
+			if key, ok := lockfile.Descriptors[name+"@"+versionRange]; ok {
+				mergeDependencyKeys(&pkg.OptionalDependencies, map[string]string{name: key})
+				mergeDependencyKeys(&pkg.DependencyRanges, map[string]string{name: versionRange})
+			}
+		}
+	}
+	return lockfile, nil
+}
+
+// splitYarnField splits a `key value` line, both of them may be quoted
+func splitYarnField(content string) (key string, value string, ok bool) {
+	if strings.HasPrefix(content, `"`) {
+		end := strings.Index(content[1:], `"`)
+		if end < 0 {
+			return "", "", false
+		}
+		key, value = content[1:end+1], strings.TrimSpace(content[end+2:])
+	} else {
+		key, value, ok = strings.Cut(content, " ")
+		if !ok {
+			return "", "", false
+		}
+	}
+	return key, unquoteYarnString(strings.TrimSpace(value)), true
+}
+
+func unquoteYarnString(value string) string {
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		return unquoted
+	}
+	return value
+}
+
+// yarnLockfileHeader starts the lockfiles written by yarn classic
+const yarnLockfileHeader = "# THIS IS AN AUTOGENERATED FILE. DO NOT EDIT THIS FILE DIRECTLY.\n# yarn lockfile v1\n\n"
+
+// marshalYarnLockfile writes a yarn classic lockfile. Entries are keyed by the ranges requesting
+// them, which must be recorded by the lockfile: pnpm lockfiles only record the workspaces ranges.
+func marshalYarnLockfile(lockfile *Lockfile) ([]byte, error) {
+	descriptors := map[string][]string{}
+	addDescriptor := func(key string, descriptor string) {
+		if !contains(descriptors[key], descriptor) {
+			descriptors[key] = append(descriptors[key], descriptor)
+		}
+	}
+	for _, dir := range sortedKeys(lockfile.Importers) {
+		importer := lockfile.Importers[dir]
+		for _, name := range sortedKeys(importer.Dependencies) {
+			dependency := importer.Dependencies[name]
+			if dependency.Link != "" || dependency.Package == "" || strings.HasPrefix(dependency.Specifier, "workspace:") {
+				continue
+			}
+			if dependency.Specifier == "" {
+				return nil, &UnsupportedConfigError{Manager: "nodejs-yarn", Reason: fmt.Sprintf("%s: the range of %s is unknown", dir, name)}
+			}
+			addDescriptor(dependency.Package, name+"@"+dependency.Specifier)
+		}
+	}
+	for _, key := range sortedKeys(lockfile.Packages) {
+		pkg := lockfile.Packages[key]
+		for _, dependencies := range []map[string]string{pkg.Dependencies, pkg.OptionalDependencies} {
+			for _, name := range sortedKeys(dependencies) {
+				versionRange, ok := pkg.DependencyRanges[name]
+				if !ok {
+					return nil, &UnsupportedConfigError{Manager: "nodejs-yarn", Reason: fmt.Sprintf("%s: the range of %s is unknown", key, name)}
+				}
+				addDescriptor(dependencies[name], name+"@"+versionRange)
+			}
+		}
+	}
+
+	type entry struct {
+		keyLine string
+		pkg     *LockfilePackage
+	}
+	var entries []entry
+	for key, keyDescriptors := range descriptors {
+		pkg, ok := lockfile.Packages[key]
+		if !ok {
+			continue
+		}
+		sort.Strings(keyDescriptors)
+		wrapped := make([]string, len(keyDescriptors))
+		for i, descriptor := range keyDescriptors {
+			wrapped[i] = quoteYarnString(descriptor)
+		}
+		entries = append(entries, entry{keyLine: strings.Join(wrapped, ", "), pkg: pkg})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].keyLine < entries[j].keyLine })
+
+	var buf bytes.Buffer
+	buf.WriteString(yarnLockfileHeader)
+	for _, entry := range entries {
+		pkg := entry.pkg
+		resolved := pkg.Resolved
+		if resolved == "" {
+			resolved = registryTarballURL(pkg.Name, pkg.Version)
+		}
+		fmt.Fprintf(&buf, "\n%s:\n", entry.keyLine)
+		fmt.Fprintf(&buf, "  version %s\n", quoteYarnString(pkg.Version))
+		fmt.Fprintf(&buf, "  resolved %s\n", quoteYarnString(resolved))
+		if pkg.Integrity != "" {
+			fmt.Fprintf(&buf, "  integrity %s\n", quoteYarnString(pkg.Integrity))
+		}
+		for _, section := range []struct {
+			name         string
+			dependencies map[string]string
+		}{
+			{"dependencies", pkg.Dependencies},
+			{"optionalDependencies", pkg.OptionalDependencies},
+		} {
+			if len(section.dependencies) == 0 {
+				continue
+			}
+			fmt.Fprintf(&buf, "  %s:\n", section.name)
+			for _, name := range sortedKeys(section.dependencies) {
+				fmt.Fprintf(&buf, "    %s %s\n", quoteYarnString(name), quoteYarnString(pkg.DependencyRanges[name]))
+			}
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// quoteYarnString quotes value the way yarn classic does: when it isn't a plain word
+func quoteYarnString(value string) string {
+	if value == "" || strings.HasPrefix(value, "true") || strings.HasPrefix(value, "false") ||
+		strings.ContainsAny(value, ":\t\r\n\\\",[] ") || !isASCIILetter(value[0]) {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}